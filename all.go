@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// runAll goes from the game installation to the deobfuscated protos in one
+// command: extract, then filter, match, report and apply
+func runAll(args []string) {
+	flags := flag.NewFlagSet("all", flag.ExitOnError)
+	profileName := flags.String("profile", "dofus", profileUsage)
+	configFile := flags.String("config", "deobfs.json", "JSON file declaring the profiles of other games and the matcher pipeline")
+	gameDir := flags.String("game", "", "game installation directory (auto-detected when empty)")
+	dumper := flags.String("dumper", "Il2CppDumper", "path to the Il2CppDumper executable")
+	protodec := flags.String("protodec", "protodec", "path to the protodec executable")
+	dumpDir := flags.String("dump", "dump", "directory for the Il2CppDumper output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: deobfs all [flags] [-- flags of the matching step]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	decompiledDir := "protos/decompiled"
+	runExtract([]string{
+		"-profile", *profileName,
+		"-config", *configFile,
+		"-game", *gameDir,
+		"-dumper", *dumper,
+		"-protodec", *protodec,
+		"-dump", *dumpDir,
+		"-output", decompiledDir,
+	})
+
+	for _, dir := range []string{"protos/filtered", "reports"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "error creating %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+	}
+
+	// Later flags win, so the forwarded ones can override these defaults
+	runMatch(append([]string{
+		"-profile", *profileName,
+		"-config", *configFile,
+		"-source", decompiledDir,
+		"-dump-cs", filepath.Join(*dumpDir, "dump.cs"),
+	}, flags.Args()...))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// apiServer holds the descriptors submitted to the API and the last mapping
+type apiServer struct {
+	logger *slog.Logger
+
+	mu           sync.Mutex
+	obfuscated   *utils.Descriptor
+	unobfuscated *utils.Descriptor
+	mapping      *utils.Mapping
+	timeout      time.Duration // Deadline of a match request
+	maxBody      int64         // Size limit of a submitted descriptor, in bytes
+}
+
+// runAPI serves the matcher over HTTP, so other tools don't have to shell out to the CLI
+func runAPI(args []string) {
+	flags := flag.NewFlagSet("api", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	obfuscatedDir := flags.String("obfuscated", "protos/filtered", "directory of obfuscated proto files loaded at startup, skipped when missing")
+	clearDir := flags.String("clear", "", "directory of clear proto files loaded at startup (defaults to the embedded baseline)")
+	timeout := flags.Duration("timeout", 5*time.Minute, "deadline of a match request")
+	maxBody := flags.Int64("max-body", 256<<20, "size limit of a submitted descriptor, in bytes")
+	logFormat := flags.String("log-format", "pretty", "log output (pretty for terminals, json for log tooling)")
+	flags.Parse(args)
+
+	format, err := utils.ParseLogFormat(*logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger := utils.InitLoggerFormat(utils.LevelInfo, format)
+	server := &apiServer{logger: logger, timeout: *timeout, maxBody: *maxBody}
+	ctx := context.Background()
+
+	if _, err := os.Stat(*obfuscatedDir); err == nil {
+		if server.obfuscated, err = utils.LoadAndParseProtos(ctx, *obfuscatedDir, nil, logger); err != nil {
+			logger.Error("error loading obfuscated protos", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *clearDir != "" {
+		server.unobfuscated, err = utils.LoadAndParseProtos(ctx, *clearDir, nil, logger)
+	} else {
+		baseline, _, baselineErr := baselineClearProtos()
+		if baselineErr != nil {
+			logger.Error("error loading embedded clear protos", "error", baselineErr)
+			os.Exit(1)
+		}
+		server.unobfuscated, err = utils.LoadAndParseProtosFS(ctx, baseline, baselineClearDir, nil, logger)
+	}
+	if err != nil {
+		logger.Error("error loading clear protos", "error", err)
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /descriptors/{kind}", server.handlePutDescriptor)
+	mux.HandleFunc("GET /descriptors/{kind}", server.handleGetDescriptor)
+	mux.HandleFunc("POST /match", server.handleMatch)
+	mux.HandleFunc("GET /mapping", server.handleGetMapping)
+
+	logger.Info("api listening", "addr", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		logger.Error("api server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// descriptor returns the descriptor slot of a kind, either obfuscated or clear
+func (s *apiServer) descriptor(kind string) (**utils.Descriptor, bool) {
+	switch kind {
+	case "obfuscated":
+		return &s.obfuscated, true
+	case "clear":
+		return &s.unobfuscated, true
+	}
+	return nil, false
+}
+
+func (s *apiServer) handlePutDescriptor(w http.ResponseWriter, r *http.Request) {
+	var desc utils.Descriptor
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBody)).Decode(&desc); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("descriptor larger than %d bytes, raise -max-body", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid descriptor: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot, ok := s.descriptor(r.PathValue("kind"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown descriptor kind, use obfuscated or clear")
+		return
+	}
+	*slot = &desc
+	s.logger.Info("descriptor submitted", "kind", r.PathValue("kind"), "messages", len(desc.MessageType))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) handleGetDescriptor(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot, ok := s.descriptor(r.PathValue("kind"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown descriptor kind, use obfuscated or clear")
+		return
+	}
+	if *slot == nil {
+		writeError(w, http.StatusNotFound, "no descriptor submitted")
+		return
+	}
+	writeJSON(w, *slot)
+}
+
+func (s *apiServer) handleMatch(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.obfuscated == nil || s.unobfuscated == nil {
+		writeError(w, http.StatusConflict, "both obfuscated and clear descriptors are needed")
+		return
+	}
+
+	// The matching stops with the request, or when it takes too long
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	result, err := match.Match(ctx, s.obfuscated, s.unobfuscated, match.Options{Logger: s.logger})
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "matching took longer than "+s.timeout.String())
+		return
+	}
+	if err != nil {
+		s.logger.Warn("match request cancelled", "error", err)
+		return
+	}
+	allMatches := result.All()
+	utils.SetMatchIds(allMatches, s.obfuscated)
+	utils.SetFieldMappings(allMatches, s.obfuscated, s.unobfuscated)
+
+	s.mapping = &utils.Mapping{Version: mapping.Version, Matches: allMatches}
+	writeJSON(w, s.mapping)
+}
+
+func (s *apiServer) handleGetMapping(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mapping == nil {
+		writeError(w, http.StatusNotFound, "no mapping yet, POST /match first")
+		return
+	}
+	writeJSON(w, s.mapping)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
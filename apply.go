@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runApply renames the messages of a proto tree with a mapping file, like the
+// end of a run does, once the checksum of the mapping is checked so a
+// corrupted or hand-edited file doesn't rewrite the tree wrongly
+func runApply(args []string) {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	mappingFile := flags.String("mapping", "reports/mapping.json", "mapping file to apply")
+	keyFile := flags.String("key", "", "ed25519 public key (PEM) the mapping must be signed with")
+	unchecked := flags.Bool("unchecked", false, "apply a mapping without checksum, written by an older version")
+	protoDir := flags.String("protos", "protos/filtered", "directory or .zip/.tar.gz archive of the obfuscated proto files")
+	output := flags.String("output", "protos/deobfuscated", "directory to write the renamed proto files to")
+	purge := flags.Bool("purge", false, "remove the proto files of -output before writing them")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	loaded, err := loadVerifiedMapping(*mappingFile, *keyFile)
+	if errors.Is(err, utils.ErrNoChecksum) && *unchecked && *keyFile == "" {
+		logger.Warn("the mapping has no checksum, applying it unchecked", "file", *mappingFile)
+	} else if errors.Is(err, utils.ErrNoChecksum) && *keyFile == "" {
+		logger.Error("the mapping has no checksum, -unchecked applies it anyway", "file", *mappingFile)
+		os.Exit(1)
+	} else if err != nil {
+		logger.Error("error loading mapping", "file", *mappingFile, "error", err)
+		os.Exit(1)
+	}
+
+	fsys, err := utils.OpenProtoSource(*protoDir)
+	if err != nil {
+		logger.Error("error opening protos", "error", err)
+		os.Exit(1)
+	}
+	if *purge {
+		purged, err := utils.PurgeProtos(*output)
+		if err != nil {
+			logger.Error("failed to purge deobfuscated protos", "error", err)
+			os.Exit(1)
+		}
+		if purged > 0 {
+			logger.Info("purged the proto files of a previous run", "dir", *output, "files", purged)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := utils.ApplyMatchesFS(ctx, loaded.Matches, fsys, *output); err != nil {
+		logger.Error("failed to apply matches", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("mapping applied", "matches", len(loaded.Matches), "output", *output)
+}
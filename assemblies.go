@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runAssemblies lists the assemblies declared by the protodec output with
+// their message counts, and writes the chosen ones to the filter section of
+// the config file, picked on the terminal or with -select
+func runAssemblies(args []string) {
+	flags := flag.NewFlagSet("assemblies", flag.ExitOnError)
+	source := flags.String("source", "protos/decompiled", "directory or .zip/.tar.gz archive of the protodec output")
+	configFile := flags.String("config", "deobfs.json", "config file whose filter assemblies are replaced by the chosen ones")
+	var selected []string
+	flags.Func("select", "assembly to keep, without asking (repeatable)", func(name string) error {
+		selected = append(selected, name)
+		return nil
+	})
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelWarn)
+
+	fsys, err := utils.OpenProtoSource(*source)
+	if err != nil {
+		logger.Error("error opening source", "error", err)
+		os.Exit(1)
+	}
+	assemblies, err := utils.DiscoverAssemblies(fsys)
+	if err != nil {
+		logger.Error("error reading source", "error", err)
+		os.Exit(1)
+	}
+	if len(assemblies) == 0 {
+		fmt.Fprintf(os.Stderr, "no proto file of %s declares an assembly\n", *source)
+		os.Exit(1)
+	}
+
+	if len(selected) == 0 {
+		printAssemblies(os.Stdout, assemblies)
+		if !isatty.IsTerminal(os.Stdin.Fd()) {
+			return
+		}
+		if selected = askAssemblies(bufio.NewReader(os.Stdin), os.Stdout, assemblies); len(selected) == 0 {
+			return
+		}
+	}
+
+	known := make(map[string]bool, len(assemblies))
+	for _, assembly := range assemblies {
+		known[assembly.Name] = true
+	}
+	var patterns []string
+	for _, name := range selected {
+		if !known[name] {
+			fmt.Fprintf(os.Stderr, "no proto file of %s declares %s\n", *source, name)
+			os.Exit(2)
+		}
+		patterns = append(patterns, "^"+regexp.QuoteMeta(name)+"$")
+	}
+
+	if err := saveFilterAssemblies(*configFile, patterns); err != nil {
+		logger.Error("error writing config file", "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d assemblies written to %s\n", len(patterns), *configFile)
+}
+
+func printAssemblies(w io.Writer, assemblies []utils.DiscoveredAssembly) {
+	width := 0
+	for _, assembly := range assemblies {
+		width = max(width, len(assembly.Name))
+	}
+	for i, assembly := range assemblies {
+		fmt.Fprintf(w, "%3d. %-*s %5d files %6d messages\n", i+1, width, assembly.Name, assembly.Files, assembly.Messages)
+	}
+}
+
+// askAssemblies asks for the numbers of the assemblies to keep until they are
+// valid, nil when the answer or the input is empty
+func askAssemblies(reader *bufio.Reader, out io.Writer, assemblies []utils.DiscoveredAssembly) []string {
+	for {
+		fmt.Fprint(out, "Assemblies to keep (numbers separated by spaces, empty to leave the config unchanged): ")
+		line, err := reader.ReadString('\n')
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' || r == '\n' || r == '\r' })
+		if len(fields) == 0 {
+			if err != nil {
+				fmt.Fprintln(out)
+			}
+			return nil
+		}
+
+		var names []string
+		for _, field := range fields {
+			number, convErr := strconv.Atoi(field)
+			if convErr != nil || number < 1 || number > len(assemblies) {
+				fmt.Fprintf(out, "%s is not a number of the list\n", field)
+				names = nil
+				break
+			}
+			names = append(names, assemblies[number-1].Name)
+		}
+		if names != nil {
+			return names
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+)
+
+// Baseline snapshot of the clear Connection/Game protos, used when no -clear directory is given
+//
+//go:embed protos/clear
+var baselineClear embed.FS
+
+const baselineClearDir = "protos/clear"
+
+// baselineClearProtos returns the embedded clear protos and the version of the snapshot,
+// which is a hash of its content
+func baselineClearProtos() (fs.FS, string, error) {
+	fsys, err := fs.Sub(baselineClear, baselineClearDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash := sha256.New()
+	err = fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		hash.Write([]byte(path))
+		hash.Write(content)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return fsys, hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
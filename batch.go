@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// batchRun is the outcome of the run of a version workspace
+type batchRun struct {
+	workspace string
+	err       error
+}
+
+// runBatch runs the matching of several game versions, one workspace each
+// laid out like a run directory (protos/decompiled, dump/dump.cs,
+// deobfs.json...), then chains the changelogs between consecutive versions.
+// Every run is a deobfs process started in its workspace, so the relative
+// paths of the forwarded flags are relative to the workspaces.
+func runBatch(args []string) {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	jobs := flags.Int("jobs", 1, "number of versions matched at the same time")
+	changelogFile := flags.String("changelog", "changelog.txt", "file to write the changelog across the versions to (empty to skip it)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: deobfs batch [flags] <workspaces, oldest first...> [-- flags of the matching step]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	workspaces, matchArgs := splitForwardedArgs(flags.Args())
+	if len(workspaces) == 0 || *jobs < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("error locating the deobfs executable", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runs := make([]batchRun, len(workspaces))
+	indexes := make(chan int, len(workspaces))
+	for i, workspace := range workspaces {
+		runs[i].workspace = workspace
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(*jobs, len(workspaces)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() != nil {
+					runs[i].err = ctx.Err()
+					continue
+				}
+				runs[i].err = runBatchVersion(ctx, executable, runs[i].workspace, matchArgs, logger)
+			}
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, run := range runs {
+		if run.err != nil {
+			logger.Error("version failed", "workspace", run.workspace, "error", run.err)
+			failed++
+		}
+	}
+
+	if *changelogFile != "" && ctx.Err() == nil {
+		changelog, err := batchChangelog(ctx, runs, logger)
+		if err != nil {
+			logger.Error("error building the changelog", "error", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*changelogFile, []byte(changelog), 0644); err != nil {
+			logger.Error("error writing changelog", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("changelog written", "file", *changelogFile)
+	}
+
+	logger.Info("batch done", "versions", len(runs), "failed", failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// splitForwardedArgs splits the arguments of batch at --, the ones after it
+// being forwarded to the matching step
+func splitForwardedArgs(args []string) (before, after []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// runBatchVersion matches the version of a workspace, its logs going to
+// reports/batch.log of the workspace
+func runBatchVersion(ctx context.Context, executable, workspace string, matchArgs []string, logger *slog.Logger) error {
+	if info, err := os.Stat(workspace); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s isn't a directory", workspace)
+	}
+	for _, dir := range []string{"protos/filtered", "reports"} {
+		if err := os.MkdirAll(filepath.Join(workspace, dir), 0755); err != nil {
+			return err
+		}
+	}
+	logPath := filepath.Join(workspace, "reports", "batch.log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	logger.Info("matching version", "workspace", workspace)
+	started := time.Now()
+
+	cmd := exec.CommandContext(ctx, executable, append([]string{"-progress=false", "-no-color"}, matchArgs...)...)
+	cmd.Dir = workspace
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w, see %s", err, logPath)
+	}
+
+	logger.Info("version matched", "workspace", workspace, "duration", time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// batchChangelog chains the changelogs between the deobfuscated protos of
+// consecutive versions, skipping the ones which failed
+func batchChangelog(ctx context.Context, runs []batchRun, logger *slog.Logger) (string, error) {
+	var changelog strings.Builder
+	var previous *utils.Descriptor
+	var previousWorkspace string
+	for _, run := range runs {
+		if run.err != nil {
+			continue
+		}
+		current, err := utils.LoadAndParseProtos(ctx, filepath.Join(run.workspace, "protos", "deobfuscated"), nil, logger)
+		if err != nil {
+			return "", fmt.Errorf("loading the deobfuscated protos of %s: %w", run.workspace, err)
+		}
+		if previous != nil {
+			fmt.Fprintf(&changelog, "%s -> %s\n\n", previousWorkspace, run.workspace)
+			changelog.WriteString(utils.GenerateChangelog(previous, current))
+			changelog.WriteString("\n")
+		}
+		previous, previousWorkspace = current, run.workspace
+	}
+	return changelog.String(), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// runBench runs the matching pipeline several times on the current inputs and
+// prints statistics on the time spent in each phase. It also checks every run
+// wrote the same mapping, since mappings are committed and must not churn.
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := flags.Int("n", 5, "number of measured runs")
+	warmup := flags.Int("warmup", 1, "number of runs before measuring, filling the caches")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: deobfs bench [flags] [-- flags of the matching step]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *runs < 1 {
+		fmt.Fprintln(os.Stderr, "-n must be at least 1")
+		os.Exit(2)
+	}
+
+	// Durations of each phase, phases in the order of the first run
+	var phases []string
+	durations := make(map[string][]time.Duration)
+	var mappingHash []byte
+	deterministic := true
+	for i := 0; i < *warmup+*runs; i++ {
+		// Later flags win, the forwarded ones can turn the logs back on
+		timer := runMatch(append([]string{"-log", "warn"}, flags.Args()...))
+
+		hash, err := hashFile("reports/mapping.json")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading the mapping of run %d: %v\n", i+1, err)
+			os.Exit(1)
+		}
+		if mappingHash == nil {
+			mappingHash = hash
+		} else if !bytes.Equal(hash, mappingHash) {
+			fmt.Fprintf(os.Stderr, "run %d wrote a different mapping than the first one\n", i+1)
+			deterministic = false
+		}
+
+		if i < *warmup {
+			continue
+		}
+
+		var total time.Duration
+		for _, phase := range timer.Phases() {
+			if _, ok := durations[phase.Name]; !ok {
+				phases = append(phases, phase.Name)
+			}
+			durations[phase.Name] = append(durations[phase.Name], phase.Duration)
+			total += phase.Duration
+		}
+		durations["total"] = append(durations["total"], total)
+	}
+	phases = append(phases, "total")
+
+	fmt.Printf("%d runs after %d warmup runs\n\n", *runs, *warmup)
+	fmt.Printf("%-18s %10s %10s %10s %10s\n", "phase", "min", "median", "mean", "max")
+	for _, phase := range phases {
+		times := durations[phase]
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+		var sum time.Duration
+		for _, t := range times {
+			sum += t
+		}
+		fmt.Printf("%-18s %10s %10s %10s %10s\n", phase,
+			formatBenchDuration(times[0]),
+			formatBenchDuration(times[len(times)/2]),
+			formatBenchDuration(sum/time.Duration(len(times))),
+			formatBenchDuration(times[len(times)-1]),
+		)
+	}
+
+	if !deterministic {
+		os.Exit(1)
+	}
+}
+
+func hashFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+func formatBenchDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
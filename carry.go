@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runCarry matches the protodec output of a new build against the one of the
+// build a mapping was made for. Their structures barely change between
+// builds, so the new obfuscated names pair with the previous ones even when
+// they're all re-rolled, and the previous mapping gives their original names.
+// The pairs are written as seeds for the next run.
+func runCarry(args []string) {
+	flags := flag.NewFlagSet("carry", flag.ExitOnError)
+	profileName := flags.String("profile", "dofus", profileUsage)
+	configFile := flags.String("config", "deobfs.json", "JSON file declaring the profiles of other games")
+	previousSource := flags.String("previous", "", "directory or .zip/.tar.gz archive of the protodec output the mapping was made for")
+	mappingFile := flags.String("mapping", "reports/mapping.json", "mapping of the previous build")
+	source := flags.String("source", "protos/decompiled", "directory or .zip/.tar.gz archive of the protodec output of the new build")
+	output := flags.String("output", "seeds.json", "seed file to create or add the carried pairs to")
+	threshold := flags.Float64("threshold", 90, "confidence under which a pair of obfuscated messages isn't trusted")
+	dumpFile := flags.String("dump-cs", "dump/dump.cs", "dump.cs of Il2CppDumper for the new build, pairing the messages by protocol id first, skipped when missing")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	if *previousSource == "" {
+		logger.Error("usage: deobfs carry -previous <previous protodec output> [-mapping reports/mapping.json] [-source protos/decompiled] [-output seeds.json]")
+		os.Exit(2)
+	}
+
+	profile, err := loadProfile(*profileName, *configFile)
+	if err != nil {
+		logger.Error("error selecting profile", "error", err)
+		os.Exit(2)
+	}
+
+	previousMapping, err := utils.LoadMapping(*mappingFile)
+	if err != nil {
+		logger.Error("error loading previous mapping", "error", err)
+		os.Exit(1)
+	}
+
+	var existing []utils.Seed
+	if _, err := os.Stat(*output); err == nil {
+		if existing, err = utils.LoadSeeds(*output); err != nil {
+			logger.Error("error loading existing seed file", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+	previous, err := loadFilteredSource(ctx, *previousSource, profile.AssembliesOfInterest, logger)
+	if err != nil {
+		logger.Error("error loading previous protodec output", "error", err)
+		os.Exit(1)
+	}
+	current, err := loadFilteredSource(ctx, *source, profile.AssembliesOfInterest, logger)
+	if err != nil {
+		logger.Error("error loading new protodec output", "error", err)
+		os.Exit(1)
+	}
+
+	// Protocol ids pair the messages whatever their structure changes
+	var idSeeds []utils.Seed
+	if _, err := os.Stat(*dumpFile); err == nil {
+		ids, err := utils.ParseMessageIds(*dumpFile)
+		if err != nil {
+			logger.Error("error parsing protocol ids", "error", err)
+			os.Exit(1)
+		}
+		utils.AssignMessageIds(current, ids)
+		idSeeds = utils.SeedsById(current, previousMapping.Matches, "carry")
+	}
+
+	// The previous build stands for the clear protos
+	result, err := match.Match(ctx, current, previous, match.Options{Logger: logger})
+	if err != nil {
+		logger.Error("error matching the builds", "error", err)
+		os.Exit(1)
+	}
+
+	seeds, stats := carrySeeds(result.All(), previousMapping.Matches, *threshold, *previousSource)
+	logger.Info("mapping carried to the new build", "carried", stats.carried, "unsure", stats.unsure,
+		"unmapped", stats.unmapped, "lost", stats.lost, "new", len(current.MessageType)-stats.paired, "by_id", len(idSeeds))
+
+	// The ids win over the structure
+	merged := utils.MergeSeeds(existing, utils.MergeSeeds(seeds, idSeeds))
+	if err := utils.WriteSeeds(merged, *output); err != nil {
+		logger.Error("error writing seed file", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("seed file written", "file", *output, "seeds", len(merged))
+}
+
+// carryStats counts what became of the pairs of obfuscated messages
+type carryStats struct {
+	paired   int // New messages paired with a previous one
+	carried  int // Pairs given the original name of the previous message
+	unsure   int // Pairs ambiguous or under the threshold
+	unmapped int // Pairs whose previous message the mapping doesn't name
+	lost     int // Messages named by the mapping no name is carried from
+}
+
+// carrySeeds turns the pairs of a new obfuscated message with a previous one
+// into seeds naming the new message like the mapping named the previous one.
+// The pairs under threshold or with alternatives are left to the matchers.
+func carrySeeds(pairs, previous []utils.MessageMatch, threshold float64, source string) ([]utils.Seed, carryStats) {
+	originals := make(map[string]string, len(previous))
+	for _, m := range previous {
+		if len(m.Alternatives) == 0 {
+			originals[m.ObfuscatedMsg] = m.OriginalMsg
+		}
+	}
+
+	var stats carryStats
+	var seeds []utils.Seed
+	paired := make(map[string]bool)
+	for _, pair := range pairs {
+		stats.paired++
+		if len(pair.Alternatives) > 0 || pair.MatchPercent < threshold {
+			stats.unsure++
+			continue
+		}
+		original, ok := originals[pair.OriginalMsg]
+		if !ok {
+			stats.unmapped++
+			continue
+		}
+		paired[pair.OriginalMsg] = true
+		stats.carried++
+		seeds = append(seeds, utils.Seed{
+			Obfuscated: pair.ObfuscatedMsg,
+			Original:   original,
+			Source:     fmt.Sprintf("carry:%s:%s", source, pair.OriginalMsg),
+		})
+	}
+	for name := range originals {
+		if !paired[name] {
+			stats.lost++
+		}
+	}
+	return seeds, stats
+}
+
+// loadFilteredSource filters a protodec output to assemblies in memory and
+// parses it. The files which can't be filtered are only warned about, the
+// others still pairing.
+func loadFilteredSource(ctx context.Context, source string, assemblies []string, logger *slog.Logger) (*utils.Descriptor, error) {
+	config := utils.Config{
+		SourceDir:            source,
+		AssembliesOfInterest: assemblies,
+	}
+	filtered, err := utils.FilterProtoFilesFS(config)
+	var failures *utils.FilterFailures
+	if errors.As(err, &failures) {
+		for _, failure := range failures.Errors {
+			logger.Warn("error filtering proto file", "source", source, "error", failure)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return utils.LoadAndParseProtosFS(ctx, filtered, source, nil, logger)
+}
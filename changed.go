@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runChanged tells whether the protocol of a new dump differs from the last
+// matched one, comparing their structural fingerprints
+func runChanged(args []string) {
+	flags := flag.NewFlagSet("changed", flag.ExitOnError)
+	profileName := flags.String("profile", "dofus", profileUsage)
+	configFile := flags.String("config", "deobfs.json", "JSON file declaring the profiles of other games")
+	source := flags.String("source", "protos/decompiled", "directory or .zip/.tar.gz archive of the protodec output")
+	workspace := flags.String("workspace", ".deobfs", "workspace directory holding the fingerprint of the last run")
+	exitCode := flags.Bool("exit-code", false, "exit with status 1 when the protocol changed")
+	record := flags.Bool("record", false, "record the fingerprint of this dump as the last run")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelWarn)
+
+	profile, err := loadProfile(*profileName, *configFile)
+	if err != nil {
+		logger.Error("error selecting profile", "error", err)
+		os.Exit(2)
+	}
+
+	// Fingerprints are computed on the filtered files, like the ones of the runs
+	filtered, err := os.MkdirTemp("", "deobfs-changed-")
+	if err != nil {
+		logger.Error("error creating temporary directory", "error", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(filtered)
+
+	config := utils.Config{
+		SourceDir:            *source,
+		OutputDir:            filtered,
+		AssembliesOfInterest: profile.AssembliesOfInterest,
+	}
+	if err := utils.FilterProtoFiles(config); err != nil {
+		logger.Error("error filtering proto files", "error", err)
+		os.Exit(1)
+	}
+
+	desc, err := utils.LoadAndParseProtos(context.Background(), filtered, nil, logger)
+	if err != nil {
+		logger.Error("error loading proto files", "error", err)
+		os.Exit(1)
+	}
+	current := utils.FingerprintCorpus(desc)
+
+	previous, err := utils.LoadFingerprint(*workspace)
+	if err != nil {
+		logger.Error("error loading last fingerprint", "error", err)
+		os.Exit(1)
+	}
+
+	changed := true
+	switch {
+	case previous == nil:
+		fmt.Printf("no recorded run, fingerprint %s (%d messages)\n", current.Hash, len(desc.MessageType))
+	case previous.Hash == current.Hash:
+		changed = false
+		fmt.Printf("protocol unchanged since the run of %s (fingerprint %s)\n", previous.RecordedAt.Format("2006-01-02 15:04"), current.Hash)
+	default:
+		added, removed := utils.CorpusChanges(previous, current)
+		fmt.Printf("protocol changed since the run of %s: %d new or modified messages, %d removed or modified ones (fingerprint %s -> %s)\n",
+			previous.RecordedAt.Format("2006-01-02 15:04"), added, removed, previous.Hash, current.Hash)
+	}
+
+	if *record {
+		if err := utils.SaveFingerprint(*workspace, current); err != nil {
+			logger.Error("error recording fingerprint", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if changed && *exitCode {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runChangelog compares two deobfuscated proto directories, e.g. from two client versions
+func runChangelog(args []string) {
+	flags := flag.NewFlagSet("changelog", flag.ExitOnError)
+	oldDir := flags.String("old", "", "deobfuscated protos of the old client version")
+	newDir := flags.String("new", "protos/deobfuscated", "deobfuscated protos of the new client version")
+	output := flags.String("output", "", "file to write the changelog to (defaults to stdout)")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelWarn)
+
+	if *oldDir == "" {
+		logger.Error("missing -old directory")
+		os.Exit(1)
+	}
+
+	oldDesc, err := utils.LoadAndParseProtos(context.Background(), *oldDir, nil, logger)
+	if err != nil {
+		logger.Error("error loading old protos", "error", err)
+		os.Exit(1)
+	}
+
+	newDesc, err := utils.LoadAndParseProtos(context.Background(), *newDir, nil, logger)
+	if err != nil {
+		logger.Error("error loading new protos", "error", err)
+		os.Exit(1)
+	}
+
+	changelog := utils.GenerateChangelog(oldDesc, newDesc)
+
+	if *output == "" {
+		fmt.Print(changelog)
+		return
+	}
+	if err := os.WriteFile(*output, []byte(changelog), 0644); err != nil {
+		logger.Error("error writing changelog", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runConfig is the content of the -config file
+type runConfig struct {
+	// Pipeline lists the matchers to run in order, with their options
+	Pipeline []match.Stage `json:"pipeline"`
+	// Filter selects the files of the protodec output to match
+	Filter filterConfig `json:"filter"`
+	// Messages selects the obfuscated messages to match among them
+	Messages messagesConfig `json:"messages"`
+	// Profiles describes other games than the built-in ones, by the name
+	// -profile gives them
+	Profiles map[string]utils.Profile `json:"profiles"`
+}
+
+// profileUsage is the help of the -profile flags
+const profileUsage = "game profile: dofus, a profile of the -config file, or a profile .json file"
+
+// messagesConfig holds regular expressions of obfuscated message names
+type messagesConfig struct {
+	// Messages to match, all of them when empty
+	Include []string `json:"include"`
+	// Messages to leave out among them
+	Exclude []string `json:"exclude"`
+	// Match the messages the included ones reference too, transitively
+	References bool `json:"references"`
+}
+
+// filterConfig holds regular expressions of assemblies, like
+// `Ankama\.Dofus\.Protocol\..*`, and what becomes of the syntax lines
+type filterConfig struct {
+	// Assemblies to keep, the ones of the profile when empty
+	Assemblies []string `json:"assemblies"`
+	// Assemblies to leave out among them, like test or editor ones
+	Exclude []string `json:"exclude"`
+	// What becomes of the syntax line of the filtered files: normalize,
+	// preserve, or proto2/proto3 to replace it
+	Syntax string `json:"syntax"`
+	// Keep the files the kept ones import, even from other assemblies
+	Dependencies bool `json:"dependencies"`
+	// Keep the comment lines, with the hints of protodec
+	Comments bool `json:"comments"`
+}
+
+// loadRunConfig reads the -config file. A missing file gives the default
+// configuration.
+func loadRunConfig(path string) (*runConfig, error) {
+	settings := &runConfig{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		settings.Pipeline = match.DefaultPipeline()
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	if settings.Pipeline == nil {
+		settings.Pipeline = match.DefaultPipeline()
+	}
+	if err := match.ValidatePipeline(settings.Pipeline); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	if err := utils.ValidateSyntax(settings.Filter.Syntax); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// loadProfile returns the profile -profile names, among the profiles of the
+// config file at configPath, the built-in ones and the profile files
+func loadProfile(name, configPath string) (utils.Profile, error) {
+	settings, err := loadRunConfig(configPath)
+	if err != nil {
+		return utils.Profile{}, err
+	}
+	return utils.ResolveProfile(name, settings.Profiles)
+}
+
+// saveFilterAssemblies replaces the assemblies of the filter section of the
+// config file at path, only rewriting their value so the other keys keep
+// their order and layout. The file is created when missing.
+func saveFilterAssemblies(path string, assemblies []string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = []byte("{}\n"), nil
+	}
+	if err != nil {
+		return err
+	}
+	if data, err = setMember(data, 0, []string{"filter", "assemblies"}, assemblies); err != nil {
+		return fmt.Errorf("editing config file %s: %w", path, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// setMember sets the member at the path of keys of the JSON object at offset
+// of data to value, adding it, and the objects leading to it, at the end of
+// their object when missing
+func setMember(data []byte, offset int, keys []string, value any) ([]byte, error) {
+	start, end, found, err := memberSpan(data, offset, keys[0])
+	if err != nil {
+		return nil, err
+	}
+	if found && len(keys) > 1 {
+		if data[start] != '{' {
+			return nil, fmt.Errorf("%s isn't an object", keys[0])
+		}
+		return setMember(data, start, keys[1:], value)
+	}
+	if found {
+		encoded, err := json.MarshalIndent(value, lineIndent(data, start), "  ")
+		if err != nil {
+			return nil, err
+		}
+		return splice(data, start, end, encoded), nil
+	}
+
+	for i := len(keys) - 1; i > 0; i-- {
+		value = map[string]any{keys[i]: value}
+	}
+	indent := lineIndent(data, start)
+	encoded, err := json.MarshalIndent(value, indent+"  ", "  ")
+	if err != nil {
+		return nil, err
+	}
+	key, err := json.Marshal(keys[0])
+	if err != nil {
+		return nil, err
+	}
+	member := fmt.Sprintf("\n%s  %s: %s\n%s", indent, key, encoded, indent)
+	// After the last member, replacing the blank before the closing brace
+	last := len(bytes.TrimRight(data[:start], " \t\r\n"))
+	if data[last-1] != '{' {
+		member = "," + member
+	}
+	return splice(data, last, start, []byte(member)), nil
+}
+
+// memberSpan returns the span of the value of key in the JSON object at
+// offset of data, the last one when the key repeats like for json.Unmarshal,
+// or the offset of the closing brace of the object when it's missing
+func memberSpan(data []byte, offset int, key string) (start, end int, found bool, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data[offset:]))
+	if token, err := decoder.Token(); err != nil {
+		return 0, 0, false, err
+	} else if token != json.Delim('{') {
+		return 0, 0, false, errors.New("not a JSON object")
+	}
+	for decoder.More() {
+		name, err := decoder.Token()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return 0, 0, false, err
+		}
+		if name == key {
+			end = offset + int(decoder.InputOffset())
+			start, found = end-len(value), true
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return 0, 0, false, err
+	}
+	if !found {
+		start = offset + int(decoder.InputOffset()) - 1
+		end = start
+	}
+	return start, end, found, nil
+}
+
+// lineIndent returns the leading blank of the line of data at offset
+func lineIndent(data []byte, offset int) string {
+	line := data[bytes.LastIndexByte(data[:offset], '\n')+1 : offset]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// splice replaces data[start:end] with replacement
+func splice(data []byte, start, end int, replacement []byte) []byte {
+	return append(append(append([]byte(nil), data[:start]...), replacement...), data[end:]...)
+}
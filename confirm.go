@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// confirmMatches asks about each accepted match under threshold, showing the
+// structures of both messages. Confirmed matches are returned as seeds, the
+// rejected ones as rejected seeds, skipped ones aren't recorded. The end of
+// the input skips the remaining matches. Confirmations are sent as events, the
+// rejections are once WithoutRejected drops the matches.
+func confirmMatches(ctx context.Context, in io.Reader, out io.Writer, matches []utils.MessageMatch, obfuscated, unobfuscated *utils.Descriptor, threshold float64) []utils.Seed {
+	obfuscatedMsgs := messagesByName(obfuscated)
+	originalMsgs := messagesByName(unobfuscated)
+
+	var pending []utils.MessageMatch
+	for _, match := range matches {
+		if len(match.Alternatives) == 0 && match.Matcher != "seed" && match.MatchPercent < threshold {
+			pending = append(pending, match)
+		}
+	}
+
+	var decisions []utils.Seed
+	reader := bufio.NewReader(in)
+	for i, match := range pending {
+		obfuscatedMsg, originalMsg := obfuscatedMsgs[match.ObfuscatedMsg], originalMsgs[match.OriginalMsg]
+		if obfuscatedMsg == nil || originalMsg == nil {
+			continue
+		}
+
+		fmt.Fprintf(out, "\n[%d/%d] %s → %s, %.2f%% by %s\n", i+1, len(pending), match.ObfuscatedMsg, match.OriginalMsg, match.MatchPercent, match.Matcher)
+		fmt.Fprintf(out, "%s (%s)\n", obfuscatedMsg.Name, filepath.Base(obfuscatedMsg.SourceFile))
+		printMessageStructure(out, obfuscatedMsg, "  ")
+		fmt.Fprintf(out, "%s (%s)\n", originalMsg.Name, filepath.Base(originalMsg.SourceFile))
+		printMessageStructure(out, originalMsg, "  ")
+
+		answer, ok := askDecision(reader, out)
+		if !ok {
+			break
+		}
+		switch answer {
+		case "y":
+			decisions = append(decisions, utils.Seed{Obfuscated: match.ObfuscatedMsg, Original: match.OriginalMsg, Source: "confirm-below"})
+			utils.EmitEvent(ctx, utils.Event{Kind: utils.EventMatchFound, Matcher: "confirm", Match: &match, Reason: "confirmed on the terminal"})
+		case "n":
+			decisions = append(decisions, utils.Seed{Obfuscated: match.ObfuscatedMsg, Original: match.OriginalMsg, Source: "confirm-below", Rejected: true})
+		}
+	}
+	return decisions
+}
+
+// askDecision asks until the answer is y, n or s (skip), false at the end of the input
+func askDecision(reader *bufio.Reader, out io.Writer) (string, bool) {
+	for {
+		fmt.Fprint(out, "Accept this match? [y/n/s] ")
+		line, err := reader.ReadString('\n')
+		switch answer := strings.ToLower(strings.TrimSpace(line)); answer {
+		case "y", "yes":
+			return "y", true
+		case "n", "no":
+			return "n", true
+		case "s", "skip":
+			return "s", true
+		}
+		if err != nil {
+			fmt.Fprintln(out)
+			return "", false
+		}
+	}
+}
+
+func messagesByName(desc *utils.Descriptor) map[string]*utils.MessageType {
+	messages := make(map[string]*utils.MessageType, len(desc.MessageType))
+	for i := range desc.MessageType {
+		messages[desc.MessageType[i].Name] = &desc.MessageType[i]
+	}
+	return messages
+}
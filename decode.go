@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+	"github.com/ruinedyourlife/deobfs/utils/pcap"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// runDecode decodes the Dofus traffic of a capture with the deobfuscated protos
+func runDecode(args []string) {
+	flags := flag.NewFlagSet("decode", flag.ExitOnError)
+	capture := flags.String("pcap", "", "pcap or pcapng capture file")
+	port := flags.Int("port", 5555, "game server port")
+	protoDir := flags.String("protos", "protos/deobfuscated", "directory of the deobfuscated proto files")
+	mappingFile := flags.String("mapping", "reports/mapping.json", "mapping file used to generate the deobfuscated protos")
+	envelopeName := flags.String("envelope", "", "name of the envelope message (auto-detected when empty)")
+	jsonl := flags.Bool("jsonl", false, "print one JSON object per message instead of text")
+	output := flags.String("output", "", "file to write the decoded messages to (stdout when empty)")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	if *capture == "" {
+		logger.Error("missing -pcap capture file")
+		os.Exit(2)
+	}
+
+	mapping, err := utils.LoadMapping(*mappingFile)
+	if err != nil {
+		logger.Error("error loading mapping file", "error", err)
+		os.Exit(1)
+	}
+
+	registry, err := utils.LoadMessageRegistry(*protoDir, mapping.Matches)
+	if err != nil {
+		logger.Error("error loading deobfuscated protos", "error", err)
+		os.Exit(1)
+	}
+	if len(registry.Skipped) > 0 {
+		logger.Warn("some proto files don't compile, their messages won't be decoded", "files", len(registry.Skipped))
+	}
+
+	var envelope protoreflect.MessageDescriptor
+	if *envelopeName != "" {
+		var ok bool
+		if envelope, ok = registry.Find(*envelopeName); !ok {
+			logger.Error("envelope message not found", "name", *envelopeName)
+			os.Exit(1)
+		}
+	} else if envelope, err = registry.FindEnvelope(); err != nil {
+		logger.Error("error finding the envelope message", "error", err)
+		os.Exit(1)
+	}
+
+	file, err := os.Open(*capture)
+	if err != nil {
+		logger.Error("error opening capture", "error", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	reader, err := pcap.NewReader(file)
+	if err != nil {
+		logger.Error("error reading capture", "error", err)
+		os.Exit(1)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		outFile, err := os.Create(*output)
+		if err != nil {
+			logger.Error("error creating output file", "error", err)
+			os.Exit(1)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	assembler := pcap.NewAssembler()
+	decoder := utils.NewTrafficDecoder(registry, envelope)
+
+	for {
+		packet, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Error("error reading capture", "error", err)
+			os.Exit(1)
+		}
+
+		segment, ok := pcap.DecodeTCP(packet)
+		if !ok || (int(segment.SrcPort) != *port && int(segment.DstPort) != *port) {
+			continue
+		}
+
+		data := assembler.Add(segment)
+		if len(data) == 0 {
+			continue
+		}
+
+		direction := "server -> client"
+		if int(segment.DstPort) == *port {
+			direction = "client -> server"
+		}
+
+		messages, errs := decoder.Feed(segment.Flow(), data)
+		for _, err := range errs {
+			logger.Warn("error decoding frame", "flow", segment.Flow(), "error", err)
+		}
+		for _, msg := range messages {
+			if *jsonl {
+				if err := encoder.Encode(newDecodedRecord(segment, direction, msg)); err != nil {
+					logger.Error("error writing message", "error", err)
+					os.Exit(1)
+				}
+				continue
+			}
+			fmt.Fprintf(out, "%s  %s  %-8s %s %s\n",
+				segment.Timestamp.Format("15:04:05.000"), direction, msg.Kind, msg.Name, msg.Body)
+		}
+	}
+}
+
+// decodedRecord is a decoded message in the JSONL output
+type decodedRecord struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Direction string          `json:"direction"`
+	Flow      string          `json:"flow"`
+	Kind      string          `json:"kind"`
+	Uid       int64           `json:"uid"`
+	Type      string          `json:"type"`
+	Name      string          `json:"name"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Payload   []byte          `json:"payload"`
+}
+
+func newDecodedRecord(segment *pcap.Segment, direction string, msg utils.DecodedMessage) decodedRecord {
+	record := decodedRecord{
+		Timestamp: segment.Timestamp.UTC(),
+		Direction: direction,
+		Flow:      segment.Flow(),
+		Kind:      msg.Kind,
+		Uid:       msg.Uid,
+		Type:      msg.Type,
+		Name:      msg.Name,
+		Payload:   msg.Payload,
+	}
+	// Messages missing from the protos have no body
+	if msg.Body != "" {
+		record.Body = json.RawMessage(msg.Body)
+	}
+	return record
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// runDecodeMsg decodes a single payload with the deobfuscated protos, for one-off analysis
+func runDecodeMsg(args []string) {
+	flags := flag.NewFlagSet("decode-msg", flag.ExitOnError)
+	typeName := flags.String("type", "", "message name, obfuscated or deobfuscated")
+	id := flags.Int("id", 0, "protocol id of the message, from dump.cs, instead of -type")
+	hexPayload := flags.String("hex", "", "payload as hex")
+	base64Payload := flags.String("base64", "", "payload as base64")
+	protoDir := flags.String("protos", "protos/deobfuscated", "directory of the deobfuscated proto files")
+	mappingFile := flags.String("mapping", "reports/mapping.json", "mapping file used to generate the deobfuscated protos")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	if (*typeName == "") == (*id == 0) || (*hexPayload == "") == (*base64Payload == "") {
+		logger.Error("usage: deobfs decode-msg (-type <message> | -id <protocol id>) (-hex <bytes> | -base64 <bytes>)")
+		os.Exit(2)
+	}
+
+	var payload []byte
+	var err error
+	if *hexPayload != "" {
+		// Accept dumps like "08 01 10 02" or "08:01:10:02"
+		cleaned := strings.NewReplacer(" ", "", ":", "", "\n", "", "0x", "").Replace(*hexPayload)
+		payload, err = hex.DecodeString(cleaned)
+	} else {
+		payload, err = base64.StdEncoding.DecodeString(*base64Payload)
+	}
+	if err != nil {
+		logger.Error("invalid payload", "error", err)
+		os.Exit(2)
+	}
+
+	// The mapping is only needed to find messages by their obfuscated name
+	var matches []utils.MessageMatch
+	if mapping, err := utils.LoadMapping(*mappingFile); err == nil {
+		matches = mapping.Matches
+	}
+
+	registry, err := utils.LoadMessageRegistry(*protoDir, matches)
+	if err != nil {
+		logger.Error("error loading deobfuscated protos", "error", err)
+		os.Exit(1)
+	}
+
+	desc, ok := registry.Find(*typeName)
+	if *id != 0 {
+		desc, ok = registry.FindById(*id)
+	}
+	if !ok {
+		logger.Error("message not found", "type", *typeName, "id", *id, "skipped", len(registry.Skipped))
+		os.Exit(1)
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		logger.Error("error decoding payload", "type", desc.Name(), "error", err)
+		os.Exit(1)
+	}
+
+	body, err := protojson.MarshalOptions{Resolver: registry, Multiline: true}.Marshal(msg)
+	if err != nil {
+		logger.Error("error formatting message", "error", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(body))
+
+	if len(msg.GetUnknown()) > 0 {
+		logger.Warn("payload has fields unknown to the message", "bytes", len(msg.GetUnknown()))
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+	"github.com/ruinedyourlife/deobfs/utils"
+	"github.com/ruinedyourlife/deobfs/utils/mappings"
+)
+
+// runExplain prints the structure of an obfuscated message and how the
+// matchers score every original message against it, to understand why it
+// doesn't match
+func runExplain(args []string) {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	obfuscatedDir := flags.String("obfuscated", "protos/filtered", "directory of the filtered obfuscated proto files")
+	clearDir := flags.String("clear", "", "directory or archive of clear proto files (defaults to the embedded baseline)")
+	configFile := flags.String("config", "deobfs.json", "JSON file declaring the matcher pipeline, whose options are used")
+	mappingFile := flags.String("mapping", "reports/mapping.json", "mapping of the last run, telling which originals are taken (skipped when missing)")
+	count := flags.Int("n", 10, "number of candidates to show")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: deobfs explain [flags] <obfuscated message>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	// Flags can follow the name too
+	name := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	logger := utils.InitLogger(utils.LevelWarn)
+	ctx := context.Background()
+
+	settings, err := loadRunConfig(*configFile)
+	if err != nil {
+		logger.Error("error loading config", "error", err)
+		os.Exit(1)
+	}
+	var opts []mappings.Option
+	for _, stage := range settings.Pipeline {
+		if stage.Disabled {
+			continue
+		}
+		// The candidates are scored like the relaxed matcher does
+		if stage.Matcher != match.MatcherRelaxed {
+			stage.Threshold = 0
+		}
+		opts = append(opts, stage.Options()...)
+	}
+
+	obfuscated, err := utils.LoadAndParseProtos(ctx, *obfuscatedDir, nil, logger)
+	if err != nil {
+		logger.Error("error loading obfuscated protos", "error", err)
+		os.Exit(1)
+	}
+	var msg *utils.MessageType
+	for i := range obfuscated.MessageType {
+		if obfuscated.MessageType[i].Name == name {
+			msg = &obfuscated.MessageType[i]
+		}
+	}
+	if msg == nil {
+		fmt.Fprintf(os.Stderr, "no message %s in %s\n", name, *obfuscatedDir)
+		os.Exit(1)
+	}
+
+	var clearFS fs.FS
+	clearRoot := *clearDir
+	if *clearDir != "" {
+		clearFS, err = utils.OpenProtoSource(*clearDir)
+	} else {
+		clearFS, _, err = baselineClearProtos()
+		clearRoot = baselineClearDir
+	}
+	if err != nil {
+		logger.Error("error opening clear protos", "error", err)
+		os.Exit(1)
+	}
+	unobfuscated, err := utils.LoadAndParseProtosFS(ctx, clearFS, clearRoot, nil, logger)
+	if err != nil {
+		logger.Error("error loading unobfuscated protos", "error", err)
+		os.Exit(1)
+	}
+
+	// Originals matched definitively to other messages by the last run
+	taken := make(map[string]string)
+	var current *utils.MessageMatch
+	if mapping, err := utils.LoadMapping(*mappingFile); err == nil {
+		for i, match := range mapping.Matches {
+			if match.ObfuscatedMsg == name {
+				current = &mapping.Matches[i]
+			} else if len(match.Alternatives) == 0 {
+				taken[match.OriginalMsg] = match.ObfuscatedMsg
+			}
+		}
+	}
+
+	printExplanation(os.Stdout, msg, current, taken, mappings.ExplainMessage(msg, unobfuscated, opts...), *count)
+}
+
+func printExplanation(w io.Writer, msg *utils.MessageType, current *utils.MessageMatch, taken map[string]string, candidates []mappings.Candidate, count int) {
+	fmt.Fprintf(w, "%s (%s)\n", msg.Name, filepath.Base(msg.SourceFile))
+	printMessageStructure(w, msg, "  ")
+
+	switch {
+	case current == nil:
+		fmt.Fprintln(w, "\nNot matched by the last run")
+	case len(current.Alternatives) > 0:
+		fmt.Fprintf(w, "\nUncertain match of the last run by %s (%.2f%%): %s\n", current.Matcher, current.MatchPercent, formatMatchCandidates(*current))
+	default:
+		fmt.Fprintf(w, "\nMatched with %s by %s (%.2f%%) in the last run\n", current.OriginalMsg, current.Matcher, current.MatchPercent)
+	}
+
+	fmt.Fprintln(w, "\nCandidates:")
+	for i, candidate := range candidates[:min(count, len(candidates))] {
+		fmt.Fprintf(w, "%2d. %s (%s) %.2f%%\n", i+1, candidate.Message.Name, filepath.Base(candidate.Message.SourceFile), candidate.Confidence)
+
+		var components []string
+		for _, component := range candidate.Components {
+			components = append(components, fmt.Sprintf("%s %.2f", component.Check, component.Score))
+		}
+		if len(components) > 0 {
+			fmt.Fprintf(w, "    scores: %s\n", strings.Join(components, ", "))
+		}
+		if candidate.Enums > 0 {
+			fmt.Fprintf(w, "    enums: %d/%d matched\n", candidate.EnumsMatched, candidate.Enums)
+		}
+		if candidate.Perfect {
+			fmt.Fprintln(w, "    perfect structure match")
+		}
+		for _, mismatch := range candidate.Mismatches {
+			fmt.Fprintf(w, "    - %s\n", mismatch)
+		}
+		if obfuscated, ok := taken[candidate.Message.Name]; ok {
+			fmt.Fprintf(w, "    taken by %s in the last run\n", obfuscated)
+		}
+		if candidate.Rejection != "" {
+			fmt.Fprintf(w, "    rejected by the relaxed matcher: %s\n", candidate.Rejection)
+		}
+	}
+}
+
+// printMessageStructure prints the fields, oneofs, enums and nested messages of msg
+func printMessageStructure(w io.Writer, msg *utils.MessageType, indent string) {
+	for _, field := range msg.Field {
+		label := ""
+		if field.Label != "" {
+			label = field.Label + " "
+		}
+		oneof := ""
+		if field.OneOfIndex != nil && *field.OneOfIndex < len(msg.OneOfDecl) {
+			oneof = "  // oneof " + msg.OneOfDecl[*field.OneOfIndex].Name
+		}
+		fmt.Fprintf(w, "%s%s%s %s = %d;%s\n", indent, label, field.Type, field.Name, field.Number, oneof)
+	}
+	for _, enum := range msg.EnumType {
+		fmt.Fprintf(w, "%senum %s { %s }\n", indent, enum.Name, strings.Join(formatEnumValueNames(enum.Value), " "))
+	}
+	for i := range msg.NestedType {
+		fmt.Fprintf(w, "%smessage %s\n", indent, msg.NestedType[i].Name)
+		printMessageStructure(w, &msg.NestedType[i], indent+"  ")
+	}
+}
+
+func formatEnumValueNames(values []utils.EnumValue) []string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = fmt.Sprintf("%s=%d;", value.Name, value.Number)
+	}
+	return names
+}
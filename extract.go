@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runExtract dumps the client with Il2CppDumper and generates the proto files with protodec
+func runExtract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	profileName := flags.String("profile", "dofus", profileUsage)
+	configFile := flags.String("config", "deobfs.json", "JSON file declaring the profiles of other games")
+	gameDir := flags.String("game", "", "game installation directory (auto-detected when empty)")
+	dumper := flags.String("dumper", "Il2CppDumper", "path to the Il2CppDumper executable")
+	protodec := flags.String("protodec", "protodec", "path to the protodec executable")
+	dumpDir := flags.String("dump", "dump", "directory for the Il2CppDumper output")
+	output := flags.String("output", "protos/decompiled", "directory for the generated proto files")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	profile, err := loadProfile(*profileName, *configFile)
+	if err != nil {
+		logger.Error("error selecting profile", "error", err)
+		os.Exit(2)
+	}
+
+	var install *utils.Installation
+	if *gameDir != "" {
+		install, err = utils.InstallationAt(*gameDir)
+	} else {
+		install, err = utils.FindInstallation(profile)
+	}
+	if err != nil {
+		logger.Error("error locating the game installation, use -game to set it", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("found game installation", "profile", profile.Name, "dir", install.Dir)
+
+	for _, dir := range []string{*dumpDir, *output} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.Error("error creating directory", "dir", dir, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	timer := &utils.PhaseTimer{}
+
+	logger.Info("dumping the client with Il2CppDumper...")
+	done := timer.Start("il2cppdumper")
+	if err := runTool(*dumper, install.GameAssembly, install.Metadata, *dumpDir); err != nil {
+		logger.Error("error running Il2CppDumper", "error", err)
+		os.Exit(1)
+	}
+	done()
+
+	logger.Info("generating proto files with protodec...")
+	done = timer.Start("protodec")
+	if err := runTool(*protodec, filepath.Join(*dumpDir, "DummyDll"), *output); err != nil {
+		logger.Error("error running protodec", "error", err)
+		os.Exit(1)
+	}
+	done()
+
+	logger.Info("proto files generated", "dir", *output)
+	timer.Log(logger)
+}
+
+func runTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runExtractMsg writes a message and every message and enum it references to
+// a standalone proto file, a minimal schema to share
+func runExtractMsg(args []string) {
+	flags := flag.NewFlagSet("extract-msg", flag.ExitOnError)
+	protoDir := flags.String("protos", "protos/deobfuscated", "directory or .zip/.tar.gz archive of the proto files declaring the message")
+	output := flags.String("output", "", "proto file to write, stdout when empty")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	if flags.NArg() != 1 {
+		logger.Error("usage: deobfs extract-msg [-protos protos/deobfuscated] [-output file.proto] <message>")
+		os.Exit(2)
+	}
+
+	fsys, err := utils.OpenProtoSource(*protoDir)
+	if err != nil {
+		logger.Error("error opening protos", "error", err)
+		os.Exit(1)
+	}
+	files, skipped, err := utils.NewProtoRegistry(fsys)
+	if err != nil {
+		logger.Error("error loading protos", "error", err)
+		os.Exit(1)
+	}
+	if len(skipped) > 0 {
+		logger.Warn("some proto files can't be loaded, their messages can't be extracted", "files", len(skipped))
+	}
+
+	msg, err := utils.FindMessage(files, flags.Arg(0))
+	if err != nil {
+		logger.Error("error finding message", "error", err)
+		os.Exit(1)
+	}
+	content, err := utils.ExtractMessage(files, msg)
+	if err != nil {
+		logger.Error("error extracting message", "message", msg.FullName(), "error", err)
+		os.Exit(1)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(content)
+		return
+	}
+	if err := os.WriteFile(*output, content, 0644); err != nil {
+		logger.Error("error writing proto file", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("message extracted", "message", msg.FullName(), "file", *output)
+}
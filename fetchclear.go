@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runFetchClear downloads the clear reference protos
+func runFetchClear(args []string) {
+	flags := flag.NewFlagSet("fetch-clear", flag.ExitOnError)
+	url := flags.String("url", utils.DefaultClearProtosURL, "zip archive containing the clear proto files")
+	output := flags.String("output", "protos/clear", "directory to extract the clear proto files to")
+	refresh := flags.Bool("refresh", false, "download the archive again even if it is cached")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	count, err := utils.FetchClearProtos(*url, *output, *refresh, logger)
+	if err != nil {
+		logger.Error("error fetching clear protos", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("clear protos extracted, use -clear to match against them", "files", count, "dir", *output)
+}
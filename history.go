@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+const historyUsage = `usage: deobfs history [-workspace dir] <command>
+
+commands:
+  record -version <version> [-mapping file]   record a mapping file for a game version
+  versions                                    list the recorded versions
+  name [-version <version>] <message>         show the names of a message in every (or one) version
+  first-seen <message>                        show the first version a message was matched in
+  aliases [-format text|json|csv] [message]   show the obfuscated names of every (or one) message across versions
+`
+
+// runHistory queries and updates the historical mapping database
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	workspace := flags.String("workspace", ".deobfs", "workspace directory holding the history database")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, historyUsage) }
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	history, err := utils.OpenHistory(*workspace)
+	if err != nil {
+		logger.Error("error opening history", "error", err)
+		os.Exit(1)
+	}
+	defer history.Close()
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "record":
+		recordFlags := flag.NewFlagSet("record", flag.ExitOnError)
+		version := recordFlags.String("version", "", "game version the mapping belongs to")
+		mappingFile := recordFlags.String("mapping", "reports/mapping.json", "mapping file to record")
+		recordFlags.Parse(commandArgs)
+
+		if *version == "" {
+			logger.Error("missing -version")
+			os.Exit(2)
+		}
+		mapping, err := utils.LoadMapping(*mappingFile)
+		if err != nil {
+			logger.Error("error loading mapping file", "error", err)
+			os.Exit(1)
+		}
+		if err := history.Record(*version, mapping.Matches); err != nil {
+			logger.Error("error recording mapping", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("mapping recorded", "version", *version, "matches", len(mapping.Matches))
+
+	case "versions":
+		versions, err := history.Versions()
+		if err != nil {
+			logger.Error("error listing versions", "error", err)
+			os.Exit(1)
+		}
+		for _, version := range versions {
+			fmt.Println(version)
+		}
+
+	case "name":
+		nameFlags := flag.NewFlagSet("name", flag.ExitOnError)
+		version := nameFlags.String("version", "", "only show this game version")
+		nameFlags.Parse(commandArgs)
+
+		if nameFlags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		entries, err := history.Lookup(nameFlags.Arg(0), *version)
+		if err != nil {
+			logger.Error("error querying history", "error", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			logger.Warn("message not found in history", "name", nameFlags.Arg(0))
+			os.Exit(1)
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s\t%s -> %s\t%.2f%%\n", entry.Version, entry.ObfuscatedMsg, entry.OriginalMsg, entry.Confidence)
+		}
+
+	case "first-seen":
+		if len(commandArgs) != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		entry, err := history.FirstSeen(commandArgs[0])
+		if err != nil {
+			logger.Error("error querying history", "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s first seen in %s (recorded %s) as %s -> %s\n",
+			commandArgs[0], entry.Version, entry.RecordedAt.Format("2006-01-02"), entry.ObfuscatedMsg, entry.OriginalMsg)
+
+	case "aliases":
+		aliasFlags := flag.NewFlagSet("aliases", flag.ExitOnError)
+		format := aliasFlags.String("format", "text", "output format (text, json, csv)")
+		aliasFlags.Parse(commandArgs)
+
+		if aliasFlags.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		chains, err := history.AliasChains(aliasFlags.Arg(0))
+		if err != nil {
+			logger.Error("error querying history", "error", err)
+			os.Exit(1)
+		}
+		if len(chains) == 0 && aliasFlags.NArg() == 1 {
+			logger.Warn("message not found in history", "name", aliasFlags.Arg(0))
+			os.Exit(1)
+		}
+		if err := printAliasChains(chains, *format); err != nil {
+			logger.Error("error printing alias chains", "error", err)
+			os.Exit(2)
+		}
+
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+// printAliasChains writes the alias chains to stdout: a line per message for
+// text, an alias per row for csv
+func printAliasChains(chains []utils.AliasChain, format string) error {
+	switch format {
+	case "text":
+		for _, chain := range chains {
+			var aliases []string
+			for _, alias := range chain.Aliases {
+				versions := alias.FirstVersion
+				if alias.LastVersion != alias.FirstVersion {
+					versions += ".." + alias.LastVersion
+				}
+				aliases = append(aliases, fmt.Sprintf("%s (%s)", alias.Obfuscated, versions))
+			}
+			fmt.Printf("%s\t%s\n", chain.Original, strings.Join(aliases, " -> "))
+		}
+		return nil
+	case "json":
+		if chains == nil {
+			chains = []utils.AliasChain{}
+		}
+		data, err := json.MarshalIndent(chains, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"original", "obfuscated", "first_version", "last_version"})
+		for _, chain := range chains {
+			for _, alias := range chain.Aliases {
+				writer.Write([]string{chain.Original, alias.Obfuscated, alias.FirstVersion, alias.LastVersion})
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown format %q (text, json, csv)", format)
+}
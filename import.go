@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runImport normalizes the name maps of other community tools into a seed file
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "format of the input files (csv, tsv, json), guessed from the extension when empty")
+	output := flags.String("output", "seeds.json", "seed file to create or add the imported pairs to")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	if flags.NArg() == 0 {
+		logger.Error("usage: deobfs import [-format csv|tsv|json] [-output seeds.json] <mapping files...>")
+		os.Exit(2)
+	}
+
+	var existing []utils.Seed
+	if _, err := os.Stat(*output); err == nil {
+		if existing, err = utils.LoadSeeds(*output); err != nil {
+			logger.Error("error loading existing seed file", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	var imported []utils.Seed
+	for _, path := range flags.Args() {
+		seeds, err := utils.ImportCommunityMapping(path, *format)
+		if err != nil {
+			logger.Error("error importing mapping", "file", path, "error", err)
+			os.Exit(1)
+		}
+		logger.Info("imported mapping", "file", path, "pairs", len(seeds))
+		imported = append(imported, seeds...)
+	}
+
+	seeds := utils.MergeSeeds(existing, imported)
+	if err := utils.WriteSeeds(seeds, *output); err != nil {
+		logger.Error("error writing seed file", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("seed file written", "file", *output, "seeds", len(seeds))
+}
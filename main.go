@@ -1,48 +1,339 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/match"
 	"github.com/ruinedyourlife/deobfs/utils"
 	"github.com/ruinedyourlife/deobfs/utils/mappings"
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "show":
+			runShow(os.Args[2:])
+			return
+		case "extract":
+			runExtract(os.Args[2:])
+			return
+		case "fetch-clear":
+			runFetchClear(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "decode":
+			runDecode(os.Args[2:])
+			return
+		case "changelog":
+			runChangelog(os.Args[2:])
+			return
+		case "decode-msg":
+			runDecodeMsg(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "api":
+			runAPI(os.Args[2:])
+			return
+		case "reflect":
+			runReflect(os.Args[2:])
+			return
+		case "changed":
+			runChanged(os.Args[2:])
+			return
+		case "all":
+			runAll(os.Args[2:])
+			return
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "selftest":
+			runSelftest(os.Args[2:])
+			return
+		case "explain":
+			runExplain(os.Args[2:])
+			return
+		case "assemblies":
+			runAssemblies(os.Args[2:])
+			return
+		case "carry":
+			runCarry(os.Args[2:])
+			return
+		case "extract-msg":
+			runExtractMsg(os.Args[2:])
+			return
+		case "verify":
+			runVerify(os.Args[2:])
+			return
+		case "apply":
+			runApply(os.Args[2:])
+			return
+		case "review":
+			runReview(os.Args[2:])
+			return
+		case "batch":
+			runBatch(os.Args[2:])
+			return
+		}
+	}
+
+	runMatch(os.Args[1:])
+}
+
+// staleClearShare is the share of obfuscated messages resembling no clear
+// message from which the clear protos are reported as outdated
+const staleClearShare = 0.1
+
+// runMatch filters the protodec output, matches it against the clear protos,
+// writes the reports and the deobfuscated protos. It returns the timings of its phases.
+func runMatch(args []string) *utils.PhaseTimer {
+	flags := flag.NewFlagSet("deobfs", flag.ExitOnError)
+
 	// Add command line flags for log level
-	logLevel := flag.String("log", "info", "log level (debug, info, warn, error)")
-	flag.Parse()
-
-	// Convert string level to LogLevel
-	var level utils.LogLevel
-	switch *logLevel {
-	case "debug":
-		level = utils.LevelDebug
-	case "info":
-		level = utils.LevelInfo
-	case "warn":
-		level = utils.LevelWarn
-	case "error":
-		level = utils.LevelError
-	default:
-		level = utils.LevelInfo
+	logLevel := flags.String("log", "info", "log level (debug, info, warn, error), with module=level items for the filter, parse, match and report modules, like info,match=debug")
+	logFormat := flags.String("log-format", "pretty", "log output (pretty for terminals, json for log tooling)")
+	logFile := flags.String("log-file", "", "also write the logs down to debug level to this file, whatever -log")
+	configFile := flags.String("config", "deobfs.json", "JSON file declaring the matcher pipeline, the default one when missing, and the profiles of other games")
+	profileName := flags.String("profile", "dofus", profileUsage)
+	sourceDir := flags.String("source", "protos/decompiled", "directory, .zip/.tar.gz archive or archive URL of the protodec output")
+	sourceChecksum := flags.String("source-sha256", "", "expected sha256 of the -source archive")
+	clearDir := flags.String("clear", "", "directory or archive of clear proto files (defaults to the embedded baseline)")
+	format := flags.String("format", "text", "report format (text, sqlite, html)")
+	version := flags.String("version", "", "game version to record the mapping under in the history database")
+	dumpFile := flags.String("dump-cs", "dump/dump.cs", "dump.cs of Il2CppDumper holding the protocol ids, skipped when missing")
+	samplesFile := flags.String("samples", "", "JSONL of captured payloads (from decode -jsonl) used as match evidence")
+	var plugins []string
+	flags.Func("plugin", "external matcher executable, run after the built-in matchers (repeatable)", func(command string) error {
+		plugins = append(plugins, command)
+		return nil
+	})
+	var onlyMessages, skipMessages []string
+	flags.Func("only", "regular expression of the obfuscated messages to match, the others are left unmatched (repeatable)", func(pattern string) error {
+		onlyMessages = append(onlyMessages, pattern)
+		return nil
+	})
+	flags.Func("skip", "regular expression of the obfuscated messages not to match (repeatable)", func(pattern string) error {
+		skipMessages = append(skipMessages, pattern)
+		return nil
+	})
+	seedFile := flags.String("seed", "", "seed file forcing the names of some messages (see the import command)")
+	legacyFile := flags.String("legacy", "", "Dofus 2.x protocol description (JSON) to suggest names for unmatched messages")
+	var hooks []string
+	flags.Func("hook", "shell command run after a successful run, with the mapping and stats in DEOBFS_* variables (repeatable)", func(command string) error {
+		hooks = append(hooks, command)
+		return nil
+	})
+	cacheDir := flags.String("cache", ".deobfs-cache", "directory caching the parsed proto files between runs (empty to disable)")
+	incremental := flags.Bool("incremental", false, "carry the matches of the previous mapping.json forward, only matching the messages of changed files")
+	exactEnums := flags.Bool("exact-enums", false, "only match enums with the same values, not an enum whose values are all in the other")
+	fuzzyEnums := flags.Bool("fuzzy-enums", false, "also match enums with obfuscated value names, by their value numbers and the fields using them")
+	chunkSize := flags.Int("chunk", 0, "match the obfuscated messages this many at a time, the structure matchers reading the clear messages from an on-disk index (0 for all at once)")
+	cpuProfile := flags.String("cpuprofile", "", "write a CPU profile of the run to this file")
+	memProfile := flags.String("memprofile", "", "write a heap profile at the end of the run to this file")
+	validate := flags.Bool("validate", false, "compile the deobfuscated protos and check they still match the obfuscated ones")
+	inMemory := flags.Bool("in-memory", false, "keep the filtered protos in memory instead of writing protos/filtered")
+	purge := flags.Bool("purge", false, "remove the proto files of protos/filtered and protos/deobfuscated before writing them, leftovers of a previous game version being matched otherwise")
+	split := flags.Bool("split", false, "also write a mapping and deobfuscated protos per assembly, reports/mapping.<assembly>.json and protos/deobfuscated.<assembly>")
+	checkFiltered := flags.Bool("check-filtered", false, "compile the filtered protos and report the ones which don't, broken extractions weakening the matching")
+	showProgress := flags.Bool("progress", true, "draw a progress bar of the matchers when stderr is a terminal")
+	confirmBelow := flags.Float64("confirm-below", 0, "ask on the terminal about each accepted match under this confidence, recording the decisions to the -seed file (seeds.json by default)")
+	noColor := flags.Bool("no-color", false, "never color the terminal output, like with NO_COLOR set")
+	auditFile := flags.String("audit", "", "append every accepted, uncertain and rejected match of the run to this JSONL file, with its evidence")
+	signKey := flags.String("sign-key", "", "ed25519 private key (PEM) signing the checksum of the mapping files")
+	anonymizePaths := flags.Bool("anonymize-paths", false, "write the paths of the reports, mappings, manifest and audit log relative to the working directory or their corpus, to share them without the local layout")
+	ndjson := flags.Bool("events", false, "write the events of the run to stderr as NDJSON (stages, progress ticks, matches), instead of the progress bar")
+	flags.Parse(args)
+	manifest := newRunManifest(flags, time.Now())
+
+	levels, err := utils.ParseLogLevels(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logOutput, err := utils.ParseLogFormat(*logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *noColor {
+		color.NoColor = true
 	}
+	if *inMemory && *validate {
+		fmt.Fprintln(os.Stderr, "-validate compares with the filtered protos on disk, it can't be used with -in-memory")
+		os.Exit(2)
+	}
+	if *confirmBelow > 0 && !isatty.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintln(os.Stderr, "-confirm-below needs a terminal to ask on")
+		os.Exit(2)
+	}
+	logger := utils.InitLoggerLevels(levels, logOutput)
+	if *logFile != "" {
+		file, err := os.Create(*logFile)
+		if err != nil {
+			logger.Error("error creating log file", "error", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		logger = utils.TeeLogs(logger, file, logOutput)
+	}
+	filterLogger := utils.ModuleLogger(logger, "filter")
+	parseLogger := utils.ModuleLogger(logger, "parse")
+	matchLogger := utils.ModuleLogger(logger, "match")
+	reportLogger := utils.ModuleLogger(logger, "report")
+	descriptor.CacheDir = *cacheDir
+	timer := &utils.PhaseTimer{}
+	progress := &utils.MatchingProgress{}
 
-	logger := utils.InitLogger(level)
+	// Ctrl-C stops the run cleanly, without leaving half-written caches
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var events *utils.NDJSONEvents
+	if *ndjson {
+		events = utils.NewNDJSONEvents(os.Stderr)
+		ctx = utils.WithEventHandler(ctx, events.Handle)
+	}
+	var key ed25519.PrivateKey
+	if *signKey != "" {
+		if key, err = utils.LoadSigningKey(*signKey); err != nil {
+			logger.Error("error loading signing key", "error", err)
+			os.Exit(2)
+		}
+	}
+	var paths *utils.PathAnonymizer
+	if *anonymizePaths {
+		paths = utils.NewPathAnonymizer(*sourceDir, *clearDir)
+	}
+	if *auditFile != "" {
+		audit, err := utils.OpenAuditLog(*auditFile, paths)
+		if err != nil {
+			logger.Error("error opening audit log", "error", err)
+			os.Exit(1)
+		}
+		defer audit.Close()
+		ctx = utils.WithEventHandler(ctx, audit.Handle)
+	}
+
+	stopProfiling, err := utils.StartProfiling(*cpuProfile, *memProfile)
+	if err != nil {
+		logger.Error("error starting profiling", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := stopProfiling(); err != nil {
+			logger.Error("error writing profile", "error", err)
+		}
+	}()
+
+	settings, err := loadRunConfig(*configFile)
+	if err != nil {
+		logger.Error("error loading config", "error", err)
+		os.Exit(2)
+	}
+	profile, err := utils.ResolveProfile(*profileName, settings.Profiles)
+	if err != nil {
+		logger.Error("error selecting profile", "error", err)
+		os.Exit(2)
+	}
+	if *exactEnums {
+		for i := range settings.Pipeline {
+			settings.Pipeline[i].Exact = true
+		}
+	}
+	if *fuzzyEnums {
+		for i := range settings.Pipeline {
+			settings.Pipeline[i].Fuzzy = true
+		}
+	}
+
+	// Archives of the protodec output can be shared, download them once
+	if utils.IsURL(*sourceDir) {
+		archive, err := utils.FetchSource(*sourceDir, *sourceChecksum, filterLogger)
+		if err != nil {
+			logger.Error("error fetching source archive", "error", err)
+			os.Exit(1)
+		}
+		*sourceDir = archive
+	}
 
 	// Use protodec to generate all the proto files which you can put
 	// in the protos/decompiled directory
 	config := utils.Config{
-		SourceDir: "protos/decompiled",
-		OutputDir: "protos/filtered",
-		AssembliesOfInterest: []string{
-			"Ankama.Dofus.Protocol.Connection",
-			"Ankama.Dofus.Protocol.Game",
-		},
+		SourceDir:            *sourceDir,
+		OutputDir:            "protos/filtered",
+		AssembliesOfInterest: profile.AssembliesOfInterest,
+		ExcludedAssemblies:   settings.Filter.Exclude,
+		Logger:               filterLogger,
+		Stats:                &utils.FilterStats{},
+		Syntax:               settings.Filter.Syntax,
+		Purge:                *purge,
+		Dependencies:         settings.Filter.Dependencies,
+		Comments:             settings.Filter.Comments,
+	}
+	if len(settings.Filter.Assemblies) > 0 {
+		config.AssembliesOfInterest = settings.Filter.Assemblies
+	}
+	effective := *settings
+	effective.Filter.Assemblies = config.AssembliesOfInterest
+	manifest.Config = effective
+
+	done := timer.Start("filter")
+	// The filtered protos keep their directory name in the reports when they
+	// stay in memory, like the files of the mapping
+	var filtered fs.FS
+	if *inMemory {
+		filtered, err = utils.FilterProtoFilesFS(config)
+	} else {
+		err = utils.FilterProtoFiles(config)
+		filtered = os.DirFS(config.OutputDir)
 	}
+	// Files which couldn't be filtered fail the run once the others are processed
+	var filterFailures *utils.FilterFailures
+	if err == nil || errors.As(err, &filterFailures) {
+		config.Stats.Log(filterLogger)
+	}
+	if filterFailures != nil {
+		for _, failure := range filterFailures.Errors {
+			filterLogger.Error("error filtering proto file", "error", failure)
+		}
+	} else if err != nil {
+		filterLogger.Error("error filtering proto files", "error", err)
+		if *inMemory {
+			os.Exit(1)
+		}
+	}
+	done()
 
-	if err := utils.FilterProtoFiles(config); err != nil {
-		logger.Error("error filtering proto files", "error", err)
+	if *checkFiltered {
+		done = timer.Start("check")
+		failures, err := utils.CheckCompilesFS(ctx, filtered, config.OutputDir)
+		if err != nil {
+			filterLogger.Error("error compiling filtered protos", "error", err)
+			os.Exit(1)
+		}
+		if len(failures) > 0 {
+			filterLogger.Warn("some filtered protos don't compile, their messages may match poorly", "files", len(failures))
+		}
+		for _, failure := range failures {
+			filterLogger.Warn("filtered proto doesn't compile", "file", failure.File, "error", failure.Err)
+		}
+		done()
 	}
 
 	// Example: only process specific files
@@ -50,32 +341,489 @@ func main() {
 	// Or leave empty for all files
 	// filter := []string{}
 
-	logger.Info("loading and parsing proto files...")
+	parseLogger.Info("loading and parsing proto files...")
+	done = timer.Start("parse")
 
-	obfuscated, err := utils.LoadAndParseProtos("protos/filtered", filter, logger)
+	obfuscated, err := utils.LoadAndParseProtosFS(ctx, filtered, config.OutputDir, filter, parseLogger)
 	if err != nil {
 		logger.Error("error loading obfuscated protos", "error", err)
 		os.Exit(1)
 	}
 
-	unobfuscated, err := utils.LoadAndParseProtos("protos/clear", filter, logger)
+	if _, err := os.Stat(*dumpFile); err == nil {
+		ids, err := utils.ParseMessageIds(*dumpFile)
+		if err != nil {
+			logger.Error("error parsing protocol ids", "error", err)
+		} else {
+			logger.Info("loaded protocol ids", "ids", len(ids), "messages", utils.AssignMessageIds(obfuscated, ids))
+		}
+	}
+
+	var clearFS fs.FS
+	var clearRoot string
+	if *clearDir != "" {
+		if clearFS, err = utils.OpenProtoSource(*clearDir); err != nil {
+			logger.Error("error opening clear protos", "error", err)
+			os.Exit(1)
+		}
+		clearRoot = *clearDir
+	} else if profile.Name != "dofus" {
+		logger.Error("the embedded clear protos are for dofus, use -clear to set the ones of this profile", "profile", profile.Name)
+		os.Exit(2)
+	} else {
+		baseline, version, baselineErr := baselineClearProtos()
+		if baselineErr != nil {
+			logger.Error("error loading embedded clear protos", "error", baselineErr)
+			os.Exit(1)
+		}
+		logger.Info("using embedded clear protos baseline", "version", version)
+		manifest.Inputs["clear"] = utils.ManifestInput{Path: "embedded baseline " + version}
+		clearFS, clearRoot = baseline, baselineClearDir
+	}
+
+	unobfuscated, err := utils.LoadAndParseProtosFS(ctx, clearFS, clearRoot, filter, parseLogger)
+	if err == nil && len(unobfuscated.MessageType) == 0 {
+		err = errors.New("no message found")
+	}
 	if err != nil {
-		logger.Error("error loading unobfuscated protos", "error", err)
+		logger.Error("error loading unobfuscated protos", "error", utils.ClearProtosError(clearRoot, err))
 		os.Exit(1)
 	}
+	done()
+
+	// The inputs are hashed before the run overwrites any, like the previous
+	// mapping of -incremental
+	inputs := map[string]string{
+		"source":  *sourceDir,
+		"clear":   *clearDir,
+		"seed":    *seedFile,
+		"samples": *samplesFile,
+		"legacy":  *legacyFile,
+	}
+	for role, path := range map[string]string{"config": *configFile, "dump": *dumpFile} {
+		if _, err := os.Stat(path); err == nil {
+			inputs[role] = path
+		}
+	}
+	if *incremental {
+		inputs["previousMapping"] = "reports/mapping.json"
+	}
+	addInputs(manifest, inputs)
+	manifest.Obfuscated, manifest.Clear = obfuscated.Files, unobfuscated.Files
+	manifest.ClearHash = utils.CorpusHash(unobfuscated)
 
-	// 1. Find matches based on enum values
-	enumMatches := mappings.FindEnumBasedMatches(obfuscated, unobfuscated, logger)
+	// Seeded messages are known already, the matchers skip them
+	var seeds []utils.Seed
+	var seedMatches []utils.MessageMatch
+	matchObfuscated, matchUnobfuscated := obfuscated, unobfuscated
+	if *seedFile != "" {
+		seeds, err = utils.LoadSeeds(*seedFile)
+		if err != nil {
+			logger.Error("error loading seed file", "error", err)
+			os.Exit(1)
+		}
+		seedMatches = utils.ResolveSeeds(seeds, obfuscated, unobfuscated, matchLogger)
+		emitMatches(ctx, seedMatches, "forced by seed")
+		logger.Info("loaded seeds", "seeds", len(seeds), "matches", len(seedMatches))
 
-	// 2. Find matches based on strict message structures (1-1 match)
-	structureMatches := mappings.FindStrictStructureBasedMatches(obfuscated, unobfuscated, enumMatches, logger)
+		seededObfuscated, seededUnobfuscated := make(map[string]bool), make(map[string]bool)
+		for _, match := range seedMatches {
+			seededObfuscated[match.ObfuscatedMsg] = true
+			seededUnobfuscated[match.OriginalMsg] = true
+		}
+		matchObfuscated = utils.WithoutMessages(obfuscated, seededObfuscated)
+		matchUnobfuscated = utils.WithoutMessages(unobfuscated, seededUnobfuscated)
+	}
+
+	// Messages of unchanged files keep the match of the previous run
+	var carriedMatches []utils.MessageMatch
+	if *incremental {
+		carriedMatches = carryForwardMatches(matchObfuscated, obfuscated, unobfuscated, matchLogger)
+		emitMatches(ctx, carriedMatches, "carried from the previous mapping")
+
+		carriedObfuscated, carriedUnobfuscated := make(map[string]bool), make(map[string]bool)
+		for _, match := range carriedMatches {
+			carriedObfuscated[match.ObfuscatedMsg] = true
+			if len(match.Alternatives) == 0 {
+				carriedUnobfuscated[match.OriginalMsg] = true
+			}
+		}
+		matchObfuscated = utils.WithoutMessages(matchObfuscated, carriedObfuscated)
+		matchUnobfuscated = utils.WithoutMessages(matchUnobfuscated, carriedUnobfuscated)
+	}
+
+	// Only the messages of interest are matched, to focus the matchers on a
+	// part of the protocol
+	include := append(settings.Messages.Include, onlyMessages...)
+	exclude := append(settings.Messages.Exclude, skipMessages...)
+	if len(include) > 0 || len(exclude) > 0 {
+		selected, err := utils.SelectMessages(matchObfuscated, include, exclude, settings.Messages.References)
+		if err != nil {
+			logger.Error("error selecting messages", "error", err)
+			os.Exit(2)
+		}
+		matchLogger.Info("matching a selection of the messages", "selected", len(selected.MessageType), "left_out", len(matchObfuscated.MessageType)-len(selected.MessageType))
+		matchObfuscated = selected
+	}
+
+	var bar *utils.ProgressBar
+	stopTicks := func() {}
+	if events != nil {
+		stopTicks = events.WatchProgress(progress, time.Second)
+	} else if *showProgress && logOutput == utils.LogFormatPretty {
+		bar = utils.StartProgressBar(progress)
+	}
+	result, err := match.Match(ctx, matchObfuscated, matchUnobfuscated, match.Options{
+		Logger:     matchLogger,
+		Timer:      timer,
+		Progress:   progress,
+		Pipeline:   settings.Pipeline,
+		Rejections: utils.RejectedPairs(seeds),
+		ChunkSize:  *chunkSize,
+	})
+	bar.Stop()
+	stopTicks()
+	if err != nil {
+		logger.Error("matching stopped", "error", err)
+		os.Exit(1)
+	}
+	matchLogger.Info("match result",
+		"accepted", len(result.Accepted),
+		"ambiguities", len(result.Ambiguities),
+		"conflicts", len(result.Conflicts),
+		"unmatched_obfuscated", len(result.UnmatchedObfuscated),
+		"unmatched_clear", len(result.UnmatchedClear),
+	)
+	for _, conflict := range result.Conflicts {
+		matchLogger.Debug("original matched several times", "original", conflict.Original, "obfuscated", conflict.Obfuscated)
+	}
+
+	// Messages resembling nothing mean the clear protos are older than the client
+	if unrelated := mappings.FindUnrelatedMessages(matchObfuscated, unobfuscated, result.UnmatchedObfuscated); len(unrelated) > 0 {
+		share := float64(len(unrelated)) / float64(len(matchObfuscated.MessageType))
+		matchLogger.Debug("messages resembling no clear message", "messages", unrelated)
+		if share >= staleClearShare {
+			matchLogger.Warn("many messages resemble no clear message, the clear protos are probably outdated for this client build: get fresh ones with fetch-clear, run again with -clear and review the differences with changelog",
+				"unrelated", len(unrelated),
+				"share", fmt.Sprintf("%.1f%%", share*100),
+			)
+		}
+	}
+
+	enumMatches := result.ByMatcher(match.MatcherEnum)
+	// The envelope matches are placed by structure too
+	structureMatches := append(result.ByMatcher(match.MatcherEnvelope), result.ByMatcher(match.MatcherStrictStructure)...)
+	relaxedMatches := result.ByMatcher(match.MatcherRelaxed)
+	clearNameMatches := result.ByMatcher(match.MatcherClearName)
+	for _, carried := range carriedMatches {
+		switch carried.Matcher {
+		case match.MatcherClearName:
+			clearNameMatches = append(clearNameMatches, carried)
+		case match.MatcherEnum:
+			enumMatches = append(enumMatches, carried)
+		case match.MatcherEnvelope, match.MatcherStrictStructure:
+			structureMatches = append(structureMatches, carried)
+		default:
+			relaxedMatches = append(relaxedMatches, carried)
+		}
+	}
+
+	// Decisions on the low-confidence matches are kept as seeds for the next runs
+	if *confirmBelow > 0 {
+		overridesFile := *seedFile
+		if overridesFile == "" {
+			overridesFile = "seeds.json"
+		}
+		found := append(append(append([]utils.MessageMatch{}, enumMatches...), structureMatches...), relaxedMatches...)
+		decisions := confirmMatches(ctx, os.Stdin, os.Stdout, found, obfuscated, unobfuscated, *confirmBelow)
+		if len(decisions) > 0 {
+			existing, err := utils.LoadSeeds(overridesFile)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				logger.Error("error loading seed file", "error", err)
+				os.Exit(1)
+			}
+			if err := utils.WriteSeeds(utils.MergeSeeds(existing, decisions), overridesFile); err != nil {
+				logger.Error("error writing seed file", "error", err)
+				os.Exit(1)
+			}
+			logger.Info("recorded decisions", "file", overridesFile, "decisions", len(decisions))
+			seeds = utils.MergeSeeds(seeds, decisions)
+		}
+	}
+	enumMatches = utils.WithoutRejected(ctx, enumMatches, seeds, matchLogger)
+	structureMatches = utils.WithoutRejected(ctx, structureMatches, seeds, matchLogger)
+	relaxedMatches = utils.WithoutRejected(ctx, relaxedMatches, seeds, matchLogger)
+
+	allMatches := append(append(append([]utils.MessageMatch{}, enumMatches...), structureMatches...), relaxedMatches...)
+	allMatches = append(append(allMatches, seedMatches...), clearNameMatches...)
+
+	// 4. Let the external matchers propose pairs for what is left
+	var pluginMatches []utils.MessageMatch
+	done = timer.Start("plugins")
+	for _, plugin := range plugins {
+		matches, err := mappings.FindPluginMatches(plugin, obfuscated, unobfuscated, allMatches, matchLogger)
+		if err != nil {
+			logger.Error("matcher plugin failed", "plugin", plugin, "error", err)
+			continue
+		}
+		pluginMatches = append(pluginMatches, matches...)
+		emitMatches(ctx, matches, "proposed by plugin "+plugin)
+		allMatches = append(allMatches, matches...)
+	}
+	if len(plugins) > 0 {
+		done()
+	}
+	utils.SetMatchIds(allMatches, obfuscated)
+
+	// Check the matches against captured payloads
+	if *samplesFile != "" {
+		done := timer.Start("samples")
+		samples, err := utils.LoadSamples(*samplesFile)
+		if err != nil {
+			logger.Error("error loading captured samples", "error", err)
+			os.Exit(1)
+		}
+		resolved := utils.ValidateSamples(allMatches, samples, clearFS, clearRoot, matchLogger)
+		// The reports of the stages which made the resolved matches follow them
+		for _, report := range [][]utils.MessageMatch{enumMatches, structureMatches, relaxedMatches, seedMatches, clearNameMatches, pluginMatches} {
+			utils.UpdateResolved(report, resolved)
+		}
+		logger.Info("checked matches against captured samples", "samples", len(samples), "resolved", len(resolved))
+		done()
+	}
+
+	// Once the samples resolved what they could, every definitive match gets its fields
+	utils.SetFieldMappings(allMatches, obfuscated, unobfuscated)
+
+	// The obfuscation keeps the field numbers, aligned fields numbered otherwise hint at wrong matches
+	suspicious := mappings.FindFieldNumberMismatches(allMatches, obfuscated, unobfuscated)
+	for _, entry := range suspicious {
+		matchLogger.Debug("aligned fields disagree on their numbers", "obfuscated", entry.Match.ObfuscatedMsg,
+			"original", entry.Match.OriginalMsg, "matcher", entry.Match.Matcher, "fields", len(entry.Mismatches))
+	}
+	if len(suspicious) > 0 {
+		matchLogger.Warn("some matches have aligned fields with other numbers and are probably wrong, see reports/field_number_mismatches.txt",
+			"suspicious", len(suspicious))
+	}
 
 	// Generate reports
-	if err := utils.GenerateMatchReport(enumMatches, "reports/enum_matches.txt"); err != nil {
-		logger.Error("failed to generate enum matches report", "error", err)
+	done = timer.Start("report")
+	if err := os.MkdirAll("reports", 0755); err != nil {
+		logger.Error("error creating the reports directory", "error", utils.ReportsDirError("reports", err))
+		os.Exit(1)
+	}
+	if len(suspicious) > 0 {
+		if err := utils.GenerateFieldNumberReport(suspicious, "reports/field_number_mismatches.txt"); err != nil {
+			logger.Error("failed to generate field number report", "error", err)
+		}
+	}
+	switch *format {
+	case "sqlite":
+		if err := utils.GenerateSQLiteReport(paths.Matches(allMatches), obfuscated, unobfuscated, "reports/mappings.db"); err != nil {
+			logger.Error("failed to generate sqlite report", "error", err)
+		}
+	case "html":
+		if err := utils.GenerateHTMLReport(paths.Matches(allMatches), obfuscated, unobfuscated, "reports/matches.html"); err != nil {
+			logger.Error("failed to generate html report", "error", err)
+		}
+	default:
+		if err := utils.GenerateMatchReport(ctx, enumMatches, "reports/enum_matches.txt"); err != nil {
+			logger.Error("failed to generate enum matches report", "error", err)
+		}
+
+		if err := utils.GenerateMatchReport(ctx, structureMatches, "reports/structure_matches.txt"); err != nil {
+			logger.Error("failed to generate structure matches report", "error", err)
+		}
+
+		if err := utils.GenerateMatchReport(ctx, relaxedMatches, "reports/relaxed_matches.txt"); err != nil {
+			logger.Error("failed to generate relaxed matches report", "error", err)
+		}
+
+		if len(seedMatches) > 0 {
+			if err := utils.GenerateMatchReport(ctx, seedMatches, "reports/seed_matches.txt"); err != nil {
+				logger.Error("failed to generate seed matches report", "error", err)
+			}
+		}
+
+		if len(clearNameMatches) > 0 {
+			if err := utils.GenerateMatchReport(ctx, clearNameMatches, "reports/clear_name_matches.txt"); err != nil {
+				logger.Error("failed to generate clear name matches report", "error", err)
+			}
+		}
+
+		if len(plugins) > 0 {
+			if err := utils.GenerateMatchReport(ctx, pluginMatches, "reports/plugin_matches.txt"); err != nil {
+				logger.Error("failed to generate plugin matches report", "error", err)
+			}
+		}
+	}
+
+	if *legacyFile != "" {
+		legacy, err := utils.LoadLegacyProtocol(*legacyFile)
+		if err != nil {
+			logger.Error("error loading Dofus 2.x protocol", "error", err)
+		} else {
+			hints := mappings.FindLegacyHints(obfuscated, legacy, allMatches, matchLogger)
+			if err := utils.GenerateLegacyHintsReport(hints, "reports/legacy_hints.txt"); err != nil {
+				logger.Error("failed to generate legacy hints report", "error", err)
+			}
+		}
+	}
+
+	// The mapping -incremental reads keeps the local paths, the ones of its
+	// hashes being looked up in the corpus of the next run
+	mapping := utils.NewMapping(allMatches, obfuscated, unobfuscated)
+	if err := utils.WriteSignedMapping(mapping, "reports/mapping.json", key); err != nil {
+		logger.Error("failed to write mapping file", "error", err)
+	}
+	if paths != nil {
+		if err := utils.WriteSignedMapping(paths.Mapping(mapping), "reports/mapping.anonymized.json", key); err != nil {
+			logger.Error("failed to write anonymized mapping file", "error", err)
+		}
+	}
+
+	if *version != "" {
+		history, err := utils.OpenHistory(".deobfs")
+		if err != nil {
+			logger.Error("failed to open history", "error", err)
+		} else {
+			if err := history.Record(*version, allMatches); err != nil {
+				logger.Error("failed to record mapping in history", "error", err)
+			}
+			history.Close()
+		}
+	}
+
+	done()
+
+	// Write the deobfuscated protos
+	done = timer.Start("apply")
+	if *purge {
+		purged, err := utils.PurgeProtos("protos/deobfuscated")
+		if err != nil {
+			logger.Error("failed to purge deobfuscated protos", "error", err)
+			os.Exit(1)
+		}
+		if purged > 0 {
+			reportLogger.Info("purged the proto files of a previous run", "dir", "protos/deobfuscated", "files", purged)
+		}
+	}
+	if err := utils.ApplyMatchesFS(ctx, allMatches, filtered, "protos/deobfuscated"); err != nil {
+		logger.Error("failed to apply matches", "error", err)
+		os.Exit(1)
+	}
+	if *split {
+		if err := writeSplitOutputs(ctx, allMatches, filtered, config.OutputDir, obfuscated, unobfuscated, *purge, paths, key, reportLogger); err != nil {
+			logger.Error("failed to write the outputs of each assembly", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *validate {
+		problems, err := utils.ValidateRoundTrip(config.OutputDir, "protos/deobfuscated", allMatches, reportLogger)
+		if err != nil {
+			logger.Error("failed to validate deobfuscated protos", "error", err)
+			os.Exit(1)
+		}
+		for _, problem := range problems {
+			logger.Error("round-trip validation", "problem", problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		logger.Info("round-trip validation passed")
+	}
+
+	done()
+
+	// Lets the changed command tell whether the next dump needs a new run
+	if err := utils.SaveFingerprint(".deobfs", utils.FingerprintCorpus(obfuscated)); err != nil {
+		logger.Error("failed to record corpus fingerprint", "error", err)
+	}
+
+	progress.LogPhases(logger)
+	timer.Log(logger)
+
+	manifest.FinishedAt = time.Now().UTC()
+	manifest.SetTimings(timer)
+	if err := utils.WriteManifest(paths.Manifest(manifest), "reports/manifest.json"); err != nil {
+		logger.Error("failed to write run manifest", "error", err)
+	}
+
+	if filterFailures != nil {
+		logger.Error("run finished with filtering errors, the deobfuscated protos may miss messages", "files", len(filterFailures.Errors))
+		os.Exit(1)
+	}
+
+	if len(hooks) > 0 {
+		uncertain := 0
+		for _, match := range allMatches {
+			if len(match.Alternatives) > 0 {
+				uncertain++
+			}
+		}
+		env := map[string]string{
+			"DEOBFS_MAPPING":             "reports/mapping.json",
+			"DEOBFS_MANIFEST":            "reports/manifest.json",
+			"DEOBFS_OUTPUT_DIR":          "protos/deobfuscated",
+			"DEOBFS_VERSION":             *version,
+			"DEOBFS_OBFUSCATED_MESSAGES": fmt.Sprint(len(obfuscated.MessageType)),
+			"DEOBFS_MATCHES":             fmt.Sprint(len(allMatches)),
+			"DEOBFS_UNCERTAIN_MATCHES":   fmt.Sprint(uncertain),
+			"DEOBFS_SUSPICIOUS_MATCHES":  fmt.Sprint(len(suspicious)),
+			"DEOBFS_ENUM_MATCHES":        fmt.Sprint(len(enumMatches)),
+			"DEOBFS_STRUCTURE_MATCHES":   fmt.Sprint(len(structureMatches)),
+			"DEOBFS_RELAXED_MATCHES":     fmt.Sprint(len(relaxedMatches)),
+			"DEOBFS_SEED_MATCHES":        fmt.Sprint(len(seedMatches)),
+			"DEOBFS_CLEAR_NAME_MATCHES":  fmt.Sprint(len(clearNameMatches)),
+			"DEOBFS_PLUGIN_MATCHES":      fmt.Sprint(len(pluginMatches)),
+		}
+		if err := utils.RunHooks(hooks, env, logger); err != nil {
+			logger.Error("failed to run hooks", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	return timer
+}
+
+// carryForwardMatches returns the matches of the previous mapping.json for
+// the messages left to match whose files didn't change
+func carryForwardMatches(remaining, obfuscated, unobfuscated *utils.Descriptor, logger *slog.Logger) []utils.MessageMatch {
+	previous, err := utils.LoadMapping("reports/mapping.json")
+	if err != nil {
+		logger.Warn("no previous mapping, matching everything", "error", err)
+		return nil
 	}
+	if err := previous.Verify(); err != nil && !errors.Is(err, utils.ErrNoChecksum) {
+		logger.Warn("previous mapping can't be trusted, matching everything", "error", err)
+		return nil
+	}
+	carried, ok := utils.CarryForwardMatches(previous, obfuscated, unobfuscated)
+	if !ok {
+		logger.Info("previous mapping is from other clear protos, matching everything")
+		return nil
+	}
+
+	left := make(map[string]bool)
+	for _, msg := range remaining.MessageType {
+		left[msg.Name] = true
+	}
+	var matches []utils.MessageMatch
+	for _, match := range carried {
+		if left[match.ObfuscatedMsg] {
+			matches = append(matches, match)
+		}
+	}
+
+	logger.Info("carried matches forward", "carried", len(matches), "to_match", len(remaining.MessageType)-len(matches))
+	return matches
+}
 
-	if err := utils.GenerateMatchReport(structureMatches, "reports/structure_matches.txt"); err != nil {
-		logger.Error("failed to generate structure matches report", "error", err)
+// emitMatches sends the matches accepted outside of the matchers as events,
+// with why they were
+func emitMatches(ctx context.Context, matches []utils.MessageMatch, reason string) {
+	for _, match := range matches {
+		utils.EmitEvent(ctx, utils.Event{Kind: utils.EventMatchFound, Matcher: match.Matcher, Match: &match, Reason: reason})
 	}
 }
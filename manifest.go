@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// newRunManifest starts the manifest of a run with the command line and the
+// effective value of every flag. The repeatable flags only show in the
+// command line.
+func newRunManifest(flags *flag.FlagSet, started time.Time) *utils.RunManifest {
+	manifest := &utils.RunManifest{
+		Tool:      utils.ToolVersion(),
+		GoVersion: runtime.Version(),
+		Command:   os.Args,
+		Flags:     make(map[string]string),
+		Inputs:    make(map[string]utils.ManifestInput),
+		StartedAt: started.UTC(),
+	}
+	flags.VisitAll(func(f *flag.Flag) {
+		if value := f.Value.String(); value != "" {
+			manifest.Flags[f.Name] = value
+		}
+	})
+	return manifest
+}
+
+// addInputs hashes the inputs of a run given by path, by role. Empty paths
+// are inputs the run didn't have.
+func addInputs(manifest *utils.RunManifest, paths map[string]string) {
+	for role, path := range paths {
+		if path != "" {
+			manifest.Inputs[role] = utils.NewManifestInput(path)
+		}
+	}
+}
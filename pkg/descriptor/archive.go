@@ -0,0 +1,78 @@
+package descriptor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// IsArchive tells whether path is a proto archive supported by OpenSource
+func IsArchive(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".zip") || strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz")
+}
+
+// OpenSource opens a directory or a .zip/.tar.gz archive of proto files.
+// Archives are read in memory, which is much faster than unpacking thousands
+// of small files, especially on Windows.
+func OpenSource(path string) (fs.FS, error) {
+	if !IsArchive(path) {
+		return os.DirFS(path), nil
+	}
+
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	// Repack the tarball as an in-memory zip, which implements fs.FS
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		entry, err := writer.CreateHeader(&zip.FileHeader{Name: strings.TrimPrefix(header.Name, "./"), Method: zip.Store})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(entry, reader); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+}
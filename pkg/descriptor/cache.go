@@ -0,0 +1,94 @@
+package descriptor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CacheDir is where parsed files are cached between runs, keyed by
+// their content hash. Caching is disabled when empty.
+var CacheDir = ""
+
+// Bump when Parse changes its output, to drop the stale caches.
+// JSON is used rather than gob, which would lose the oneof indexes of 0.
+const descriptorCacheVersion = 6
+
+// descriptorCache holds the parsed files of one corpus
+type descriptorCache struct {
+	path    string
+	entries map[string]*Descriptor
+	// Entries of the current files, the only ones saved back
+	used    map[string]*Descriptor
+	changed bool
+}
+
+func contentHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:16])
+}
+
+// openDescriptorCache loads the cache of a corpus, returning nil when caching is disabled
+func openDescriptorCache(corpus string) *descriptorCache {
+	if CacheDir == "" {
+		return nil
+	}
+
+	key := sha256.Sum256([]byte(corpus))
+	cache := &descriptorCache{
+		path:    filepath.Join(CacheDir, fmt.Sprintf("v%d-%s.json", descriptorCacheVersion, hex.EncodeToString(key[:8]))),
+		entries: make(map[string]*Descriptor),
+		used:    make(map[string]*Descriptor),
+	}
+
+	// A missing or corrupted cache only means parsing everything again
+	if file, err := os.Open(cache.path); err == nil {
+		if err := json.NewDecoder(file).Decode(&cache.entries); err != nil {
+			cache.entries = make(map[string]*Descriptor)
+		}
+		file.Close()
+	}
+
+	return cache
+}
+
+func (c *descriptorCache) get(hash string) (*Descriptor, bool) {
+	desc, ok := c.entries[hash]
+	if ok {
+		c.used[hash] = desc
+	}
+	return desc, ok
+}
+
+func (c *descriptorCache) put(hash string, desc *Descriptor) {
+	c.used[hash] = desc
+	c.changed = true
+}
+
+// save writes the cache back when files were added or removed
+func (c *descriptorCache) save() error {
+	if !c.changed && len(c.used) == len(c.entries) {
+		return nil
+	}
+	if err := os.MkdirAll(CacheDir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(CacheDir, "cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(c.used); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,80 @@
+// Package descriptor loads proto files into the descriptor model the matchers
+// work on. It is the entry point for Go programs embedding the deobfuscator.
+package descriptor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+)
+
+// Load parses every proto file below dir, a directory or a .zip/.tar.gz
+// archive, into a single descriptor
+func Load(ctx context.Context, dir string, logger *slog.Logger) (*Descriptor, error) {
+	fsys, err := OpenSource(dir)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFS(ctx, fsys, dir, logger)
+}
+
+// LoadFS parses every proto file of fsys into a single descriptor. name
+// identifies the corpus in the logs and in the parse cache.
+func LoadFS(ctx context.Context, fsys fs.FS, name string, logger *slog.Logger) (*Descriptor, error) {
+	return LoadFiles(ctx, fsys, name, nil, orDiscard(logger))
+}
+
+// LoadSource parses the proto files of a directory or a .zip/.tar.gz archive
+func LoadSource(ctx context.Context, path string, logger *slog.Logger) (*Descriptor, error) {
+	return Load(ctx, path, logger)
+}
+
+// Filter copies the proto files of source declaring one of assemblies to
+// outDir, which Load can then read. The files which can't be copied don't
+// stop the others, their errors are returned as a *FilterFailures.
+func Filter(source fs.FS, outDir string, assemblies []string) error {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	return FilterFiles(FilterConfig{
+		SourceDir:            "source",
+		Source:               source,
+		OutputDir:            outDir,
+		AssembliesOfInterest: assemblies,
+	})
+}
+
+// WithoutMessages returns a copy of desc without the given top-level messages
+func WithoutMessages(desc *Descriptor, names map[string]bool) *Descriptor {
+	filtered := *desc
+	filtered.MessageType = nil
+	for _, msg := range desc.MessageType {
+		if !names[msg.Name] {
+			filtered.MessageType = append(filtered.MessageType, msg)
+		}
+	}
+	return &filtered
+}
+
+// CorpusHash hashes the content of every file of a corpus
+func CorpusHash(desc *Descriptor) string {
+	hash := sha256.New()
+	for _, path := range slices.Sorted(maps.Keys(desc.Files)) {
+		fmt.Fprintf(hash, "%s:%s\n", path, desc.Files[path])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return logger
+}
@@ -0,0 +1,67 @@
+package descriptor
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// DiscoveredAssembly is an assembly, package or namespace declared by proto
+// files of a protodec output, as the filter reads them
+type DiscoveredAssembly struct {
+	Name     string
+	Files    int
+	Messages int // Top-level messages of the files, 0 for the files failing to parse
+}
+
+// DiscoverAssemblies lists the assemblies, packages and namespaces declared
+// by the proto files of fsys, sorted by name. A file declaring several names
+// counts for each.
+func DiscoverAssemblies(fsys fs.FS) ([]DiscoveredAssembly, error) {
+	byName := make(map[string]*DiscoveredAssembly)
+	err := fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".proto" {
+			return nil
+		}
+
+		declared, err := declaredAssemblies(fsys, path)
+		if err != nil {
+			return err
+		}
+		messages := 0
+		if content, err := fs.ReadFile(fsys, path); err == nil {
+			if desc, err := Parse(string(content)); err == nil {
+				messages = len(desc.MessageType)
+			}
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range declared {
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			assembly, ok := byName[name]
+			if !ok {
+				assembly = &DiscoveredAssembly{Name: name}
+				byName[name] = assembly
+			}
+			assembly.Files++
+			assembly.Messages += messages
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	assemblies := make([]DiscoveredAssembly, 0, len(byName))
+	for _, assembly := range byName {
+		assemblies = append(assemblies, *assembly)
+	}
+	sort.Slice(assemblies, func(i, j int) bool { return assemblies[i].Name < assemblies[j].Name })
+	return assemblies, nil
+}
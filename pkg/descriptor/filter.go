@@ -0,0 +1,718 @@
+package descriptor
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FilterConfig holds the configuration for the proto file filtering
+type FilterConfig struct {
+	SourceDir string
+	// Source is read instead of SourceDir when set, SourceDir only naming it
+	// in the errors
+	Source    fs.FS
+	OutputDir string
+	// Regular expressions of the assemblies to keep, like
+	// `Ankama\.Dofus\.Protocol\..*`, and of the ones to leave out among them
+	AssembliesOfInterest []string
+	ExcludedAssemblies   []string
+	// Logger tells about the imports rewritten or removed, nothing is logged when nil
+	Logger *slog.Logger
+	// Stats is filled with the counts of the filtering when set
+	Stats *FilterStats
+	// Syntax tells what becomes of the syntax line of the files:
+	// SyntaxNormalize, the default, writes the syntax or edition declared
+	// first, proto3 when there is none, SyntaxPreserve keeps the lines as they
+	// are, and proto2 or proto3 replaces it
+	Syntax string
+	// Purge removes the proto files of OutputDir before writing the filtered
+	// ones, the files of a previous game version being matched otherwise
+	Purge bool
+	// Dependencies keeps the files the kept ones import, transitively, even
+	// from other assemblies, so no type reference dangles
+	Dependencies bool
+	// Comments keeps the comment lines, protodec writing hints there like
+	// token ids or original names, which the parser attaches to the messages
+	// and fields
+	Comments bool
+}
+
+const (
+	SyntaxNormalize = "normalize"
+	SyntaxPreserve  = "preserve"
+)
+
+// FilterFiles processes proto files according to the given configuration.
+// The source can be a directory or a .zip/.tar.gz archive, or any fs.FS.
+func FilterFiles(config FilterConfig) error {
+	return filterProtoFiles(config, dirOutput(config.OutputDir))
+}
+
+// FilterFS is FilterFiles keeping the filtered files in memory
+// instead of writing them to OutputDir, which is ignored. The filtered files
+// are returned with the *FilterFailures of the files which couldn't be
+// filtered.
+func FilterFS(config FilterConfig) (fs.FS, error) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	err := filterProtoFiles(config, zipOutput{writer})
+	var failures *FilterFailures
+	if err != nil && !errors.As(err, &failures) {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	filtered, zipErr := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if zipErr != nil {
+		return nil, zipErr
+	}
+	return filtered, err
+}
+
+// filterOutput is where the filtered files are written
+type filterOutput interface {
+	// create opens the file at path, relative with forward slashes
+	create(path string) (io.WriteCloser, error)
+	// saveRecord writes a JSON record of the filtering, none when empty
+	saveRecord(name string, record any, empty bool) error
+	// purge removes the files of previous filterings, returning their number
+	purge() (int, error)
+	// removeFlattened removes the files older filterings wrote at the root
+	// for the nested paths, before the hierarchy was kept, returning their
+	// number
+	removeFlattened(paths []string) (int, error)
+}
+
+type dirOutput string
+
+func (dir dirOutput) create(path string) (io.WriteCloser, error) {
+	destination := filepath.Join(string(dir), filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(destination)
+}
+
+func (dir dirOutput) saveRecord(name string, record any, empty bool) error {
+	return saveRecord(string(dir), name, record, empty)
+}
+
+func (dir dirOutput) purge() (int, error) {
+	return PurgeProtos(string(dir))
+}
+
+func (dir dirOutput) removeFlattened(paths []string) (int, error) {
+	written := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		written[p] = true
+	}
+	removed := 0
+	for _, p := range paths {
+		flat := path.Base(p)
+		if flat == p || written[flat] {
+			continue
+		}
+		err := os.Remove(filepath.Join(string(dir), flat))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// zipOutput writes the filtered files to an in-memory archive
+type zipOutput struct {
+	writer *zip.Writer
+}
+
+func (z zipOutput) create(path string) (io.WriteCloser, error) {
+	entry, err := z.writer.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	return nopWriteCloser{entry}, nil
+}
+
+func (z zipOutput) saveRecord(name string, record any, empty bool) error {
+	if empty {
+		return nil
+	}
+	entry, err := z.writer.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(entry).Encode(record)
+}
+
+func (zipOutput) purge() (int, error) {
+	return 0, nil
+}
+
+func (zipOutput) removeFlattened([]string) (int, error) {
+	return 0, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func filterProtoFiles(config FilterConfig, output filterOutput) error {
+	assemblies, err := newAssemblyFilter(config.AssembliesOfInterest, config.ExcludedAssemblies)
+	if err != nil {
+		return err
+	}
+	if err := ValidateSyntax(config.Syntax); err != nil {
+		return err
+	}
+
+	fsys := config.Source
+	if fsys == nil {
+		// Check if source exists
+		if _, err := os.Stat(config.SourceDir); os.IsNotExist(err) {
+			return WithHint(fmt.Errorf("source directory %s does not exist", config.SourceDir), hintSource)
+		}
+
+		if fsys, err = OpenSource(config.SourceDir); err != nil {
+			return fmt.Errorf("error opening source: %v", err)
+		}
+	}
+
+	// Check if source is empty
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("error reading source directory: %v", err)
+	}
+	if len(entries) == 0 {
+		return WithHint(fmt.Errorf("source directory %s is empty", config.SourceDir), hintSource)
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	stats := config.Stats
+	if stats == nil {
+		stats = &FilterStats{}
+	}
+	*stats = FilterStats{ByAssembly: make([]AssemblyStats, len(config.AssembliesOfInterest))}
+	for i, pattern := range config.AssembliesOfInterest {
+		stats.ByAssembly[i].Pattern = pattern
+	}
+
+	// A file which can't be filtered doesn't stop the others, its error is reported at the end
+	failures := &FilterFailures{}
+	var included, scanned []string
+	// Assembly of each source file, the one it's kept for
+	declared := make(FileAssemblies)
+	err = fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			failures.add(path, err)
+			return nil
+		}
+
+		// Process only .proto files
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".proto" {
+			stats.Scanned++
+			scanned = append(scanned, path)
+			patterns, assembly, excluded, err := classifyFile(fsys, path, assemblies)
+			if err != nil {
+				failures.add(path, err)
+				return nil
+			}
+			declared[path] = assembly
+			stats.count(path, patterns, excluded)
+			if len(patterns) > 0 {
+				included = append(included, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if config.Dependencies {
+		dependencies := importClosure(fsys, scanned, included, logger, failures)
+		stats.Dependencies = len(dependencies)
+		if len(dependencies) > 0 {
+			logger.Info("files kept as imports of the filtered ones", "files", len(dependencies))
+		}
+		included = append(included, dependencies...)
+	}
+	fileAssemblies := make(FileAssemblies, len(included))
+	for _, path := range included {
+		fileAssemblies[path] = declared[path]
+	}
+
+	// Only once the source is read, a broken source leaves the previous files
+	if config.Purge {
+		purged, err := output.purge()
+		if err != nil {
+			return fmt.Errorf("purging %s: %w", config.OutputDir, err)
+		}
+		if purged > 0 {
+			logger.Info("purged the proto files of a previous filtering", "dir", config.OutputDir, "files", purged)
+		}
+	}
+
+	// Byte-identical files are filtered once, the others recorded as its aliases
+	included, aliases := dedupeFiles(fsys, included, failures)
+	stats.Kept, stats.Duplicates = len(included), len(aliases)
+	for _, alias := range aliases.Names() {
+		logger.Debug("duplicate proto file left out", "file", alias, "duplicate_of", aliases[alias])
+	}
+	if len(aliases) > 0 {
+		logger.Info("duplicate proto files filtered once", "duplicates", len(aliases))
+	}
+	// The flat copies an older filtering left would be loaded along the
+	// nested files, every message of them twice
+	flattened, err := output.removeFlattened(append(aliases.Names(), included...))
+	if err != nil {
+		return fmt.Errorf("removing the flat proto files of %s: %w", config.OutputDir, err)
+	}
+	if flattened > 0 {
+		logger.Info("removed the flat proto files of a previous filtering, now nested", "dir", config.OutputDir, "files", flattened)
+	}
+	if err := output.saveRecord(aliasesFile, aliases, len(aliases) == 0); err != nil {
+		failures.add(aliasesFile, err)
+	}
+	if err := output.saveRecord(assembliesFile, fileAssemblies, len(fileAssemblies) == 0); err != nil {
+		failures.add(assembliesFile, err)
+	}
+
+	// The imports are known once every file is filtered
+	imports := newImportResolver(included, aliases, logger)
+	for _, path := range included {
+		// The hierarchy of the source is kept, files of different
+		// directories can have the same name
+		destination, err := output.create(path)
+		if err != nil {
+			failures.add(path, err)
+			continue
+		}
+		err = copyFile(fsys, path, destination, imports, config)
+		if closeErr := destination.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			failures.add(path, fmt.Errorf("copying: %w", err))
+		}
+	}
+	if imports.rewritten > 0 || imports.removed > 0 {
+		logger.Info("imports of the filtered protos fixed", "rewritten", imports.rewritten, "removed", imports.removed)
+	}
+
+	if len(failures.Errors) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// ValidateSyntax checks syntax is a value of FilterConfig.Syntax
+func ValidateSyntax(syntax string) error {
+	switch syntax {
+	case "", SyntaxNormalize, SyntaxPreserve, "proto2", "proto3":
+		return nil
+	}
+	return fmt.Errorf("invalid syntax %q, use %s, %s, proto2 or proto3", syntax, SyntaxNormalize, SyntaxPreserve)
+}
+
+// FilterFailures is returned by FilterFiles when some files couldn't be
+// filtered, every other file being written
+type FilterFailures struct {
+	Errors []error
+}
+
+func (f *FilterFailures) add(path string, err error) {
+	f.Errors = append(f.Errors, fmt.Errorf("%s: %w", path, err))
+}
+
+func (f *FilterFailures) Error() string {
+	if len(f.Errors) == 1 {
+		return "filtering " + f.Errors[0].Error()
+	}
+	return fmt.Sprintf("filtering %d files failed, first: %v", len(f.Errors), f.Errors[0])
+}
+
+func (f *FilterFailures) Unwrap() []error {
+	return f.Errors
+}
+
+// assemblyFilter holds the compiled patterns of the assemblies to keep and to leave out
+type assemblyFilter struct {
+	include, exclude []*regexp.Regexp
+}
+
+func newAssemblyFilter(include, exclude []string) (*assemblyFilter, error) {
+	var err error
+	filter := &assemblyFilter{}
+	if filter.include, err = compilePatterns("assembly", include); err != nil {
+		return nil, err
+	}
+	if filter.exclude, err = compilePatterns("assembly", exclude); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// match returns the indices of the patterns to keep matching text, nil when
+// a pattern to leave out matches it too, which excluded tells
+func (f *assemblyFilter) match(text string) (patterns []int, excluded bool) {
+	for i, re := range f.include {
+		if re.MatchString(text) {
+			patterns = append(patterns, i)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, false
+	}
+	if matchesAny(f.exclude, text) {
+		return nil, true
+	}
+	return patterns, false
+}
+
+// classifyFile returns the indices of the patterns to keep matching the
+// assemblies declared by a file, the file being kept when there are some, and
+// the first declared assembly they match, the first declared one when none
+// does. excluded tells a declared assembly was left out by an exclusion.
+func classifyFile(fsys fs.FS, path string, assemblies *assemblyFilter) (patterns []int, assembly string, excluded bool, err error) {
+	declared, err := declaredAssemblies(fsys, path)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if len(declared) > 0 {
+		assembly = declared[0]
+	}
+	seen := make(map[int]bool)
+	for _, name := range declared {
+		matched, left := assemblies.match(name)
+		excluded = excluded || left
+		if len(matched) > 0 && len(patterns) == 0 {
+			assembly = name
+		}
+		for _, i := range matched {
+			if !seen[i] {
+				seen[i] = true
+				patterns = append(patterns, i)
+			}
+		}
+	}
+	return patterns, assembly, excluded, nil
+}
+
+// declaredAssemblies returns what a proto file declares about where its
+// messages come from, before its first definition: the assembly of the
+// protodec header (// Dll : Name.dll), its package and its C# namespace. The
+// other comments and lines are never looked at, the names of other assemblies
+// can appear there.
+func declaredAssemblies(fsys fs.FS, path string) ([]string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var declared []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "// Dll :"):
+			declared = append(declared, strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(line, "// Dll :")), ".dll"))
+		case strings.HasPrefix(line, "package "):
+			declared = append(declared, strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(line, "package ")), ";"))
+		case strings.HasPrefix(line, "option csharp_namespace"):
+			declared = append(declared, quotedValue(line))
+		case strings.HasPrefix(line, "message "), strings.HasPrefix(line, "enum "), strings.HasPrefix(line, "service "):
+			return declared, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+	return declared, nil
+}
+
+// importClosure returns the files of source the included ones import,
+// directly or not, which aren't included. Imports are resolved among the
+// source files like the filtered ones, the unknown ones being left to the
+// import rewriting.
+func importClosure(fsys fs.FS, source, included []string, logger *slog.Logger, failures *FilterFailures) []string {
+	resolver := newImportResolver(source, nil, logger)
+	kept := make(map[string]bool, len(included))
+	for _, file := range included {
+		kept[file] = true
+	}
+
+	var dependencies []string
+	pending := append([]string(nil), included...)
+	for len(pending) > 0 {
+		file := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		imports, err := fileImports(fsys, file)
+		if err != nil {
+			failures.add(file, err)
+			continue
+		}
+		for _, imported := range imports {
+			target, ok := resolver.find(file, imported)
+			if !ok || kept[target] {
+				continue
+			}
+			logger.Debug("file kept as an import", "file", target, "imported_by", file)
+			kept[target] = true
+			dependencies = append(dependencies, target)
+			pending = append(pending, target)
+		}
+	}
+	sort.Strings(dependencies)
+	return dependencies
+}
+
+// fileImports returns the paths a proto file imports
+func fileImports(fsys fs.FS, path string) ([]string, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var imports []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "import ") {
+			imports = append(imports, quotedValue(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading: %w", err)
+	}
+	return imports, nil
+}
+
+// dedupeFiles returns the files without the ones byte-identical to a
+// previous one, and these duplicates as aliases of the one kept. Files which
+// can't be read are added to failures and left out.
+func dedupeFiles(fsys fs.FS, files []string, failures *FilterFailures) ([]string, FileAliases) {
+	var unique []string
+	aliases := make(FileAliases)
+	byHash := make(map[string]string)
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			failures.add(file, err)
+			continue
+		}
+		hash := contentHash(content)
+		if canonical, ok := byHash[hash]; ok {
+			aliases[file] = canonical
+			continue
+		}
+		byHash[hash] = file
+		unique = append(unique, file)
+	}
+	return unique, aliases
+}
+
+// importResolver points the imports of the filtered files to files of the
+// filtered set. Imports of files left out are removed, so the filtered
+// directory compiles on its own.
+type importResolver struct {
+	// Filtered files and aliases
+	files   map[string]bool
+	aliases FileAliases
+	// Filtered files and aliases by base name, for the imports not relative to the root
+	byName             map[string][]string
+	logger             *slog.Logger
+	rewritten, removed int
+}
+
+func newImportResolver(files []string, aliases FileAliases, logger *slog.Logger) *importResolver {
+	resolver := &importResolver{files: make(map[string]bool), aliases: aliases, byName: make(map[string][]string), logger: logger}
+	for _, file := range append(files, aliases.Names()...) {
+		resolver.files[file] = true
+		resolver.byName[path.Base(file)] = append(resolver.byName[path.Base(file)], file)
+	}
+	return resolver
+}
+
+// resolve returns the path file must import for imported, false when no
+// filtered file is imported. The imports of the well-known types are kept,
+// protoc provides them, and the imports of aliases point to the file kept.
+func (r *importResolver) resolve(file, imported string) (string, bool) {
+	if strings.HasPrefix(imported, "google/protobuf/") {
+		return imported, true
+	}
+
+	target, ok := r.find(file, imported)
+	if !ok {
+		r.removed++
+		r.logger.Debug("import outside the filtered protos removed", "file", file, "import", imported)
+		return "", false
+	}
+	if canonical, ok := r.aliases[target]; ok {
+		target = canonical
+	}
+	if target != imported {
+		r.rewritten++
+	}
+	return target, true
+}
+
+func (r *importResolver) find(file, imported string) (string, bool) {
+	if r.files[imported] {
+		return imported, true
+	}
+	if relative := path.Join(path.Dir(file), imported); r.files[relative] {
+		return relative, true
+	}
+	// A file of another directory only when it's the only one of this name
+	if candidates := r.byName[path.Base(imported)]; len(candidates) == 1 {
+		return candidates[0], true
+	}
+	return "", false
+}
+
+func copyFile(fsys fs.FS, source string, destination io.Writer, imports *importResolver, config FilterConfig) error {
+	srcFile, err := fsys.Open(source)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	writer := bufio.NewWriter(destination)
+	scanner := bufio.NewScanner(srcFile)
+
+	// The syntax line is written before the first content line, unless it's preserved
+	syntax := config.Syntax
+	syntaxWritten := syntax == SyntaxPreserve
+	declared := ""
+	// Imports of a file and of its aliases end up the same
+	imported := make(map[string]bool)
+	// Kept comment lines are written with the line they precede, the ones
+	// before the syntax line before it
+	var header, comments []string
+	writeComments := func(lines *[]string) error {
+		for _, comment := range *lines {
+			if _, err := writer.WriteString(comment + "\n"); err != nil {
+				return err
+			}
+		}
+		*lines = nil
+		return nil
+	}
+	flushComments := func() error {
+		return writeComments(&comments)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		// Skip comment lines, unless they are kept
+		if trimmed == "" || (strings.HasPrefix(trimmed, "//") && !config.Comments) {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "//") {
+			comments = append(comments, line)
+			continue
+		}
+
+		// Handle syntax line, or the edition replacing it
+		if strings.HasPrefix(trimmed, "syntax") || strings.HasPrefix(trimmed, "edition") {
+			if syntax == SyntaxPreserve {
+				if err := flushComments(); err != nil {
+					return err
+				}
+				if _, err := writer.WriteString(line + "\n"); err != nil {
+					return err
+				}
+			} else if declared == "" {
+				declared = trimmed
+				header, comments = comments, nil
+			}
+			continue
+		}
+
+		// If we haven't written the syntax line yet and this is the first content line,
+		// insert it first
+		if !syntaxWritten {
+			if err := writeComments(&header); err != nil {
+				return err
+			}
+			if _, err := writer.WriteString(syntaxLine(syntax, declared) + "\n\n"); err != nil {
+				return err
+			}
+			syntaxWritten = true
+		}
+		if err := flushComments(); err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(trimmed, "import ") {
+			name := quotedValue(line)
+			target, ok := imports.resolve(source, name)
+			if !ok || imported[target] {
+				continue
+			}
+			imported[target] = true
+			line = strings.Replace(line, `"`+name+`"`, `"`+target+`"`, 1)
+		}
+
+		// Write the current line with original indentation
+		_, err := writer.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flushComments(); err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+// syntaxLine returns the syntax line written first in a file, declared being
+// its syntax or edition line, empty when it has none
+func syntaxLine(syntax, declared string) string {
+	switch {
+	case syntax != SyntaxNormalize && syntax != "":
+		return fmt.Sprintf("syntax = %q;", syntax)
+	case strings.HasPrefix(declared, "edition"):
+		return fmt.Sprintf("edition = %q;", quotedValue(declared))
+	case declared != "" && quotedValue(declared) != "":
+		return fmt.Sprintf("syntax = %q;", quotedValue(declared))
+	}
+	// protodec writes proto3
+	return `syntax = "proto3";`
+}
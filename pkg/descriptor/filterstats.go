@@ -0,0 +1,71 @@
+package descriptor
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// FilterStats counts what FilterFiles did with the proto files of the source
+type FilterStats struct {
+	Scanned int
+	// Files written, the duplicates of a kept file being left out
+	Kept       int
+	Duplicates int
+	// Files kept only as imports of other kept files, counted in Kept
+	Dependencies int
+	// Files declaring no assembly to keep, and the ones left out by an exclusion
+	Skipped  int
+	Excluded int
+	// Files declaring each assembly to keep, in the order of the patterns
+	ByAssembly []AssemblyStats
+	// Files declaring assemblies of several patterns
+	Overlapping []OverlappingFile
+}
+
+// AssemblyStats is the number of files declaring an assembly matching Pattern
+type AssemblyStats struct {
+	Pattern string
+	Files   int
+}
+
+// OverlappingFile is a file matching several patterns of the assemblies to keep
+type OverlappingFile struct {
+	File     string
+	Patterns []string
+}
+
+func (s *FilterStats) count(path string, patterns []int, excluded bool) {
+	switch {
+	case len(patterns) == 0 && excluded:
+		s.Excluded++
+	case len(patterns) == 0:
+		s.Skipped++
+	}
+	for _, i := range patterns {
+		s.ByAssembly[i].Files++
+	}
+	if len(patterns) > 1 {
+		sort.Ints(patterns)
+		overlap := OverlappingFile{File: path}
+		for _, i := range patterns {
+			overlap.Patterns = append(overlap.Patterns, s.ByAssembly[i].Pattern)
+		}
+		s.Overlapping = append(s.Overlapping, overlap)
+	}
+}
+
+// Log logs the counts, the files of each assembly and the files matching
+// several, warning about the assemblies no file declares
+func (s *FilterStats) Log(logger *slog.Logger) {
+	logger.Info("filtered proto files", "scanned", s.Scanned, "kept", s.Kept, "duplicates", s.Duplicates, "dependencies", s.Dependencies, "skipped", s.Skipped, "excluded", s.Excluded)
+	for _, assembly := range s.ByAssembly {
+		if assembly.Files == 0 {
+			logger.Warn("no file declares this assembly, check the filter configuration", "pattern", assembly.Pattern)
+			continue
+		}
+		logger.Info("files of assembly", "pattern", assembly.Pattern, "files", assembly.Files)
+	}
+	for _, overlap := range s.Overlapping {
+		logger.Info("file matching several assemblies", "file", overlap.File, "patterns", overlap.Patterns)
+	}
+}
@@ -0,0 +1,120 @@
+package descriptor
+
+import "sort"
+
+// mergePackageFragments merges the top-level messages declared by several
+// files of the same package, or of the same assembly when they have none,
+// some extractions splitting one file into fragments each holding part of a
+// message. The first declaration gets the fields, oneofs, enums and nested
+// messages of the others, so the message compares as a whole. Messages
+// declaring neither are never merged, the names of the obfuscated ones
+// repeating across assemblies. It returns the messages left and how many
+// declarations were merged.
+func mergePackageFragments(messages []MessageType) ([]MessageType, int) {
+	merged := 0
+	first := make(map[[2]string]int)
+	kept := messages[:0]
+	for _, msg := range messages {
+		scope := msg.Package
+		if scope == "" {
+			scope = msg.Assembly
+		}
+		if scope == "" {
+			kept = append(kept, msg)
+			continue
+		}
+		key := [2]string{scope, msg.Name}
+		if i, ok := first[key]; ok && kept[i].SourceFile != msg.SourceFile {
+			mergeMessage(&kept[i], &msg)
+			merged++
+			continue
+		}
+		first[key] = len(kept)
+		kept = append(kept, msg)
+	}
+	return kept, merged
+}
+
+// mergeMessage adds to into what from declares and into doesn't: fields by
+// number, oneofs, enums and nested messages by name. The fields are sorted by
+// number, the order of a single declaration.
+func mergeMessage(into, from *MessageType) {
+	// The fields can be shared with the descriptor cache, they are sorted on a copy
+	into.Field = append([]Field(nil), into.Field...)
+
+	// Index of the oneofs of from in into
+	oneofs := make([]int, len(from.OneOfDecl))
+	for i, oneof := range from.OneOfDecl {
+		oneofs[i] = len(into.OneOfDecl)
+		for j, existing := range into.OneOfDecl {
+			if existing.Name == oneof.Name {
+				oneofs[i] = j
+				break
+			}
+		}
+		if oneofs[i] == len(into.OneOfDecl) {
+			into.OneOfDecl = append(into.OneOfDecl, oneof)
+		}
+	}
+
+	numbers := make(map[int]bool, len(into.Field))
+	for _, field := range into.Field {
+		numbers[field.Number] = true
+	}
+	for _, field := range from.Field {
+		if numbers[field.Number] {
+			continue
+		}
+		if field.OneOfIndex != nil && *field.OneOfIndex < len(oneofs) {
+			index := oneofs[*field.OneOfIndex]
+			field.OneOfIndex = &index
+		}
+		into.Field = append(into.Field, field)
+	}
+	sort.SliceStable(into.Field, func(i, j int) bool { return into.Field[i].Number < into.Field[j].Number })
+
+	for _, enum := range from.EnumType {
+		if existing := findEnum(into.EnumType, enum.Name); existing != nil {
+			mergeEnum(existing, &enum)
+		} else {
+			into.EnumType = append(into.EnumType, enum)
+		}
+	}
+
+	for i := range from.NestedType {
+		nested := &from.NestedType[i]
+		found := false
+		for j := range into.NestedType {
+			if into.NestedType[j].Name == nested.Name {
+				mergeMessage(&into.NestedType[j], nested)
+				found = true
+				break
+			}
+		}
+		if !found {
+			into.NestedType = append(into.NestedType, *nested)
+		}
+	}
+}
+
+func findEnum(enums []EnumType, name string) *EnumType {
+	for i := range enums {
+		if enums[i].Name == name {
+			return &enums[i]
+		}
+	}
+	return nil
+}
+
+// mergeEnum adds to into the values of from it doesn't number
+func mergeEnum(into, from *EnumType) {
+	numbers := make(map[int]bool, len(into.Value))
+	for _, value := range into.Value {
+		numbers[value.Number] = true
+	}
+	for _, value := range from.Value {
+		if !numbers[value.Number] {
+			into.Value = append(into.Value, value)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package descriptor
+
+import "fmt"
+
+// HintError is a failure users commonly hit, with the next step to get past it
+type HintError struct {
+	Err  error
+	Hint string
+}
+
+func (e *HintError) Error() string {
+	return fmt.Sprintf("%v (hint: %s)", e.Err, e.Hint)
+}
+
+func (e *HintError) Unwrap() error {
+	return e.Err
+}
+
+const hintSource = "run `deobfs extract` to dump the game and generate the proto files with protodec, or set -source to the protodec output"
+
+// WithHint wraps err with hint, the next step to get past it, nil staying nil
+func WithHint(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	return &HintError{Err: err, Hint: hint}
+}
@@ -1,8 +1,10 @@
-package utils
+package descriptor
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -10,25 +12,9 @@ import (
 	"log/slog"
 
 	"github.com/fatih/color"
+	"github.com/ruinedyourlife/deobfs/pkg/event"
 )
 
-type EnumMatch struct {
-	ObfuscatedEnum string   // Full path like "iqe.ipz"
-	OriginalEnum   string   // Full path like "ExchangeCraftResultEvent.CraftResult"
-	Values         []string // For logging/debugging
-	Confidence     float64  // Store the confidence score
-}
-
-type MessageMatch struct {
-	ObfuscatedMsg  string
-	ObfuscatedFile string
-	OriginalMsg    string
-	OriginalFile   string
-	MatchPercent   float64
-	EnumMatches    []EnumMatch
-	Alternatives   []string
-}
-
 type EnumValue struct {
 	Name   string `json:"name"`
 	Number int    `json:"number"`
@@ -46,6 +32,8 @@ type Field struct {
 	Type       string `json:"type"`
 	TypeName   string `json:"typeName"`
 	OneOfIndex *int   `json:"oneofIndex"`
+	// Comment lines before the field and the comment ending its line
+	Comment string `json:"comment,omitempty"`
 }
 
 type OneOfDecl struct {
@@ -58,21 +46,49 @@ type MessageType struct {
 	NestedType []MessageType `json:"nestedType"`
 	EnumType   []EnumType    `json:"enumType"`
 	OneOfDecl  []OneOfDecl   `json:"oneofDecl"`
+	Id         int           `json:"id,omitempty"` // Protocol id from dump.cs, 0 when unknown
 	SourceFile string        `json:"-"`
+	Package    string        `json:"-"` // Package of the source file, set on the top-level messages
+	// Assembly the filtering recorded for the source file, or its
+	// csharp_namespace, set on the top-level messages
+	Assembly string `json:"-"`
+	// Comment lines before the message and the comment ending its line
+	Comment string `json:"comment,omitempty"`
 }
 
 type Descriptor struct {
-	Name        string        `json:"name"`
-	Package     string        `json:"package"`
-	Dependency  []string      `json:"dependency"`
-	MessageType []MessageType `json:"messageType"`
-	EnumType    []EnumType    `json:"enumType"`
-	Syntax      string        `json:"syntax"`
+	Name        string            `json:"name"`
+	Package     string            `json:"package"`
+	Namespace   string            `json:"namespace,omitempty"` // csharp_namespace option
+	Dependency  []string          `json:"dependency"`
+	MessageType []MessageType     `json:"messageType"`
+	EnumType    []EnumType        `json:"enumType"`
+	Syntax      string            `json:"syntax"`
+	Files       map[string]string `json:"-"` // Source file -> content hash
+	// Files left out because they failed to parse, and the ones without messages
+	Failures []ParseFailure `json:"-"`
 }
 
-func LoadAndParseProtos(dir string, filter []string, logger *slog.Logger) (*Descriptor, error) {
-	var desc Descriptor
+// ParseFailure is a proto file which failed to parse or has no message, or
+// which doesn't compile
+type ParseFailure struct {
+	File string
+	Err  error
+}
+
+// LoadFiles parses the proto files of fsys named in filter, every one when
+// filter is empty, reporting their source files relative to name. It stops
+// when ctx is cancelled.
+func LoadFiles(ctx context.Context, fsys fs.FS, name string, filter []string, logger *slog.Logger) (*Descriptor, error) {
+	desc := Descriptor{Files: make(map[string]string)}
 	fileCount := 0
+	cache := openDescriptorCache(name)
+	// The filtered protos declare no package, their assembly tells the
+	// fragments of a message apart from messages of the same name
+	assemblies, err := LoadFileAssemblies(fsys)
+	if err != nil {
+		logger.Warn("failed to load the assemblies of the filtered files", "error", err)
+	}
 
 	// Create a map for faster lookup if we have filters
 	filterMap := make(map[string]bool)
@@ -80,38 +96,66 @@ func LoadAndParseProtos(dir string, filter []string, logger *slog.Logger) (*Desc
 		filterMap[f] = true
 	}
 
-	logger.Info(fmt.Sprintf("loading proto files from %s", color.BlueString(dir)))
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	logger.Info(fmt.Sprintf("loading proto files from %s", color.BlueString(name)))
+	err = fs.WalkDir(fsys, ".", func(p string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".proto") {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".proto") {
 			// Skip if we have filters and this file isn't in the list
 			if len(filterMap) > 0 {
-				if !filterMap[info.Name()] {
+				if !filterMap[entry.Name()] {
 					return nil
 				}
 			}
 
-			content, err := os.ReadFile(path)
+			content, err := fs.ReadFile(fsys, p)
 			if err != nil {
 				return err
 			}
+			path := filepath.Join(name, filepath.FromSlash(p))
 
-			fileDesc, err := ParseProtoFile(string(content))
-			if err != nil {
-				return fmt.Errorf("parsing %s: %w", path, err)
+			hash := contentHash(content)
+			desc.Files[path] = hash
+
+			// Unchanged files are reused from the cache of the previous run
+			var fileDesc *Descriptor
+			if cache != nil {
+				fileDesc, _ = cache.get(hash)
+			}
+			if fileDesc == nil {
+				if fileDesc, err = Parse(string(content)); err != nil {
+					// The other files are still parsed, the failures are listed at the end
+					desc.Failures = append(desc.Failures, ParseFailure{path, err})
+					return nil
+				}
+				if cache != nil {
+					cache.put(hash, fileDesc)
+				}
+			}
+			if len(fileDesc.MessageType) == 0 {
+				desc.Failures = append(desc.Failures, ParseFailure{path, errNoMessage})
 			}
 
 			// Set source file for all messages in this file
 			for i := range fileDesc.MessageType {
 				fileDesc.MessageType[i].SourceFile = path
+				fileDesc.MessageType[i].Package = fileDesc.Package
+				fileDesc.MessageType[i].Assembly = fileDesc.Namespace
+				if assembly := assemblies[p]; assembly != "" {
+					fileDesc.MessageType[i].Assembly = assembly
+				}
 			}
 
 			// debugPrintDescriptor(fileDesc)
 			desc.MessageType = append(desc.MessageType, fileDesc.MessageType...)
+			desc.EnumType = append(desc.EnumType, fileDesc.EnumType...)
 			fileCount++
+			event.Emit(ctx, event.Event{Kind: event.FileParsed, File: path, Messages: len(fileDesc.MessageType)})
 		}
 		return nil
 	})
@@ -120,27 +164,103 @@ func LoadAndParseProtos(dir string, filter []string, logger *slog.Logger) (*Desc
 		return nil, err
 	}
 
+	if cache != nil {
+		if err := cache.save(); err != nil {
+			logger.Warn("failed to save descriptor cache", "error", err)
+		}
+	}
+
+	var merged int
+	if desc.MessageType, merged = mergePackageFragments(desc.MessageType); merged > 0 {
+		logger.Info("merged messages split across files of the same package or assembly", "fragments", merged)
+	}
+
 	logger.Info(fmt.Sprintf("parsed %s files & %s messages",
 		color.GreenString(strconv.Itoa(fileCount)),
 		color.GreenString(strconv.Itoa(countTotalMessages(desc.MessageType))),
 	))
+	logParseFailures(logger, name, desc.Failures)
 	return &desc, nil
 }
 
-func ParseProtoFile(content string) (*Descriptor, error) {
+var errNoMessage = errors.New("no message")
+
+// logParseFailures rounds up the files of a corpus which failed to parse or
+// have no message, with their first bad line
+func logParseFailures(logger *slog.Logger, name string, failures []ParseFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	failed := 0
+	for _, failure := range failures {
+		if failure.Err != errNoMessage {
+			failed++
+		}
+	}
+	logger.Warn(fmt.Sprintf("some files of %s are left out or empty", name), "failed_to_parse", failed, "without_messages", len(failures)-failed)
+	for _, failure := range failures {
+		attrs := []any{"file", failure.File, "error", failure.Err}
+		var parseErr *ParseError
+		if errors.As(failure.Err, &parseErr) {
+			attrs = []any{"file", failure.File, "error", parseErr.Reason, "line", parseErr.Line, "text", parseErr.Text}
+		}
+		logger.Warn("parse failure", attrs...)
+	}
+}
+
+// quotedValue returns the string between the first pair of double quotes of line
+func quotedValue(line string) string {
+	start := strings.Index(line, `"`)
+	end := strings.LastIndex(line, `"`)
+	if start < 0 || end <= start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// ParseError is the first line of a proto file Parse can't make sense of
+type ParseError struct {
+	Line   int // From 1
+	Text   string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Reason, e.Text)
+}
+
+// Parse parses the content of a single proto file
+func Parse(content string) (*Descriptor, error) {
 	var desc Descriptor
 	var currentMsg *MessageType
 	var currentEnum *EnumType
 	var currentOneofIndex *int
+	var oneofLevel int
 	var parentMsgs []*MessageType
 	var nestLevel int
 
+	lastLine := 0
+	var comments []string
 	lines := strings.Split(content, "\n")
 	for i := 0; i < len(lines); i++ {
 		line := strings.TrimSpace(lines[i])
-		if line == "" || strings.HasPrefix(line, "//") {
+		if line == "" {
+			comments = nil
+			continue
+		}
+		if strings.HasPrefix(line, "//") {
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(line, "//")))
 			continue
 		}
+		lastLine = i
+
+		// Comments go to the message or field declared on the line
+		line, trailing := splitTrailingComment(line)
+		if trailing != "" {
+			comments = append(comments, trailing)
+		}
+		comment := strings.Join(comments, "\n")
+		comments = nil
 
 		// Track opening braces
 		if strings.Contains(line, "{") {
@@ -152,7 +272,7 @@ func ParseProtoFile(content string) (*Descriptor, error) {
 			nestLevel--
 			if currentEnum != nil {
 				currentEnum = nil
-			} else if currentOneofIndex != nil && nestLevel == 1 {
+			} else if currentOneofIndex != nil && nestLevel == oneofLevel-1 {
 				currentOneofIndex = nil
 			} else if currentMsg != nil {
 				if len(parentMsgs) > 0 {
@@ -165,9 +285,27 @@ func ParseProtoFile(content string) (*Descriptor, error) {
 			continue
 		}
 
+		// File-level statements, kept for the conversion to protoreflect
+		if nestLevel == 0 {
+			switch {
+			case strings.HasPrefix(line, "syntax"):
+				desc.Syntax = quotedValue(line)
+				continue
+			case strings.HasPrefix(line, "package "):
+				desc.Package = strings.TrimSuffix(strings.TrimSpace(strings.TrimPrefix(line, "package ")), ";")
+				continue
+			case strings.HasPrefix(line, "import "):
+				desc.Dependency = append(desc.Dependency, quotedValue(line))
+				continue
+			case strings.HasPrefix(line, "option csharp_namespace"):
+				desc.Namespace = quotedValue(line)
+				continue
+			}
+		}
+
 		if strings.HasPrefix(line, "message ") {
 			name := strings.TrimSuffix(strings.TrimPrefix(line, "message "), " {")
-			msg := MessageType{Name: name}
+			msg := MessageType{Name: name, Comment: comment}
 			if currentMsg == nil {
 				desc.MessageType = append(desc.MessageType, msg)
 				currentMsg = &desc.MessageType[len(desc.MessageType)-1]
@@ -180,8 +318,7 @@ func ParseProtoFile(content string) (*Descriptor, error) {
 		}
 
 		if strings.HasPrefix(line, "enum ") {
-			name := strings.TrimSpace(strings.TrimPrefix(line, "enum "))
-			name = strings.TrimSuffix(name, "{")
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "enum "), "{"))
 			enum := EnumType{Name: name}
 			if currentMsg != nil {
 				currentMsg.EnumType = append(currentMsg.EnumType, enum)
@@ -200,11 +337,16 @@ func ParseProtoFile(content string) (*Descriptor, error) {
 				name = strings.TrimSpace(strings.TrimSuffix(name, "{"))
 				idx := len(currentMsg.OneOfDecl)
 				currentMsg.OneOfDecl = append(currentMsg.OneOfDecl, OneOfDecl{Name: name})
-				currentOneofIndex = &idx
+				currentOneofIndex, oneofLevel = &idx, nestLevel
 			}
 			continue
 		}
 
+		// Options aren't fields
+		if strings.HasPrefix(line, "option ") {
+			continue
+		}
+
 		// Parse fields (both regular and oneof fields)
 		if currentMsg != nil && strings.Contains(line, "=") {
 			parts := strings.Split(line, "=")
@@ -213,6 +355,9 @@ func ParseProtoFile(content string) (*Descriptor, error) {
 			}
 
 			fieldParts := strings.Fields(strings.TrimSpace(parts[0]))
+			if _, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(parts[1]), ";")); err != nil {
+				return nil, &ParseError{i + 1, line, "invalid number"}
+			}
 			if len(fieldParts) < 2 {
 				// This might be an enum value
 				if currentEnum != nil {
@@ -231,10 +376,14 @@ func ParseProtoFile(content string) (*Descriptor, error) {
 				Name:       fieldParts[1],
 				Number:     parseFieldNumber(parts[1]),
 				OneOfIndex: currentOneofIndex,
+				Comment:    comment,
 			}
 
 			// Handle optional/repeated labels
 			if fieldParts[0] == "optional" || fieldParts[0] == "repeated" {
+				if len(fieldParts) < 3 {
+					return nil, &ParseError{i + 1, line, "field without a name"}
+				}
 				field.Label = fieldParts[0]
 				field.Type = fieldParts[1]
 				field.Name = fieldParts[2]
@@ -264,9 +413,27 @@ func ParseProtoFile(content string) (*Descriptor, error) {
 		}
 	}
 
+	if nestLevel != 0 {
+		return nil, &ParseError{lastLine + 1, strings.TrimSpace(lines[lastLine]), "unbalanced braces at the end of the file"}
+	}
 	return &desc, nil
 }
 
+// splitTrailingComment separates the comment ending a line from its code,
+// the // of quoted strings being part of the code
+func splitTrailingComment(line string) (code, comment string) {
+	quoted := false
+	for i := 0; i < len(line)-1; i++ {
+		switch {
+		case line[i] == '"':
+			quoted = !quoted
+		case !quoted && line[i] == '/' && line[i+1] == '/':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+2:])
+		}
+	}
+	return line, ""
+}
+
 func countTotalMessages(messages []MessageType) int {
 	total := len(messages)
 	for _, msg := range messages {
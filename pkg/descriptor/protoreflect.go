@@ -0,0 +1,198 @@
+package descriptor
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// FileDescriptorProto converts the descriptor of a single proto file, as
+// returned by Parse, to its descriptorpb form registered under path.
+// Message and enum references are kept as written, protodesc resolves them.
+func FileDescriptorProto(desc *Descriptor, path string) (*descriptorpb.FileDescriptorProto, error) {
+	syntax := desc.Syntax
+	if syntax == "" {
+		syntax = "proto3"
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(path),
+		Syntax:     proto.String(syntax),
+		Dependency: desc.Dependency,
+	}
+	if desc.Package != "" {
+		file.Package = proto.String(desc.Package)
+	}
+
+	for i := range desc.EnumType {
+		file.EnumType = append(file.EnumType, enumDescriptorProto(&desc.EnumType[i]))
+	}
+	for i := range desc.MessageType {
+		message, err := messageDescriptorProto(&desc.MessageType[i], syntax == "proto3")
+		if err != nil {
+			return nil, err
+		}
+		file.MessageType = append(file.MessageType, message)
+	}
+	return file, nil
+}
+
+// FileDescriptor converts the descriptor of a single proto file to a
+// protoreflect.FileDescriptor, resolving its imports and types with files.
+// What files doesn't know becomes a placeholder rather than an error.
+func FileDescriptor(desc *Descriptor, path string, files *protoregistry.Files) (protoreflect.FileDescriptor, error) {
+	file, err := FileDescriptorProto(desc, path)
+	if err != nil {
+		return nil, err
+	}
+	if files == nil {
+		files = &protoregistry.Files{}
+	}
+	return protodesc.FileOptions{AllowUnresolvable: true}.New(file, files)
+}
+
+// Registry parses every proto file of fsys and registers their
+// conversions, imports first, so the protobuf runtime can use the schema
+// without compiling it. The files which couldn't be converted are returned
+// along with the registry, the files importing them see placeholders.
+func Registry(fsys fs.FS) (*protoregistry.Files, []string, error) {
+	descs := make(map[string]*Descriptor)
+	var paths []string
+	err := fs.WalkDir(fsys, ".", func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path.Ext(p) != ".proto" {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		desc, err := Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", p, err)
+		}
+		descs[p] = desc
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := &protoregistry.Files{}
+	var skipped []string
+	visited := make(map[string]bool)
+	var register func(p string)
+	register = func(p string) {
+		if visited[p] {
+			// Done, failed or in an import cycle
+			return
+		}
+		visited[p] = true
+
+		desc := *descs[p]
+		desc.Dependency = make([]string, len(descs[p].Dependency))
+		for i, dependency := range descs[p].Dependency {
+			desc.Dependency[i] = importPath(descs, p, dependency)
+			if _, ok := descs[desc.Dependency[i]]; ok {
+				register(desc.Dependency[i])
+			}
+		}
+
+		file, err := FileDescriptor(&desc, p, files)
+		if err == nil {
+			err = files.RegisterFile(file)
+		}
+		if err != nil {
+			skipped = append(skipped, p)
+		}
+	}
+	for _, p := range paths {
+		register(p)
+	}
+	return files, skipped, nil
+}
+
+// importPath returns the path of fsys an import of file refers to: from the
+// root, or else from the directory of file like the clear protos expect
+func importPath(descs map[string]*Descriptor, file, dependency string) string {
+	if _, ok := descs[dependency]; ok {
+		return dependency
+	}
+	if relative := path.Join(path.Dir(file), dependency); descs[relative] != nil {
+		return relative
+	}
+	return dependency
+}
+
+func messageDescriptorProto(msg *MessageType, proto3 bool) (*descriptorpb.DescriptorProto, error) {
+	message := &descriptorpb.DescriptorProto{Name: proto.String(msg.Name)}
+	for _, oneof := range msg.OneOfDecl {
+		message.OneofDecl = append(message.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(oneof.Name)})
+	}
+
+	// Proto3 optional fields live in synthetic oneofs, declared after the real ones
+	var synthetic []*descriptorpb.OneofDescriptorProto
+	for _, field := range msg.Field {
+		if strings.HasPrefix(field.Type, "map<") {
+			return nil, fmt.Errorf("message %s: map field %s is not supported", msg.Name, field.Name)
+		}
+
+		converted := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(field.Name),
+			Number: proto.Int32(int32(field.Number)),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if field.Label == "repeated" {
+			converted.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}
+		if scalar, ok := descriptorpb.FieldDescriptorProto_Type_value["TYPE_"+strings.ToUpper(field.Type)]; ok {
+			converted.Type = descriptorpb.FieldDescriptorProto_Type(scalar).Enum()
+		} else {
+			// Message or enum, protodesc tells which
+			converted.TypeName = proto.String(field.Type)
+		}
+
+		switch {
+		case field.OneOfIndex != nil:
+			converted.OneofIndex = proto.Int32(int32(*field.OneOfIndex))
+		case field.Label == "optional" && proto3:
+			converted.Proto3Optional = proto.Bool(true)
+			converted.OneofIndex = proto.Int32(int32(len(msg.OneOfDecl) + len(synthetic)))
+			synthetic = append(synthetic, &descriptorpb.OneofDescriptorProto{Name: proto.String("_" + field.Name)})
+		}
+		message.Field = append(message.Field, converted)
+	}
+	message.OneofDecl = append(message.OneofDecl, synthetic...)
+
+	for i := range msg.NestedType {
+		nested, err := messageDescriptorProto(&msg.NestedType[i], proto3)
+		if err != nil {
+			return nil, err
+		}
+		message.NestedType = append(message.NestedType, nested)
+	}
+	for i := range msg.EnumType {
+		message.EnumType = append(message.EnumType, enumDescriptorProto(&msg.EnumType[i]))
+	}
+	return message, nil
+}
+
+func enumDescriptorProto(enum *EnumType) *descriptorpb.EnumDescriptorProto {
+	converted := &descriptorpb.EnumDescriptorProto{Name: proto.String(enum.Name)}
+	for _, value := range enum.Value {
+		converted.Value = append(converted.Value, &descriptorpb.EnumValueDescriptorProto{
+			Name:   proto.String(value.Name),
+			Number: proto.Int32(int32(value.Number)),
+		})
+	}
+	return converted
+}
@@ -0,0 +1,127 @@
+package descriptor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Files recorded by FilterFiles next to the filtered protos: the files
+// left out as duplicates of another one, and the assembly of each file
+const (
+	aliasesFile    = "aliases.json"
+	assembliesFile = "assemblies.json"
+)
+
+// FileAliases maps the files byte-identical to another one to that file, the
+// only one filtered. Paths are relative to the source, with forward slashes.
+type FileAliases map[string]string
+
+// FileAssemblies maps the filtered files, and their aliases, to the assembly
+// they were kept for, the first one they declare matching the filter. The
+// files kept as dependencies of others have their first declared assembly,
+// empty when there is none.
+type FileAssemblies map[string]string
+
+// LoadFileAliases reads the aliases recorded by FilterFiles in fsys,
+// returning nil when there are none
+func LoadFileAliases(fsys fs.FS) (FileAliases, error) {
+	var aliases FileAliases
+	return aliases, loadRecord(fsys, aliasesFile, &aliases)
+}
+
+// LoadFileAssemblies reads the assemblies recorded by FilterFiles in
+// fsys, returning nil when there are none
+func LoadFileAssemblies(fsys fs.FS) (FileAssemblies, error) {
+	var assemblies FileAssemblies
+	return assemblies, loadRecord(fsys, assembliesFile, &assemblies)
+}
+
+func loadRecord(fsys fs.FS, name string, record any) error {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, record); err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// saveRecord writes a record in dir, removing the one of a previous
+// filtering when it's empty
+func saveRecord(dir, name string, record any, empty bool) error {
+	path := filepath.Join(dir, name)
+	if empty {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Names returns the aliases, sorted
+func (a FileAliases) Names() []string {
+	names := make([]string, 0, len(a))
+	for alias := range a {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PurgeProtos removes the proto files of dir, the records of
+// FilterFiles and the directories left empty, returning the number of
+// proto files removed. The other files are kept. A missing dir has nothing to
+// purge.
+func PurgeProtos(dir string) (int, error) {
+	removed := 0
+	var dirs []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			dirs = append(dirs, path)
+		case filepath.Ext(path) == ".proto":
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		case path == filepath.Join(dir, aliasesFile), path == filepath.Join(dir, assembliesFile):
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	// Deepest first, a directory is empty once its subdirectories are removed
+	for i := len(dirs) - 1; i > 0; i-- {
+		if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+	return removed, nil
+}
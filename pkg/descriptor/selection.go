@@ -0,0 +1,92 @@
+package descriptor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SelectMessages returns desc with only the top-level messages whose name
+// matches one of include, all of them when include is empty, and none
+// matching one of exclude. With references, the messages the fields of the
+// selected ones reference are selected too, transitively, so selecting an
+// envelope selects its content. Exclusions win over references.
+func SelectMessages(desc *Descriptor, include, exclude []string, references bool) (*Descriptor, error) {
+	includes, err := compilePatterns("message", include)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := compilePatterns("message", exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*MessageType, len(desc.MessageType))
+	for i := range desc.MessageType {
+		byName[desc.MessageType[i].Name] = &desc.MessageType[i]
+	}
+
+	selected := make(map[string]bool)
+	var pending []*MessageType
+	for i := range desc.MessageType {
+		msg := &desc.MessageType[i]
+		if len(includes) == 0 || matchesAny(includes, msg.Name) {
+			selected[msg.Name] = true
+			pending = append(pending, msg)
+		}
+	}
+	for references && len(pending) > 0 {
+		msg := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, name := range referencedMessages(msg) {
+			if referenced, ok := byName[name]; ok && !selected[name] {
+				selected[name] = true
+				pending = append(pending, referenced)
+			}
+		}
+	}
+
+	left := make(map[string]bool)
+	for _, msg := range desc.MessageType {
+		if !selected[msg.Name] || matchesAny(excludes, msg.Name) {
+			left[msg.Name] = true
+		}
+	}
+	return WithoutMessages(desc, left), nil
+}
+
+// referencedMessages returns the components of the types of the fields of
+// msg and of its nested messages, a reference to Outer.Inner naming Outer
+func referencedMessages(msg *MessageType) []string {
+	var names []string
+	for _, field := range msg.Field {
+		names = append(names, strings.Split(strings.TrimPrefix(field.Type, "."), ".")...)
+	}
+	for i := range msg.NestedType {
+		names = append(names, referencedMessages(&msg.NestedType[i])...)
+	}
+	return names
+}
+
+func matchesAny(patterns []*regexp.Regexp, text string) bool {
+	for _, re := range patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePatterns compiles the regular expressions of a filter, what naming
+// what they match in the errors
+func compilePatterns(what string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", what, pattern, err)
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
@@ -0,0 +1,66 @@
+// Package event carries the steps of a run, the files loaded and the matches
+// found, to the front-ends rendering it live.
+package event
+
+import (
+	"context"
+
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+)
+
+// Kind tells what happened in an Event
+type Kind string
+
+const (
+	FileParsed    Kind = "file_parsed"    // A proto file was loaded
+	MatchFound    Kind = "match_found"    // A matcher accepted a match
+	MatchRejected Kind = "match_rejected" // A match was dropped, or a message left unmatched
+	PassComplete  Kind = "pass_complete"  // A pass of the strict structure matcher ended
+	StageStarted  Kind = "stage_started"  // A stage of the pipeline started
+	StageComplete Kind = "stage_complete" // A stage of the pipeline ended
+	Progress      Kind = "progress"       // Tick of a running matcher
+)
+
+// Event is a step of a run, for front-ends rendering it live. Only the fields
+// of its kind are set.
+type Event struct {
+	Kind Kind `json:"kind"`
+	// File is the path of the parsed file, holding Messages messages
+	File     string `json:"file,omitempty"`
+	Messages int    `json:"messages,omitempty"`
+	// Matcher found or rejected Match, or ended Pass or its stage with Matches matches
+	Matcher string                `json:"matcher,omitempty"`
+	Match   *mapping.MessageMatch `json:"match,omitempty"`
+	Pass    int                   `json:"pass,omitempty"`
+	Matches int                   `json:"matches,omitempty"`
+	Reason  string                `json:"reason,omitempty"` // Why Match was decided so, when not by its matcher
+	// Processed of the Total obfuscated messages of Matcher so far
+	Processed int64 `json:"processed,omitempty"`
+	Total     int64 `json:"total,omitempty"`
+}
+
+// Handler receives the events of a run, one at a time. It is called from the
+// loading and matching code, so it should return quickly.
+type Handler func(Event)
+
+type handlerKey struct{}
+
+// WithHandler returns a context whose runs send their events to handler,
+// like httptrace does for HTTP requests. The handlers of ctx still get them.
+func WithHandler(ctx context.Context, handler Handler) context.Context {
+	if parent, ok := ctx.Value(handlerKey{}).(Handler); ok && parent != nil {
+		child := handler
+		handler = func(event Event) {
+			parent(event)
+			child(event)
+		}
+	}
+	return context.WithValue(ctx, handlerKey{}, handler)
+}
+
+// Emit sends event to the handler of ctx, if any
+func Emit(ctx context.Context, event Event) {
+	if handler, ok := ctx.Value(handlerKey{}).(Handler); ok && handler != nil {
+		handler(event)
+	}
+}
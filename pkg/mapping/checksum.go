@@ -0,0 +1,87 @@
+package mapping
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoChecksum is returned by Verify for the mappings written without a
+// checksum, by older versions or by hand
+var ErrNoChecksum = errors.New("the mapping has no checksum")
+
+// checksumPrefix names the hash of the checksums
+const checksumPrefix = "sha256:"
+
+// ComputeChecksum returns the checksum of the content of the mapping: the
+// sha256 of its JSON encoding without the checksum and signature, in hex
+// after "sha256:"
+func (m *Mapping) ComputeChecksum() (string, error) {
+	content := *m
+	content.Checksum, content.Signature = "", ""
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return checksumPrefix + hex.EncodeToString(hash[:]), nil
+}
+
+// Seal sets the checksum of the mapping once it is complete, dropping a
+// signature of a previous content
+func (m *Mapping) Seal() error {
+	checksum, err := m.ComputeChecksum()
+	if err != nil {
+		return err
+	}
+	m.Checksum, m.Signature = checksum, ""
+	return nil
+}
+
+// Sign seals the mapping and signs its checksum with key
+func (m *Mapping) Sign(key ed25519.PrivateKey) error {
+	if err := m.Seal(); err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(m.Checksum)))
+	return nil
+}
+
+// Verify checks that the content of the mapping is the one its checksum was
+// computed on, returning ErrNoChecksum when it has none
+func (m *Mapping) Verify() error {
+	if m.Checksum == "" {
+		return ErrNoChecksum
+	}
+	checksum, err := m.ComputeChecksum()
+	if err != nil {
+		return err
+	}
+	if checksum != m.Checksum {
+		return fmt.Errorf("checksum mismatch, the mapping was modified or corrupted since it was written (recorded %s, content %s)", m.Checksum, checksum)
+	}
+	return nil
+}
+
+// VerifySignature checks the checksum of the mapping and that it was signed
+// with the private key of key
+func (m *Mapping) VerifySignature(key ed25519.PublicKey) error {
+	if err := m.Verify(); err != nil {
+		return err
+	}
+	if m.Signature == "" {
+		return errors.New("the mapping isn't signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("decoding the signature: %w", err)
+	}
+	if !ed25519.Verify(key, []byte(m.Checksum), signature) {
+		return errors.New("the signature doesn't match the key")
+	}
+	return nil
+}
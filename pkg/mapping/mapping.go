@@ -0,0 +1,113 @@
+// Package mapping holds the types of the mapping.json files written by the
+// deobfuscator, for Go tools reading them.
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Version is the version of the mapping files written by this package.
+// Version 1 files, without the field, are read as is.
+const Version = 2
+
+// Mapping is the content of a mapping.json file
+type Mapping struct {
+	Version int `json:"version,omitempty"`
+	// Checksum of the content, set by Seal, and its ed25519 signature in
+	// base64 when the mapping is signed
+	Checksum  string         `json:"checksum,omitempty"`
+	Signature string         `json:"signature,omitempty"`
+	Matches   []MessageMatch `json:"matches"`
+	// Content hashes of the obfuscated files and of the clear corpus the
+	// matches come from, for incremental runs
+	Files     map[string]string `json:"files,omitempty"`
+	ClearHash string            `json:"clearHash,omitempty"`
+}
+
+// MessageMatch pairs an obfuscated message with its original
+type MessageMatch struct {
+	ObfuscatedMsg  string         `json:"obfuscatedMsg"`
+	ObfuscatedFile string         `json:"obfuscatedFile"`
+	OriginalMsg    string         `json:"originalMsg"`
+	OriginalFile   string         `json:"originalFile"`
+	MatchPercent   float64        `json:"matchPercent"`
+	Matcher        string         `json:"matcher"` // Name of the matcher which found it
+	EnumMatches    []EnumMatch    `json:"enumMatches,omitempty"`
+	Alternatives   []Alternative  `json:"alternatives,omitempty"`
+	MessageId      int            `json:"messageId,omitempty"` // Protocol id from dump.cs
+	Fields         []FieldMapping `json:"fields,omitempty"`    // Definitive matches only (version 2)
+}
+
+// EnumMatch is an enum of an obfuscated message found in the original one
+type EnumMatch struct {
+	ObfuscatedEnum string   `json:"obfuscatedEnum"` // Full path like "iqe.ipz"
+	OriginalEnum   string   `json:"originalEnum"`   // Full path like "ExchangeCraftResultEvent.CraftResult"
+	Values         []string `json:"values"`         // For logging/debugging
+	Confidence     float64  `json:"confidence"`     // Store the confidence score
+}
+
+// Alternative is another candidate scoring as well as the chosen original message
+type Alternative struct {
+	Name       string  `json:"name"`
+	File       string  `json:"file"`
+	Confidence float64 `json:"confidence"`
+}
+
+// FieldMapping pairs a field of an obfuscated message with the field of the
+// original message having the same number
+type FieldMapping struct {
+	Number     int    `json:"number"`
+	Obfuscated string `json:"obfuscated"`
+	Original   string `json:"original"`
+}
+
+// Unmarshal parses the content of a mapping file, refusing the versions
+// newer than this package
+func Unmarshal(data []byte) (*Mapping, error) {
+	var mapping Mapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, err
+	}
+	if mapping.Version > Version {
+		return nil, fmt.Errorf("mapping version %d is newer than the supported version %d", mapping.Version, Version)
+	}
+	return &mapping, nil
+}
+
+// Load reads a mapping.json file
+func Load(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing mapping file %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// SortedMatches returns a copy of matches in the order of the reports: by
+// obfuscated file and message, ties broken by original message and matcher so
+// the output doesn't depend on the order the matchers found them in
+func SortedMatches(matches []MessageMatch) []MessageMatch {
+	sorted := append([]MessageMatch{}, matches...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.ObfuscatedFile != b.ObfuscatedFile {
+			return a.ObfuscatedFile < b.ObfuscatedFile
+		}
+		if a.ObfuscatedMsg != b.ObfuscatedMsg {
+			return a.ObfuscatedMsg < b.ObfuscatedMsg
+		}
+		if a.OriginalMsg != b.OriginalMsg {
+			return a.OriginalMsg < b.OriginalMsg
+		}
+		return a.Matcher < b.Matcher
+	})
+	return sorted
+}
@@ -0,0 +1,73 @@
+package match
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/event"
+)
+
+var (
+	// obfuscatedNameRegex matches the names given by the obfuscator, a few
+	// lowercase letters like jfp for a message or eoir for a field
+	obfuscatedNameRegex = regexp.MustCompile(`^[a-z]{1,5}$`)
+	nameRegex           = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// IsClearName tells whether the obfuscator left a message or field name as
+// it was. Short lowercase clear names, like id, can't be told from
+// obfuscated ones and are taken as obfuscated, and what isn't an identifier,
+// like the name of a map field the parser doesn't know, isn't a name at all.
+func IsClearName(name string) bool {
+	return nameRegex.MatchString(name) && !obfuscatedNameRegex.MatchString(name)
+}
+
+// FindClearNameMatches pairs the top-level obfuscated messages whose name
+// isn't obfuscated with the clear message of the same name, when there is a
+// single one on each side. The messages of known matches are skipped. The
+// next matchers take these matches as known, like seeds, and the envelope one
+// pairs their members.
+func FindClearNameMatches(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, known []MessageMatch) []MessageMatch {
+	return findClearNameMatches(ctx, obfuscated, unobfuscated, known, matcherOptions{})
+}
+
+func findClearNameMatches(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, known []MessageMatch, options matcherOptions) []MessageMatch {
+	matchedObfuscated := make(map[string]bool)
+	matchedUnobfuscated := make(map[string]bool)
+	for _, match := range known {
+		matchedObfuscated[match.ObfuscatedMsg] = true
+		matchedUnobfuscated[match.OriginalMsg] = true
+	}
+
+	originals := make(map[string][]*descriptor.MessageType)
+	for _, msg := range messagePointers(unobfuscated.MessageType) {
+		originals[msg.Name] = append(originals[msg.Name], msg)
+	}
+
+	declared := make(map[string]int)
+	for _, msg := range obfuscated.MessageType {
+		declared[msg.Name]++
+	}
+
+	var matches []MessageMatch
+	for _, msg := range messagePointers(obfuscated.MessageType) {
+		if !IsClearName(msg.Name) || declared[msg.Name] != 1 || len(originals[msg.Name]) != 1 ||
+			matchedObfuscated[msg.Name] || matchedUnobfuscated[msg.Name] || options.rejects(msg.Name, msg.Name) {
+			continue
+		}
+		original := originals[msg.Name][0]
+		match := MessageMatch{
+			ObfuscatedMsg:  msg.Name,
+			ObfuscatedFile: msg.SourceFile,
+			OriginalMsg:    original.Name,
+			OriginalFile:   original.SourceFile,
+			MatchPercent:   100,
+			Matcher:        MatcherClearName,
+		}
+		matchedObfuscated[msg.Name] = true
+		matches = append(matches, match)
+		event.Emit(ctx, event.Event{Kind: event.MatchFound, Matcher: match.Matcher, Match: &match})
+	}
+	return matches
+}
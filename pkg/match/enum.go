@@ -0,0 +1,574 @@
+package match
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/event"
+)
+
+// findEnumBasedMatches finds messages that have matching enum definitions.
+// Obfuscated messages are compared in parallel, the matches keep their order.
+func findEnumBasedMatches(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, options matcherOptions, progress ProgressReporter, logger *slog.Logger) ([]MessageMatch, error) {
+	counters := progress.Phase(MatcherEnum)
+	counters.Start(len(obfuscated.MessageType))
+	defer counters.Finish()
+	start := time.Now()
+	defer func() { counters.AddTime(time.Since(start)) }()
+
+	var matches []MessageMatch
+	var totalObfuscatedWithEnums int
+	// Messages with enums left unmatched, logged after the summary
+	var unmatched []*descriptor.MessageType
+	var unmatchedEnums []string
+
+	// The enums of every original message are gathered once, and shared
+	// read-only by every worker. The ones of the obfuscated messages are
+	// gathered a chunk at a time.
+	obsMsgs := messagePointers(obfuscated.MessageType)
+	unobsMsgs := messagePointers(unobfuscated.MessageType)
+	unobsEnums := newMessageEnums(unobsMsgs)
+	index := newEnumIndex(unobsEnums)
+
+	size := options.chunkOf(len(obsMsgs))
+	for first := 0; first < len(obsMsgs); first += size {
+		chunk := obsMsgs[first:min(first+size, len(obsMsgs))]
+		obsEnums := newMessageEnums(chunk)
+
+		// Count messages with enums
+		for _, enums := range obsEnums {
+			if len(enums.paths) > 0 {
+				totalObfuscatedWithEnums++
+			}
+		}
+
+		results := make([]*MessageMatch, len(chunk))
+		logs := newTaskLogs(ctx, logger, len(chunk))
+		err := forEachParallel(ctx, len(chunk), func(i int) {
+			results[i] = findEnumMatch(chunk[i], obsEnums[i], unobsMsgs, unobsEnums, index, options, counters, logs.task(i))
+			counters.AddProcessed(1)
+		})
+		logs.flush(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, match := range results {
+			if match != nil && match.MatchPercent < options.threshold {
+				event.Emit(ctx, event.Event{
+					Kind:    event.MatchRejected,
+					Matcher: match.Matcher,
+					Match:   match,
+					Reason:  fmt.Sprintf("confidence %.2f%% below the %.0f%% threshold", match.MatchPercent, options.threshold),
+				})
+				logger.Debug("enum match under the threshold",
+					"obfuscated", match.ObfuscatedMsg,
+					"original", match.OriginalMsg,
+					"confidence", match.MatchPercent,
+					"threshold", options.threshold,
+				)
+			} else if match != nil {
+				matches = append(matches, *match)
+				event.Emit(ctx, event.Event{Kind: event.MatchFound, Matcher: match.Matcher, Match: match})
+				continue
+			}
+			if len(obsEnums[i].paths) > 0 && logger.Enabled(ctx, slog.LevelDebug) {
+				unmatched = append(unmatched, chunk[i])
+				unmatchedEnums = append(unmatchedEnums, formatEnumPaths(obsEnums[i].enums))
+			}
+		}
+	}
+
+	// Update progress when we find matches
+	progress.AddMatches(len(matches))
+	counters.AddMatches(len(matches))
+
+	// Enhanced summary logging
+	logger.Info("enum matching summary",
+		"obfuscated_with_enums", totalObfuscatedWithEnums,
+		"enum_matches_found", len(matches),
+		"matching_progress", fmt.Sprintf("%.1f%%", progress.GetProgress()),
+	)
+
+	// Log unmatched messages
+	for i, obsMsg := range unmatched {
+		logger.Debug("unmatched message",
+			"name", obsMsg.Name,
+			"enums", unmatchedEnums[i],
+		)
+	}
+
+	return matches, nil
+}
+
+// messageEnums holds the enums of a message with their paths in a stable order
+type messageEnums struct {
+	enums  map[string]*descriptor.EnumType
+	paths  []string
+	values []map[string]int // Name -> number of the values of each enum, by path
+	usages [][]int          // Numbers of the fields of the declaring message typed with each enum, by path
+}
+
+func newMessageEnums(messages []*descriptor.MessageType) []messageEnums {
+	views := make([]messageEnums, len(messages))
+	for i, msg := range messages {
+		enums := getAllEnums(msg, "")
+		paths := sortedEnumPaths(enums)
+		values := make([]map[string]int, len(paths))
+		usages := make([][]int, len(paths))
+		fields := getEnumUsages(msg, "")
+		for p, path := range paths {
+			values[p] = enumValueMap(enums[path])
+			usages[p] = fields[path]
+		}
+		views[i] = messageEnums{enums, paths, values, usages}
+	}
+	return views
+}
+
+// enumRef is an enum of an original message: the index of the message and of its enum path
+type enumRef struct {
+	msg, path int
+}
+
+// enumIndex lists the original enums holding each enum value. Enums match when
+// the values of the smaller one are all in the other, so the messages which can
+// match are found by counting the values each enum shares with the obfuscated
+// ones, without comparing every pair of enums.
+type enumIndex struct {
+	postings map[descriptor.EnumValue][]enumRef
+	sizes    map[enumRef]int // Distinct values of each enum
+}
+
+func newEnumIndex(views []messageEnums) *enumIndex {
+	index := &enumIndex{
+		postings: make(map[descriptor.EnumValue][]enumRef),
+		sizes:    make(map[enumRef]int),
+	}
+	for u, view := range views {
+		for p, values := range view.values {
+			ref := enumRef{u, p}
+			for _, name := range sortedValueNames(values) {
+				key := descriptor.EnumValue{Name: name, Number: values[name]}
+				index.postings[key] = append(index.postings[key], ref)
+			}
+			index.sizes[ref] = len(values)
+		}
+	}
+	return index
+}
+
+// candidates returns, in order, the original messages having a matching enum
+// for every enum of view
+func (index *enumIndex) candidates(view messageEnums, options matcherOptions) []int {
+	var candidates map[int]bool
+	for _, values := range view.values {
+
+		shared := make(map[enumRef]int)
+		for name, number := range values {
+			for _, ref := range index.postings[descriptor.EnumValue{Name: name, Number: number}] {
+				shared[ref]++
+			}
+		}
+
+		// Same rule as compareEnums, the enums without shared values never win
+		matching := make(map[int]bool)
+		for ref, count := range shared {
+			size := index.sizes[ref]
+			if options.exact && size != len(values) {
+				continue
+			}
+			if count == min(len(values), size) && (candidates == nil || candidates[ref.msg]) {
+				matching[ref.msg] = true
+			}
+		}
+		candidates = matching
+		if len(candidates) == 0 {
+			return nil
+		}
+	}
+
+	ordered := make([]int, 0, len(candidates))
+	for u := range candidates {
+		ordered = append(ordered, u)
+	}
+	sort.Ints(ordered)
+	return ordered
+}
+
+// findEnumMatch returns the first original message whose enums all match the
+// ones of obsMsg, or nil
+func findEnumMatch(obsMsg *descriptor.MessageType, obsEnums messageEnums, unobfuscated []*descriptor.MessageType, unobsEnums []messageEnums, index *enumIndex, options matcherOptions, counters *PhaseCounters, logger *slog.Logger) *MessageMatch {
+	if len(obsEnums.paths) == 0 {
+		return nil
+	}
+	obfsEnums, obfsPaths := obsEnums.enums, obsEnums.paths
+	candidates := index.candidates(obsEnums, options)
+	counters.AddCandidates(len(candidates))
+	comparisons := 0
+	defer func() { counters.AddComparisons(comparisons) }()
+
+	// For each unobfuscated message which may match
+	for _, u := range candidates {
+		unobsMsg := unobfuscated[u]
+		if options.rejects(obsMsg.Name, unobsMsg.Name) {
+			continue
+		}
+		var enumMatches []EnumMatch
+		var allEnumsMatched bool = true
+
+		// Try to match each enum and find their parent messages, in a stable order
+		for j, obfsPath := range obfsPaths {
+			obfsEnum := obfsEnums[obfsPath]
+			matched := false
+			var bestMatch EnumMatch
+			var bestConfidence float64
+
+			for k, unobsPath := range unobsEnums[u].paths {
+				comparisons++
+				if isMatch, confidence := compareEnums(obsEnums.values[j], unobsEnums[u].values[k], options); isMatch {
+					// Get top-level messages containing these enums
+					obfsParent := getTopLevelMessage(obsMsg, strings.Split(obfsPath, ".")[0])
+					unobsParent := getTopLevelMessage(unobsMsg, strings.Split(unobsPath, ".")[0])
+
+					if confidence > bestConfidence {
+						bestMatch = EnumMatch{
+							ObfuscatedEnum: obfsPath,
+							OriginalEnum:   unobsPath,
+							Values:         formatEnumValues(obfsEnum.Value),
+							Confidence:     confidence,
+						}
+						bestConfidence = confidence
+						matched = true
+					}
+
+					logger.Debug("found matching enum in messages",
+						"obfuscated_msg", obfsParent,
+						"original_msg", unobsParent,
+						"enum_match", fmt.Sprintf("%s -> %s", obfsPath, unobsPath),
+					)
+				}
+			}
+
+			if matched {
+				enumMatches = append(enumMatches, bestMatch)
+			} else {
+				allEnumsMatched = false
+			}
+		}
+
+		// If we found matches, match the top-level messages
+		if allEnumsMatched && len(enumMatches) > 0 {
+			// Calculate average confidence
+			var totalConfidence float64
+			for _, enumMatch := range enumMatches {
+				totalConfidence += enumMatch.Confidence
+			}
+			averageConfidence := totalConfidence / float64(len(enumMatches))
+
+			logger.Debug("found top-level message match",
+				"obfuscated", obsMsg.Name,
+				"original", unobsMsg.Name,
+			)
+
+			for _, enumMatch := range enumMatches {
+				logger.Debug("matching enum",
+					"obfuscated_enum", enumMatch.ObfuscatedEnum,
+					"original_enum", enumMatch.OriginalEnum,
+					"values", enumMatch.Values,
+				)
+			}
+
+			return &MessageMatch{
+				ObfuscatedMsg:  obsMsg.Name,
+				ObfuscatedFile: obsMsg.SourceFile,
+				OriginalMsg:    unobsMsg.Name,
+				OriginalFile:   unobsMsg.SourceFile,
+				MatchPercent:   averageConfidence,
+				Matcher:        MatcherEnum,
+				EnumMatches:    enumMatches,
+			}
+		}
+	}
+
+	if options.fuzzy {
+		return findFuzzyEnumMatch(obsMsg, obsEnums, unobfuscated, unobsEnums, options, counters, logger)
+	}
+	return nil
+}
+
+// Returns true if both enums, given as maps of name->number, have matching
+// values, with a confidence score
+func compareEnums(obfsMap, unobsMap map[string]int, options matcherOptions) (bool, float64) {
+	if options.exact && len(obfsMap) != len(unobsMap) {
+		return false, 0
+	}
+
+	// Count matching values
+	matchingValues := 0
+	for name, number := range obfsMap {
+		if unobsNumber, exists := unobsMap[name]; exists && unobsNumber == number {
+			matchingValues++
+		}
+	}
+
+	// Calculate confidence based on matching ratio
+	smallerSize := len(obfsMap)
+	if len(unobsMap) < smallerSize {
+		smallerSize = len(unobsMap)
+	}
+
+	// If all values in the smaller enum match, consider it a match
+	if matchingValues == smallerSize {
+		confidence := float64(matchingValues) / float64(max(len(obfsMap), len(unobsMap))) * 100
+		return true, confidence
+	}
+
+	return false, 0
+}
+
+func enumValueMap(enum *descriptor.EnumType) map[string]int {
+	values := make(map[string]int)
+	for _, v := range enum.Value {
+		values[v.Name] = v.Number
+	}
+	return values
+}
+
+// Helper function to get all enums in a message and its nested messages
+func getAllEnums(msg *descriptor.MessageType, parentPath string) map[string]*descriptor.EnumType {
+	enums := make(map[string]*descriptor.EnumType)
+
+	// Add direct enums with proper parent path
+	for i := range msg.EnumType {
+		path := parentPath
+		if path == "" {
+			path = msg.Name
+		}
+		enums[path+"."+msg.EnumType[i].Name] = &msg.EnumType[i]
+	}
+
+	// Add nested message enums with proper hierarchy
+	for i := range msg.NestedType {
+		nested := &msg.NestedType[i]
+		nestedPath := parentPath
+		if nestedPath == "" {
+			nestedPath = msg.Name
+		}
+		nestedPath = nestedPath + "." + nested.Name
+		for path, enum := range getAllEnums(nested, nestedPath) {
+			enums[path] = enum
+		}
+	}
+
+	return enums
+}
+
+// getEnumUsages returns the numbers of the fields typed with each enum of a
+// message and its nested messages, among the fields of the message declaring
+// it, by enum path like getAllEnums
+func getEnumUsages(msg *descriptor.MessageType, parentPath string) map[string][]int {
+	path := parentPath
+	if path == "" {
+		path = msg.Name
+	}
+
+	usages := make(map[string][]int)
+	for _, enum := range msg.EnumType {
+		for _, field := range msg.Field {
+			if messageName(field.Type) == enum.Name {
+				usages[path+"."+enum.Name] = append(usages[path+"."+enum.Name], field.Number)
+			}
+		}
+	}
+	for i := range msg.NestedType {
+		nested := &msg.NestedType[i]
+		for enumPath, numbers := range getEnumUsages(nested, path+"."+nested.Name) {
+			usages[enumPath] = numbers
+		}
+	}
+	return usages
+}
+
+// Helper to get the top-level message containing an enum
+func getTopLevelMessage(msg *descriptor.MessageType, enumPath string) string {
+	parts := strings.Split(enumPath, ".")
+	if len(parts) < 2 {
+		return ""
+	}
+	topMsg := parts[0] // First part should be the top-level message name
+
+	// If this is the top message, check if it owns the enum
+	if msg.Name == topMsg {
+		return msg.Name
+	}
+
+	// Check nested messages
+	for i := range msg.NestedType {
+		if found := getTopLevelMessage(&msg.NestedType[i], enumPath); found != "" {
+			return msg.Name // Return the parent message name
+		}
+	}
+
+	return ""
+}
+
+func formatEnumValues(values []descriptor.EnumValue) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = fmt.Sprintf("%s=%d", v.Name, v.Number)
+	}
+	return result
+}
+
+func sortedEnumPaths(enums map[string]*descriptor.EnumType) []string {
+	paths := make([]string, 0, len(enums))
+	for path := range enums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sortedValueNames returns the names of the values of an enum in order
+func sortedValueNames(values map[string]int) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatEnumPaths(enums map[string]*descriptor.EnumType) string {
+	var parts []string
+	for _, path := range sortedEnumPaths(enums) {
+		values := formatEnumValues(enums[path].Value)
+		parts = append(parts, fmt.Sprintf("%s: [%s]", path, strings.Join(values, ", ")))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// fuzzyEnumCeiling is the confidence of a fuzzy enum match whose enums have
+// the same value numbers and are used by the same fields, the value names
+// being left out of the evidence
+const fuzzyEnumCeiling = 80
+
+// fuzzyEnumThreshold is the confidence every enum of a fuzzy match needs
+const fuzzyEnumThreshold = 60
+
+// findFuzzyEnumMatch pairs a message with the original message whose enums
+// best resemble its own by their value numbers and the number of the fields
+// using them, for the enums whose value names are obfuscated too. Both
+// messages need as many enums, each pair scoring fuzzyEnumThreshold or more,
+// and the best original must be the only one with its confidence.
+func findFuzzyEnumMatch(obsMsg *descriptor.MessageType, obsEnums messageEnums, unobfuscated []*descriptor.MessageType, unobsEnums []messageEnums, options matcherOptions, counters *PhaseCounters, logger *slog.Logger) *MessageMatch {
+	var best *MessageMatch
+	tied := false
+	comparisons := 0
+	defer func() { counters.AddComparisons(comparisons) }()
+	for u, unobsMsg := range unobfuscated {
+		if len(unobsEnums[u].paths) != len(obsEnums.paths) || options.rejects(obsMsg.Name, unobsMsg.Name) {
+			continue
+		}
+
+		var enumMatches []EnumMatch
+		total := 0.0
+		used := make(map[int]bool)
+		for j, obsPath := range obsEnums.paths {
+			bestEnum, bestConfidence := -1, 0.0
+			for k := range unobsEnums[u].paths {
+				if used[k] {
+					continue
+				}
+				comparisons++
+				confidence := fuzzyEnumConfidence(obsEnums.values[j], unobsEnums[u].values[k], obsEnums.usages[j], unobsEnums[u].usages[k])
+				if confidence > bestConfidence {
+					bestEnum, bestConfidence = k, confidence
+				}
+			}
+			if bestEnum < 0 || bestConfidence < fuzzyEnumThreshold {
+				enumMatches = nil
+				break
+			}
+			used[bestEnum] = true
+			total += bestConfidence
+			enumMatches = append(enumMatches, EnumMatch{
+				ObfuscatedEnum: obsPath,
+				OriginalEnum:   unobsEnums[u].paths[bestEnum],
+				Values:         formatEnumValues(obsEnums.enums[obsPath].Value),
+				Confidence:     bestConfidence,
+			})
+		}
+		if len(enumMatches) == 0 {
+			continue
+		}
+
+		confidence := total / float64(len(enumMatches))
+		switch {
+		case best == nil || confidence > best.MatchPercent:
+			best = &MessageMatch{
+				ObfuscatedMsg:  obsMsg.Name,
+				ObfuscatedFile: obsMsg.SourceFile,
+				OriginalMsg:    unobsMsg.Name,
+				OriginalFile:   unobsMsg.SourceFile,
+				MatchPercent:   confidence,
+				Matcher:        MatcherEnum,
+				EnumMatches:    enumMatches,
+			}
+			tied = false
+		case confidence == best.MatchPercent:
+			tied = true
+		}
+	}
+
+	if best == nil || tied {
+		return nil
+	}
+	logger.Debug("found fuzzy enum match",
+		"obfuscated", best.ObfuscatedMsg,
+		"original", best.OriginalMsg,
+		"confidence", best.MatchPercent,
+	)
+	return best
+}
+
+// fuzzyEnumConfidence scores two enums by the value numbers they share and,
+// when either is used by a field, by whether a field of the same number uses
+// both, up to fuzzyEnumCeiling
+func fuzzyEnumConfidence(obfsMap, unobsMap map[string]int, obfsUsages, unobsUsages []int) float64 {
+	numbers := make(map[int]int)
+	for _, number := range obfsMap {
+		numbers[number] |= 1
+	}
+	for _, number := range unobsMap {
+		numbers[number] |= 2
+	}
+	shared := 0
+	for _, sides := range numbers {
+		if sides == 3 {
+			shared++
+		}
+	}
+	if len(numbers) == 0 {
+		return 0
+	}
+	score, checks := float64(shared)/float64(len(numbers)), 1.0
+
+	if len(obfsUsages) > 0 || len(unobsUsages) > 0 {
+		checks++
+		for _, number := range obfsUsages {
+			if slices.Contains(unobsUsages, number) {
+				score++
+				break
+			}
+		}
+	}
+	return score / checks * fuzzyEnumCeiling
+}
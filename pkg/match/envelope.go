@@ -0,0 +1,366 @@
+package match
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/event"
+)
+
+// envelopeMinShare is the share of the top-level messages of its corpus a
+// oneof needs as members for its message to be an envelope, like the Request
+// of the protocol enumerating every request
+const envelopeMinShare = 0.25
+
+// envelopeMinMembers is how many message members an envelope needs at least,
+// for the corpora too small for their share to mean anything
+const envelopeMinMembers = 5
+
+// envelopeMemberThreshold is the confidence a pair of members needs when no
+// threshold is set, their place in the envelope vouching for the rest
+const envelopeMemberThreshold = FuzzyThreshold
+
+// findEnvelopeBasedMatches pairs the oneof members of the matched messages by
+// field number, or by position when the oneofs have as many members, and the
+// members of these in turn. An envelope whose number of members no other
+// envelope has on either side is only reported as uncertain, the other
+// envelopes of the clear corpus as its alternatives: its size alone can be a
+// coincidence.
+func findEnvelopeBasedMatches(
+	ctx context.Context,
+	obfuscated, unobfuscated *descriptor.Descriptor,
+	previousMatches []MessageMatch,
+	options matcherOptions,
+	progress ProgressReporter,
+	logger *slog.Logger,
+) ([]MessageMatch, error) {
+	counters := progress.Phase(MatcherEnvelope)
+	start := time.Now()
+	defer func() { counters.AddTime(time.Since(start)) }()
+
+	obsByName := topLevelMessages(obfuscated)
+	unobsByName := topLevelMessages(unobfuscated)
+	obsIndex, unobsIndex := newMessageIndex(obfuscated), newMessageIndex(unobfuscated)
+
+	matchedObfuscated := make(map[string]bool)
+	matchedUnobfuscated := make(map[string]bool)
+	// Pairs whose oneof members are compared
+	var pairs [][2]*descriptor.MessageType
+	for _, pm := range previousMatches {
+		matchedObfuscated[pm.ObfuscatedMsg] = true
+		matchedUnobfuscated[pm.OriginalMsg] = true
+		if len(pm.Alternatives) > 0 {
+			continue
+		}
+		if obsMsg, unobsMsg := obsByName[pm.ObfuscatedMsg], unobsByName[pm.OriginalMsg]; obsMsg != nil && unobsMsg != nil {
+			pairs = append(pairs, [2]*descriptor.MessageType{obsMsg, unobsMsg})
+		}
+	}
+
+	remaining := 0
+	for name := range obsByName {
+		if !matchedObfuscated[name] {
+			remaining++
+		}
+	}
+	counters.Start(remaining)
+	defer counters.Finish()
+
+	var matches []MessageMatch
+	accept := func(obsMsg, unobsMsg *descriptor.MessageType, confidence float64, reason string) {
+		matchedObfuscated[obsMsg.Name] = true
+		matchedUnobfuscated[unobsMsg.Name] = true
+		pairs = append(pairs, [2]*descriptor.MessageType{obsMsg, unobsMsg})
+		counters.AddProcessed(1)
+
+		match := MessageMatch{
+			ObfuscatedMsg:  obsMsg.Name,
+			ObfuscatedFile: obsMsg.SourceFile,
+			OriginalMsg:    unobsMsg.Name,
+			OriginalFile:   unobsMsg.SourceFile,
+			MatchPercent:   confidence,
+			Matcher:        MatcherEnvelope,
+		}
+		matches = append(matches, match)
+		event.Emit(ctx, event.Event{Kind: event.MatchFound, Matcher: match.Matcher, Match: &match})
+		logger.Debug("envelope-based match",
+			"obfuscated", obsMsg.Name,
+			"original", unobsMsg.Name,
+			"confidence", confidence,
+			"reason", reason,
+		)
+	}
+
+	threshold := options.thresholdOr(envelopeMemberThreshold)
+	shapes := &messageShapes{}
+	obsEnvelopes := envelopesBySize(obfuscated, obsIndex, len(obsByName))
+	unobsEnvelopes := envelopesBySize(unobfuscated, unobsIndex, len(unobsByName))
+	sizes := make([]int, 0, len(obsEnvelopes))
+	for size := range obsEnvelopes {
+		sizes = append(sizes, size)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	uncertain := 0
+	for _, size := range sizes {
+		obsMsgs, unobsMsgs := obsEnvelopes[size], unobsEnvelopes[size]
+		if len(obsMsgs) != 1 || len(unobsMsgs) != 1 || matchedObfuscated[obsMsgs[0].Name] || matchedUnobfuscated[unobsMsgs[0].Name] ||
+			options.rejects(obsMsgs[0].Name, unobsMsgs[0].Name) {
+			continue
+		}
+		obsMsg, unobsMsg := obsMsgs[0], unobsMsgs[0]
+		counters.AddComparisons(1)
+		match := MessageMatch{
+			ObfuscatedMsg:  obsMsg.Name,
+			ObfuscatedFile: obsMsg.SourceFile,
+			OriginalMsg:    unobsMsg.Name,
+			OriginalFile:   unobsMsg.SourceFile,
+			MatchPercent:   memberConfidence(shapes, options.weights, obsMsg, unobsMsg),
+			Matcher:        MatcherEnvelope,
+		}
+		if match.MatchPercent < threshold {
+			event.Emit(ctx, event.Event{
+				Kind:    event.MatchRejected,
+				Matcher: match.Matcher,
+				Match:   &match,
+				Reason:  fmt.Sprintf("confidence %.2f%% below the %.0f%% threshold", match.MatchPercent, threshold),
+			})
+			logger.Debug("envelope rejected",
+				"obfuscated", obsMsg.Name,
+				"original", unobsMsg.Name,
+				"confidence", match.MatchPercent,
+				"threshold", threshold,
+			)
+			continue
+		}
+
+		// The pair stays uncertain, it neither consumes the original nor
+		// pairs its members
+		match.Alternatives = envelopeAlternatives(shapes, options.weights, obsMsg, unobsMsg, unobsEnvelopes, matchedUnobfuscated)
+		if len(match.Alternatives) == 0 {
+			event.Emit(ctx, event.Event{
+				Kind:    event.MatchRejected,
+				Matcher: match.Matcher,
+				Match:   &match,
+				Reason:  fmt.Sprintf("only envelope of %d members, its size alone pairs it", size),
+			})
+			logger.Info("envelope left unmatched, its size alone pairs it",
+				"obfuscated", obsMsg.Name,
+				"original", unobsMsg.Name,
+				"confidence", match.MatchPercent,
+			)
+			continue
+		}
+		matchedObfuscated[obsMsg.Name] = true
+		counters.AddProcessed(1)
+		matches = append(matches, match)
+		uncertain++
+		event.Emit(ctx, event.Event{Kind: event.MatchFound, Matcher: match.Matcher, Match: &match})
+		logger.Debug("envelope match with alternatives",
+			"obfuscated", obsMsg.Name,
+			"original", unobsMsg.Name,
+			"confidence", match.MatchPercent,
+			"alternatives", len(match.Alternatives),
+		)
+	}
+
+	for i := 0; i < len(pairs); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		obsMsg, unobsMsg := pairs[i][0], pairs[i][1]
+		for oneof := range min(len(obsMsg.OneOfDecl), len(unobsMsg.OneOfDecl)) {
+			obsFields, unobsFields := getOneofFields(obsMsg, oneof), getOneofFields(unobsMsg, oneof)
+			counters.AddCandidates(len(obsFields))
+			for position, obsField := range obsFields {
+				unobsField := oneofMember(unobsFields, obsField.Number, position, len(obsFields))
+				if unobsField == nil {
+					continue
+				}
+				obsMember, unobsMember := obsIndex.fieldMessage(obsMsg, obsField.Type), unobsIndex.fieldMessage(unobsMsg, unobsField.Type)
+				if obsMember == nil || unobsMember == nil || matchedObfuscated[obsMember.Name] || matchedUnobfuscated[unobsMember.Name] ||
+					options.rejects(obsMember.Name, unobsMember.Name) {
+					continue
+				}
+				if !shapes.namesAgree(obsMember, unobsMember) {
+					logger.Debug("envelope member rejected, its clear names differ",
+						"obfuscated", obsMember.Name,
+						"original", unobsMember.Name,
+					)
+					continue
+				}
+				counters.AddComparisons(1)
+				confidence := memberConfidence(shapes, options.weights, obsMember, unobsMember)
+				if confidence < threshold {
+					logger.Debug("envelope member rejected",
+						"obfuscated", obsMember.Name,
+						"original", unobsMember.Name,
+						"confidence", confidence,
+						"threshold", threshold,
+					)
+					continue
+				}
+				accept(obsMember, unobsMember, confidence, fmt.Sprintf("member %d of %s", unobsField.Number, unobsMsg.Name))
+			}
+		}
+	}
+
+	progress.AddMatches(len(matches) - uncertain)
+	counters.AddMatches(len(matches))
+
+	logger.Info("envelope matching summary",
+		"uncertain_envelopes", uncertain,
+		"envelope_matches_found", len(matches),
+		"matching_progress", fmt.Sprintf("%.1f%%", progress.GetProgress()),
+	)
+
+	return matches, nil
+}
+
+// envelopesBySize returns the envelopes of a corpus of topLevel messages by
+// their number of members, the largest of their oneofs
+func envelopesBySize(desc *descriptor.Descriptor, index messageIndex, topLevel int) map[int][]*descriptor.MessageType {
+	minMembers := max(envelopeMinMembers, int(math.Ceil(envelopeMinShare*float64(topLevel))))
+	envelopes := make(map[int][]*descriptor.MessageType)
+	for _, msg := range messagePointers(desc.MessageType) {
+		size := 0
+		for oneof := range msg.OneOfDecl {
+			members := 0
+			for _, field := range getOneofFields(msg, oneof) {
+				if index.fieldMessage(msg, field.Type) != nil {
+					members++
+				}
+			}
+			size = max(size, members)
+		}
+		if size >= minMembers {
+			envelopes[size] = append(envelopes[size], msg)
+		}
+	}
+	return envelopes
+}
+
+// envelopeAlternatives returns the unmatched envelopes of the clear corpus
+// other than unobsMsg, best first, scored against obsMsg
+func envelopeAlternatives(
+	shapes *messageShapes,
+	weights Weights,
+	obsMsg, unobsMsg *descriptor.MessageType,
+	unobsEnvelopes map[int][]*descriptor.MessageType,
+	matchedUnobfuscated map[string]bool,
+) []Alternative {
+	var alternatives []Alternative
+	for _, msgs := range unobsEnvelopes {
+		for _, msg := range msgs {
+			if msg == unobsMsg || matchedUnobfuscated[msg.Name] {
+				continue
+			}
+			alternatives = append(alternatives, Alternative{
+				Name:       msg.Name,
+				File:       msg.SourceFile,
+				Confidence: memberConfidence(shapes, weights, obsMsg, msg),
+			})
+		}
+	}
+	sort.Slice(alternatives, func(i, j int) bool {
+		if alternatives[i].Confidence != alternatives[j].Confidence {
+			return alternatives[i].Confidence > alternatives[j].Confidence
+		}
+		return alternatives[i].Name < alternatives[j].Name
+	})
+	return alternatives
+}
+
+// oneofMember returns the member of fields numbered number, or the one at
+// position when there is none and the oneofs have as many members
+func oneofMember(fields []*descriptor.Field, number, position, members int) *descriptor.Field {
+	for _, field := range fields {
+		if field.Number == number {
+			return field
+		}
+	}
+	if len(fields) == members {
+		return fields[position]
+	}
+	return nil
+}
+
+// memberConfidence is the structure confidence of a pair, full for two
+// messages without fields, like a Ping and its Pong
+func memberConfidence(shapes *messageShapes, weights Weights, obsMsg, unobsMsg *descriptor.MessageType) float64 {
+	if len(obsMsg.Field) == 0 && len(unobsMsg.Field) == 0 {
+		return 100
+	}
+	_, confidence := compareMessageStructures(shapes, weights, obsMsg, unobsMsg)
+	return confidence
+}
+
+// messageName returns the last part of a field type, the message name of
+// the qualified references
+func messageName(fieldType string) string {
+	return fieldType[strings.LastIndex(fieldType, ".")+1:]
+}
+
+// messageIndex holds the top-level messages of a corpus by their full name
+type messageIndex map[string]*descriptor.MessageType
+
+func newMessageIndex(desc *descriptor.Descriptor) messageIndex {
+	index := make(messageIndex, len(desc.MessageType))
+	for _, msg := range messagePointers(desc.MessageType) {
+		name := msg.Name
+		if msg.Package != "" {
+			name = msg.Package + "." + name
+		}
+		index[name] = msg
+	}
+	return index
+}
+
+// fieldMessage returns the top-level message the type of a field of msg
+// references, resolved from the scope of msg like protoc does: nil for a
+// nested message, a scalar or an unknown type
+func (index messageIndex) fieldMessage(msg *descriptor.MessageType, fieldType string) *descriptor.MessageType {
+	if strings.HasPrefix(fieldType, ".") {
+		return index[fieldType[1:]]
+	}
+	first, _, _ := strings.Cut(fieldType, ".")
+	for _, nested := range msg.NestedType {
+		if nested.Name == first {
+			return nil
+		}
+	}
+	for _, enum := range msg.EnumType {
+		if enum.Name == first {
+			return nil
+		}
+	}
+	// The first part is looked up from the innermost package, the rest
+	// within what it names
+	scope := msg.Package
+	for {
+		prefix := ""
+		if scope != "" {
+			prefix = scope + "."
+		}
+		if index[prefix+first] != nil {
+			return index[prefix+fieldType]
+		}
+		if scope == "" {
+			return nil
+		}
+		scope = scope[:max(strings.LastIndex(scope, "."), 0)]
+	}
+}
+
+func topLevelMessages(desc *descriptor.Descriptor) map[string]*descriptor.MessageType {
+	messages := make(map[string]*descriptor.MessageType, len(desc.MessageType))
+	for _, msg := range messagePointers(desc.MessageType) {
+		messages[msg.Name] = msg
+	}
+	return messages
+}
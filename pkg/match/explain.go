@@ -0,0 +1,123 @@
+package match
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+)
+
+// ScoreComponent is one check of the structure comparison, its score in [0, 1]
+// counting weight times in the confidence
+type ScoreComponent struct {
+	Check  string
+	Score  float64
+	Weight float64
+}
+
+// Candidate is an original message scored against an obfuscated one, with
+// what each matcher makes of the pair
+type Candidate struct {
+	Message    *descriptor.MessageType
+	Components []ScoreComponent
+	Confidence float64
+	Perfect    bool // Strict structure match
+	// Enums of the obfuscated message, and how many have a match in the candidate
+	Enums, EnumsMatched int
+	// Differences of the structures, like "field 7 type mismatch bytes vs string"
+	Mismatches []string
+	// Why the relaxed matcher can't pick the candidate, empty when it can
+	Rejection string
+}
+
+// ExplainMessage scores every original message against msg like the
+// matchers do, the best candidates first. It takes the options of the
+// matchers, the threshold and weights of the relaxed one.
+func ExplainMessage(msg *descriptor.MessageType, unobfuscated *descriptor.Descriptor, opts ...Option) []Candidate {
+	options := newMatcherOptions(opts)
+	threshold := options.thresholdOr(DefaultThreshold)
+	shapes := &messageShapes{}
+	obsEnums := newMessageEnums([]*descriptor.MessageType{msg})[0]
+
+	unobsMsgs := messagePointers(unobfuscated.MessageType)
+	unobsEnums := newMessageEnums(unobsMsgs)
+	candidates := make([]Candidate, len(unobsMsgs))
+	for u, unobsMsg := range unobsMsgs {
+		candidate := Candidate{Message: unobsMsg, Enums: len(obsEnums.paths)}
+		candidate.Confidence = scoreMessageStructures(shapes, options.weights, msg, unobsMsg, func(check string, score, weight float64) {
+			candidate.Components = append(candidate.Components, ScoreComponent{check, score, weight})
+		})
+		candidate.Perfect = isPerfectStructureMatch(shapes, msg, unobsMsg)
+		for j := range obsEnums.paths {
+			for k := range unobsEnums[u].paths {
+				if isMatch, _ := compareEnums(obsEnums.values[j], unobsEnums[u].values[k], options); isMatch {
+					candidate.EnumsMatched++
+					break
+				}
+			}
+		}
+		candidate.Mismatches = structureMismatches(msg, unobsMsg)
+
+		switch {
+		case len(msg.Field) == 0 || len(unobsMsg.Field) == 0:
+			candidate.Rejection = "no fields to compare"
+		case !shapes.namesAgree(msg, unobsMsg):
+			candidate.Rejection = "the names left clear by the obfuscator differ"
+		case !shapes.mayMatch(msg, unobsMsg, threshold, options.weights):
+			candidate.Rejection = fmt.Sprintf("ruled out by the counts, which can't reach the %.0f%% threshold", threshold)
+		case candidate.Confidence < threshold:
+			candidate.Rejection = fmt.Sprintf("confidence %.2f%% below the %.0f%% threshold", candidate.Confidence, threshold)
+		}
+		candidates[u] = candidate
+	}
+
+	// Enum matches come first in the order the enum matcher tries them, then
+	// the structure ones
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		aEnums, bEnums := a.Enums > 0 && a.EnumsMatched == a.Enums, b.Enums > 0 && b.EnumsMatched == b.Enums
+		if aEnums || bEnums {
+			return aEnums && !bEnums
+		}
+		return a.Confidence > b.Confidence
+	})
+	return candidates
+}
+
+// structureMismatches lists what differs between the structures of two
+// messages, as checked by compareMessageStructures
+func structureMismatches(obfs, unobs *descriptor.MessageType) []string {
+	var mismatches []string
+	if len(obfs.Field) != len(unobs.Field) {
+		mismatches = append(mismatches, fmt.Sprintf("field count %d vs %d", len(obfs.Field), len(unobs.Field)))
+	}
+	for i := 0; i < min(len(obfs.Field), len(unobs.Field)); i++ {
+		a, b := &obfs.Field[i], &unobs.Field[i]
+		if a.Label != b.Label {
+			mismatches = append(mismatches, fmt.Sprintf("field %d label mismatch %s vs %s", a.Number, labelName(a.Label), labelName(b.Label)))
+		}
+		if !compareTypes(a.Type, b.Type) {
+			reason := fmt.Sprintf("field %d type mismatch %s vs %s", a.Number, a.Type, b.Type)
+			_, aPrimitive := primitiveTypes[a.Type]
+			_, bPrimitive := primitiveTypes[b.Type]
+			if !aPrimitive || !bPrimitive {
+				reason += " (only int32, int64, string and bool compare equal)"
+			}
+			mismatches = append(mismatches, reason)
+		}
+	}
+	if len(obfs.OneOfDecl) != len(unobs.OneOfDecl) {
+		mismatches = append(mismatches, fmt.Sprintf("oneof count %d vs %d", len(obfs.OneOfDecl), len(unobs.OneOfDecl)))
+	}
+	if len(obfs.NestedType) != len(unobs.NestedType) {
+		mismatches = append(mismatches, fmt.Sprintf("nested message count %d vs %d", len(obfs.NestedType), len(unobs.NestedType)))
+	}
+	return mismatches
+}
+
+func labelName(label string) string {
+	if label == "" {
+		return "singular"
+	}
+	return label
+}
@@ -0,0 +1,61 @@
+package match
+
+import (
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+)
+
+// FieldNumberMismatch is a field of an obfuscated message aligned by the
+// structure matchers with an original field of another number
+type FieldNumberMismatch struct {
+	Position         int // Index of the field in both messages
+	Obfuscated       string
+	ObfuscatedNumber int
+	Original         string
+	OriginalNumber   int
+}
+
+// SuspiciousMatch is a match whose aligned fields disagree on their numbers
+type SuspiciousMatch struct {
+	Match      MessageMatch
+	Mismatches []FieldNumberMismatch
+}
+
+// FindFieldNumberMismatches checks that the fields of every match have the
+// numbers of the original fields they align with: same position, label and
+// type. The obfuscation keeps the field numbers, so a disagreement usually
+// means a wrong match rather than a renumbering.
+func FindFieldNumberMismatches(matches []MessageMatch, obfuscated, unobfuscated *descriptor.Descriptor) []SuspiciousMatch {
+	obsMsgs := topLevelMessages(obfuscated)
+	unobsMsgs := topLevelMessages(unobfuscated)
+
+	var suspicious []SuspiciousMatch
+	for _, match := range mapping.SortedMatches(matches) {
+		obsMsg, unobsMsg := obsMsgs[match.ObfuscatedMsg], unobsMsgs[match.OriginalMsg]
+		if obsMsg == nil || unobsMsg == nil {
+			continue
+		}
+		if mismatches := fieldNumberMismatches(obsMsg, unobsMsg); len(mismatches) > 0 {
+			suspicious = append(suspicious, SuspiciousMatch{Match: match, Mismatches: mismatches})
+		}
+	}
+	return suspicious
+}
+
+// fieldNumberMismatches aligns the fields like compareMessageStructures does
+func fieldNumberMismatches(obfs, unobs *descriptor.MessageType) []FieldNumberMismatch {
+	var mismatches []FieldNumberMismatch
+	for i := 0; i < min(len(obfs.Field), len(unobs.Field)); i++ {
+		a, b := &obfs.Field[i], &unobs.Field[i]
+		if compareFields(a, b) && a.Number != b.Number {
+			mismatches = append(mismatches, FieldNumberMismatch{
+				Position:         i,
+				Obfuscated:       a.Name,
+				ObfuscatedNumber: a.Number,
+				Original:         b.Name,
+				OriginalNumber:   b.Number,
+			})
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,178 @@
+package match
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+)
+
+// structureKey holds the counts two messages must share to be a perfect
+// structure match. Enums aren't part of it, the structure comparison ignores them.
+type structureKey struct {
+	fields, oneofs, nested int
+}
+
+func structureKeyOf(msg *descriptor.MessageType) structureKey {
+	return structureKey{len(msg.Field), len(msg.OneOfDecl), len(msg.NestedType)}
+}
+
+// indexedMessage is an original message with its position in the corpus,
+// which orders the candidates read from several buckets
+type indexedMessage struct {
+	msg   *descriptor.MessageType
+	order int
+}
+
+// clearCorpus buckets the original messages by structureKey, so a message is
+// only compared with the ones whose counts can match it. Buckets keep the
+// order of the corpus. Messages without fields never match and are left out.
+type clearCorpus interface {
+	// keys returns the keys of the buckets, ordered by their counts
+	keys() []structureKey
+	// bucket returns the messages of a bucket, none for an unknown key
+	bucket(key structureKey) ([]indexedMessage, error)
+}
+
+// memoryCorpus is the clearCorpus of a descriptor in memory
+type memoryCorpus struct {
+	buckets map[structureKey][]indexedMessage
+	sorted  []structureKey
+}
+
+func newMemoryCorpus(unobfuscated *descriptor.Descriptor) *memoryCorpus {
+	corpus := &memoryCorpus{buckets: make(map[structureKey][]indexedMessage)}
+	for i, msg := range messagePointers(unobfuscated.MessageType) {
+		if len(msg.Field) == 0 {
+			continue
+		}
+		key := structureKeyOf(msg)
+		if _, ok := corpus.buckets[key]; !ok {
+			corpus.sorted = append(corpus.sorted, key)
+		}
+		corpus.buckets[key] = append(corpus.buckets[key], indexedMessage{msg, i})
+	}
+	sortStructureKeys(corpus.sorted)
+	return corpus
+}
+
+func (c *memoryCorpus) keys() []structureKey { return c.sorted }
+
+func (c *memoryCorpus) bucket(key structureKey) ([]indexedMessage, error) {
+	return c.buckets[key], nil
+}
+
+func sortStructureKeys(keys []structureKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.fields != b.fields {
+			return a.fields < b.fields
+		}
+		if a.oneofs != b.oneofs {
+			return a.oneofs < b.oneofs
+		}
+		return a.nested < b.nested
+	})
+}
+
+// ClearIndex is an on-disk clearCorpus, for the chunked runs: the structure
+// matchers read the buckets the messages of a chunk need from a file instead
+// of holding the derived data of the whole original corpus. Close removes
+// the file.
+type ClearIndex struct {
+	file    *os.File
+	buckets map[structureKey]indexBucket
+	sorted  []structureKey
+}
+
+// indexBucket is where the JSON of a bucket is in the index file
+type indexBucket struct {
+	offset, length int64
+}
+
+// indexEntry is an original message as written to the index. The source file
+// isn't part of the JSON of a message.
+type indexEntry struct {
+	Order   int                    `json:"order"`
+	File    string                 `json:"file"`
+	Message descriptor.MessageType `json:"message"`
+}
+
+// NewClearIndex writes the index of the original messages to a new file of
+// dir, the temporary directory when empty
+func NewClearIndex(dir string, unobfuscated *descriptor.Descriptor) (*ClearIndex, error) {
+	file, err := os.CreateTemp(dir, "deobfs-index-*")
+	if err != nil {
+		return nil, err
+	}
+	index := &ClearIndex{file: file, buckets: make(map[structureKey]indexBucket)}
+
+	corpus := newMemoryCorpus(unobfuscated)
+	writer := bufio.NewWriter(file)
+	var offset int64
+	for _, key := range corpus.keys() {
+		messages, _ := corpus.bucket(key)
+		entries := make([]indexEntry, len(messages))
+		for i, indexed := range messages {
+			entries[i] = indexEntry{Order: indexed.order, File: indexed.msg.SourceFile, Message: *indexed.msg}
+		}
+		data, err := json.Marshal(entries)
+		if err == nil {
+			_, err = writer.Write(data)
+		}
+		if err != nil {
+			index.Close()
+			return nil, fmt.Errorf("writing the clear index: %w", err)
+		}
+		index.buckets[key] = indexBucket{offset, int64(len(data))}
+		index.sorted = append(index.sorted, key)
+		offset += int64(len(data))
+	}
+	if err := writer.Flush(); err != nil {
+		index.Close()
+		return nil, fmt.Errorf("writing the clear index: %w", err)
+	}
+	return index, nil
+}
+
+func (index *ClearIndex) keys() []structureKey { return index.sorted }
+
+func (index *ClearIndex) bucket(key structureKey) ([]indexedMessage, error) {
+	location, ok := index.buckets[key]
+	if !ok {
+		return nil, nil
+	}
+	var entries []indexEntry
+	if err := json.NewDecoder(io.NewSectionReader(index.file, location.offset, location.length)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("reading the clear index: %w", err)
+	}
+	messages := make([]indexedMessage, len(entries))
+	for i := range entries {
+		entries[i].Message.SourceFile = entries[i].File
+		messages[i] = indexedMessage{&entries[i].Message, entries[i].Order}
+	}
+	return messages, nil
+}
+
+// Close closes and removes the index file
+func (index *ClearIndex) Close() error {
+	err := index.file.Close()
+	if removeErr := os.Remove(index.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// messagePointers returns pointers to the messages of a descriptor, so the
+// matchers can pass them around without copying their nested slices
+func messagePointers(messages []descriptor.MessageType) []*descriptor.MessageType {
+	pointers := make([]*descriptor.MessageType, len(messages))
+	for i := range messages {
+		pointers[i] = &messages[i]
+	}
+	return pointers
+}
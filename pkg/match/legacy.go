@@ -0,0 +1,165 @@
+package match
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+)
+
+// Legacy hints are only suggested for messages with enough fields to be
+// meaningful, and never more than a few per message
+const (
+	legacyMinFields      = 2
+	legacyMaxSuggestions = 3
+	legacyMinConfidence  = 80.0
+)
+
+// LegacyField is a field of a Dofus 2.x ActionScript message
+type LegacyField struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // ActionScript type, like uint, String or Vector.<int>
+}
+
+// LegacyMessage is a message of the Dofus 2.x protocol
+type LegacyMessage struct {
+	Name   string        `json:"name"`
+	Fields []LegacyField `json:"fields"`
+}
+
+// LegacyHint is a low-confidence name suggestion for an obfuscated message,
+// from a Dofus 2.x message with a similar structure
+type LegacyHint struct {
+	ObfuscatedMsg  string
+	ObfuscatedFile string
+	LegacyNames    []string
+	Confidence     float64
+}
+
+// FindLegacyHints suggests Dofus 2.x names for the messages left unmatched,
+// comparing the kind of their fields in order. Ankama reused many concepts
+// of the 2.x protocol, but field types changed often, so these are hints
+// for a human and never applied.
+func FindLegacyHints(
+	obfuscated *descriptor.Descriptor,
+	legacy []LegacyMessage,
+	previousMatches []MessageMatch,
+	logger *slog.Logger,
+) []LegacyHint {
+	matched := make(map[string]bool)
+	for _, pm := range previousMatches {
+		if len(pm.Alternatives) == 0 {
+			matched[pm.ObfuscatedMsg] = true
+		}
+	}
+
+	var hints []LegacyHint
+	for _, obsMsg := range obfuscated.MessageType {
+		if matched[obsMsg.Name] || len(obsMsg.Field) < legacyMinFields {
+			continue
+		}
+
+		obsKinds := make([]string, len(obsMsg.Field))
+		fields := append([]descriptor.Field{}, obsMsg.Field...)
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Number < fields[j].Number })
+		for i, field := range fields {
+			obsKinds[i] = protoFieldKind(field)
+		}
+
+		best := 0.0
+		var names []string
+		for _, legacyMsg := range legacy {
+			if len(legacyMsg.Fields) != len(obsKinds) {
+				continue
+			}
+
+			same := 0
+			for i, field := range legacyMsg.Fields {
+				if legacyFieldKind(field.Type) == obsKinds[i] {
+					same++
+				}
+			}
+			confidence := float64(same) / float64(len(obsKinds)) * 100
+			switch {
+			case confidence < legacyMinConfidence || confidence < best:
+				continue
+			case confidence > best:
+				best, names = confidence, nil
+			}
+			names = append(names, legacyMsg.Name)
+		}
+
+		// Too many candidates means the structure is too common to tell anything
+		if len(names) == 0 || len(names) > legacyMaxSuggestions {
+			continue
+		}
+		hints = append(hints, LegacyHint{
+			ObfuscatedMsg:  obsMsg.Name,
+			ObfuscatedFile: obsMsg.SourceFile,
+			LegacyNames:    names,
+			Confidence:     best,
+		})
+	}
+
+	// Same for a legacy message resembling many obfuscated ones
+	suggested := make(map[string]int)
+	for _, hint := range hints {
+		for _, name := range hint.LegacyNames {
+			suggested[name]++
+		}
+	}
+	kept := hints[:0]
+	for _, hint := range hints {
+		var names []string
+		for _, name := range hint.LegacyNames {
+			if suggested[name] <= legacyMaxSuggestions {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			hint.LegacyNames = names
+			kept = append(kept, hint)
+		}
+	}
+	hints = kept
+
+	logger.Info("legacy name hints", "hints", len(hints), "legacy", len(legacy))
+	return hints
+}
+
+// protoFieldKind reduces a proto field type to what can be compared with ActionScript
+func protoFieldKind(field descriptor.Field) string {
+	if field.Label == "repeated" || strings.HasPrefix(field.Type, "map<") {
+		return "list"
+	}
+	switch field.Type {
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64", "fixed32", "fixed64", "sfixed32", "sfixed64", "double", "float":
+		return "number"
+	case "string":
+		return "string"
+	case "bool":
+		return "bool"
+	case "bytes":
+		return "list"
+	}
+	// Messages and enums
+	return "object"
+}
+
+// legacyFieldKind reduces an ActionScript type to what can be compared with protos
+func legacyFieldKind(asType string) string {
+	if strings.HasPrefix(asType, "Vector.") || asType == "ByteArray" || asType == "Array" {
+		return "list"
+	}
+	switch strings.ToLower(asType) {
+	case "int", "uint", "number", "short", "ushort", "byte", "ubyte", "float", "double",
+		"varint", "varuint", "varshort", "varushort", "varlong", "varulong":
+		return "number"
+	case "string":
+		return "string"
+	case "boolean":
+		return "bool"
+	}
+	return "object"
+}
@@ -0,0 +1,146 @@
+// Package match runs the matchers of the deobfuscator, pairing obfuscated
+// messages with their clear counterparts.
+package match
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/event"
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+)
+
+// The matches found by the matchers
+type (
+	MessageMatch = mapping.MessageMatch
+	EnumMatch    = mapping.EnumMatch
+	Alternative  = mapping.Alternative
+	// MatcherStats are the counters of one matcher over a run
+	MatcherStats = PhaseStats
+	// Event is a step of a run: a file parsed, a match found, a pass or a
+	// stage complete
+	Event        = event.Event
+	EventKind    = event.Kind
+	EventHandler = event.Handler
+)
+
+// The kinds of events
+const (
+	EventFileParsed    = event.FileParsed
+	EventMatchFound    = event.MatchFound
+	EventMatchRejected = event.MatchRejected
+	EventPassComplete  = event.PassComplete
+	EventStageStarted  = event.StageStarted
+	EventStageComplete = event.StageComplete
+	EventProgress      = event.Progress
+)
+
+// WithEvents returns a context whose loads and matches send their events to
+// handler, for front-ends rendering a run live
+func WithEvents(ctx context.Context, handler EventHandler) context.Context {
+	return event.WithHandler(ctx, handler)
+}
+
+// Options configures a Match run. The zero value runs the default pipeline
+// at once, without logs.
+type Options struct {
+	Logger *slog.Logger
+	// Timer records the time spent in each matcher, when set
+	Timer *PhaseTimer
+	// Progress receives the progress of the matchers, a private
+	// MatchingProgress when nil
+	Progress ProgressReporter
+	// Pipeline lists the matchers to run in order, DefaultPipeline when nil
+	Pipeline []Stage
+	// Matchers, when set, are run in order instead of the Pipeline
+	Matchers []Matcher
+	// Seeds are matches known beforehand, whose messages the matchers of the
+	// Pipeline skip
+	Seeds []MessageMatch
+	// Rejections are pairs known to be wrong, like the rejected seeds, which
+	// the matchers of the Pipeline never make
+	Rejections []MessageMatch
+	// ChunkSize has the stages of the Pipeline match the obfuscated messages
+	// this many at a time, the structure ones against an on-disk index of the
+	// clear messages. The corpora stay in memory, and the enum matcher indexes
+	// every clear enum. The matches are the ones of a single run.
+	ChunkSize int
+	// IndexDir is where the index of the clear messages of a chunked run is
+	// written, the temporary directory when empty. It is removed at the end
+	// of the run.
+	IndexDir string
+}
+
+// Match runs the stages of the pipeline in turn, each one skipping what the
+// previous ones matched. It stops with the error of ctx when ctx is
+// cancelled.
+func Match(ctx context.Context, obfuscated, clear *descriptor.Descriptor, options Options) (*MatchResult, error) {
+	matchers := options.Matchers
+	if matchers == nil {
+		if options.Pipeline == nil {
+			options.Pipeline = DefaultPipeline()
+		}
+		if err := ValidatePipeline(options.Pipeline); err != nil {
+			return nil, err
+		}
+		opts := []Option{WithSeeds(options.Seeds), WithRejections(options.Rejections)}
+		if options.ChunkSize > 0 {
+			index, err := NewClearIndex(options.IndexDir, clear)
+			if err != nil {
+				return nil, err
+			}
+			defer index.Close()
+			opts = append(opts, WithChunks(options.ChunkSize, index))
+		}
+		for _, stage := range options.Pipeline {
+			if stage.Disabled {
+				continue
+			}
+			matcher, err := NewMatcher(stage, opts...)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, matcher)
+		}
+	}
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if options.Progress == nil {
+		options.Progress = &MatchingProgress{}
+	}
+	matches, err := matchAll(ctx, obfuscated, clear, matchers, options, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []MatcherStats
+	seen := make(map[string]bool)
+	for _, matcher := range matchers {
+		if !seen[matcher.Name()] {
+			seen[matcher.Name()] = true
+			stats = append(stats, options.Progress.Phase(matcher.Name()).Stats())
+		}
+	}
+	return NewMatchResult(matches, obfuscated, clear, stats), nil
+}
+
+func matchAll(ctx context.Context, obfuscated, clear *descriptor.Descriptor, matchers []Matcher, options Options, logger *slog.Logger) ([]MessageMatch, error) {
+	options.Progress.Init(len(obfuscated.MessageType))
+	var matches []MessageMatch
+	for _, matcher := range matchers {
+		event.Emit(ctx, event.Event{Kind: event.StageStarted, Matcher: matcher.Name()})
+		done := options.Timer.Start(matcher.Name())
+		found, err := matcher.Match(ctx, obfuscated, clear, matches, options.Progress, logger)
+		done()
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+		event.Emit(ctx, event.Event{Kind: event.StageComplete, Matcher: matcher.Name(), Matches: len(found)})
+	}
+	return matches, nil
+}
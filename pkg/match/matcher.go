@@ -0,0 +1,245 @@
+package match
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+)
+
+// Matcher pairs obfuscated messages with original ones, skipping the messages
+// of the previous matches
+type Matcher interface {
+	// Name is the name of the matcher in the pipeline and in the progress
+	Name() string
+	Match(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, previous []MessageMatch, progress ProgressReporter, logger *slog.Logger) ([]MessageMatch, error)
+}
+
+// DefaultThreshold is the confidence a structure match needs by default
+const DefaultThreshold = 80
+
+// Weights are the weights of the scores averaged into the confidence of a
+// structure match
+type Weights struct {
+	FieldCount  float64 `json:"fieldCount"`
+	FieldTypes  float64 `json:"fieldTypes"`
+	OneofCount  float64 `json:"oneofCount"`
+	OneofFields float64 `json:"oneofFields"` // For each pair of oneofs
+	NestedCount float64 `json:"nestedCount"`
+}
+
+// DefaultWeights weighs every score the same
+var DefaultWeights = Weights{FieldCount: 1, FieldTypes: 1, OneofCount: 1, OneofFields: 1, NestedCount: 1}
+
+// Option configures a matcher. Matchers ignore the options they don't use.
+type Option func(*matcherOptions)
+
+type matcherOptions struct {
+	exact     bool
+	fuzzy     bool
+	threshold float64
+	weights   Weights
+	seeds     []MessageMatch
+	rejected  map[[2]string]bool
+	chunkSize int
+	index     *ClearIndex
+}
+
+func newMatcherOptions(opts []Option) matcherOptions {
+	options := matcherOptions{weights: DefaultWeights}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithExactEnums only pairs enums with the same values. By default an enum
+// matches when all the values of the smaller one are in the other. (enum)
+func WithExactEnums(exact bool) Option {
+	return func(o *matcherOptions) { o.exact = exact }
+}
+
+// WithFuzzyEnums also pairs the messages whose enums only resemble the
+// original ones by their value numbers and the fields using them, for value
+// names obfuscated too. These matches have a lower confidence. (enum)
+func WithFuzzyEnums(fuzzy bool) Option {
+	return func(o *matcherOptions) { o.fuzzy = fuzzy }
+}
+
+// WithThreshold sets the confidence in percent a match needs. The relaxed
+// matcher needs DefaultThreshold and the envelope members FuzzyThreshold
+// without it, the other matchers keep every match.
+func WithThreshold(threshold float64) Option {
+	return func(o *matcherOptions) { o.threshold = threshold }
+}
+
+// thresholdOr returns the threshold set by WithThreshold, or fallback
+func (o matcherOptions) thresholdOr(fallback float64) float64 {
+	if o.threshold == 0 {
+		return fallback
+	}
+	return o.threshold
+}
+
+// WithWeights sets the weights of the scores making the confidence (relaxed)
+func WithWeights(weights Weights) Option {
+	return func(o *matcherOptions) { o.weights = weights }
+}
+
+// WithSeeds gives matches known beforehand, whose messages the matcher skips
+// like the ones of the previous matches
+func WithSeeds(seeds []MessageMatch) Option {
+	return func(o *matcherOptions) { o.seeds = seeds }
+}
+
+// WithRejections gives pairs known to be wrong, which the matcher never
+// makes: their obfuscated message falls back to its next candidate
+func WithRejections(rejected []MessageMatch) Option {
+	return func(o *matcherOptions) {
+		o.rejected = make(map[[2]string]bool, len(rejected))
+		for _, pair := range rejected {
+			o.rejected[[2]string{pair.ObfuscatedMsg, pair.OriginalMsg}] = true
+		}
+	}
+}
+
+// rejects tells whether the pair of obfuscated and original is rejected
+func (o matcherOptions) rejects(obfuscated, original string) bool {
+	return o.rejected[[2]string{obfuscated, original}]
+}
+
+// WithChunks matches the obfuscated messages size at a time, reading the
+// original messages from index when it isn't nil. The matches are the ones of
+// a single run. (enum, strict_structure, relaxed)
+func WithChunks(size int, index *ClearIndex) Option {
+	return func(o *matcherOptions) { o.chunkSize, o.index = size, index }
+}
+
+// chunkOf returns the size of the chunks of n obfuscated messages
+func (o matcherOptions) chunkOf(n int) int {
+	if o.chunkSize > 0 {
+		return o.chunkSize
+	}
+	return max(n, 1)
+}
+
+// corpus returns the buckets of the original messages, from the index of
+// WithChunks when set
+func (o matcherOptions) corpus(unobfuscated *descriptor.Descriptor) clearCorpus {
+	if o.index != nil {
+		return o.index
+	}
+	return newMemoryCorpus(unobfuscated)
+}
+
+// known returns the seeds followed by the previous matches
+func (o matcherOptions) known(previous []MessageMatch) []MessageMatch {
+	if len(o.seeds) == 0 {
+		return previous
+	}
+	return append(append([]MessageMatch{}, o.seeds...), previous...)
+}
+
+type clearNameMatcher struct{ options matcherOptions }
+
+// NewClearNameMatcher returns the matcher pairing the top-level messages
+// whose name isn't obfuscated with their namesake
+func NewClearNameMatcher(opts ...Option) Matcher {
+	return &clearNameMatcher{newMatcherOptions(opts)}
+}
+
+func (m *clearNameMatcher) Name() string { return MatcherClearName }
+
+func (m *clearNameMatcher) Match(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, previous []MessageMatch, progress ProgressReporter, logger *slog.Logger) ([]MessageMatch, error) {
+	counters := progress.Phase(MatcherClearName)
+	start := time.Now()
+	defer func() { counters.AddTime(time.Since(start)) }()
+
+	known := m.options.known(previous)
+	matched := make(map[string]bool, len(known))
+	for _, match := range known {
+		matched[match.ObfuscatedMsg] = true
+	}
+	remaining := 0
+	for _, msg := range obfuscated.MessageType {
+		if !matched[msg.Name] {
+			remaining++
+		}
+	}
+	counters.Start(remaining)
+	defer counters.Finish()
+
+	matches := findClearNameMatches(ctx, obfuscated, unobfuscated, known, m.options)
+	counters.AddProcessed(remaining)
+	counters.AddMatches(len(matches))
+	progress.AddMatches(len(matches))
+	if len(matches) > 0 {
+		logger.Info("messages with clear names", "matches", len(matches))
+	}
+	return matches, nil
+}
+
+type enumMatcher struct{ options matcherOptions }
+
+// NewEnumMatcher returns the matcher pairing the messages whose enums all match
+func NewEnumMatcher(opts ...Option) Matcher {
+	return &enumMatcher{newMatcherOptions(opts)}
+}
+
+func (m *enumMatcher) Name() string { return MatcherEnum }
+
+func (m *enumMatcher) Match(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, previous []MessageMatch, progress ProgressReporter, logger *slog.Logger) ([]MessageMatch, error) {
+	// The enums don't care for the other matches, only the messages they leave count
+	matchedObfuscated := make(map[string]bool)
+	matchedUnobfuscated := make(map[string]bool)
+	for _, match := range m.options.known(previous) {
+		matchedObfuscated[match.ObfuscatedMsg] = true
+		matchedUnobfuscated[match.OriginalMsg] = true
+	}
+	return findEnumBasedMatches(ctx,
+		descriptor.WithoutMessages(obfuscated, matchedObfuscated), descriptor.WithoutMessages(unobfuscated, matchedUnobfuscated),
+		m.options, progress, logger)
+}
+
+type strictStructureMatcher struct{ options matcherOptions }
+
+// NewStrictStructureMatcher returns the matcher pairing the messages with a
+// single perfectly matching structure
+func NewStrictStructureMatcher(opts ...Option) Matcher {
+	return &strictStructureMatcher{newMatcherOptions(opts)}
+}
+
+func (m *strictStructureMatcher) Name() string { return MatcherStrictStructure }
+
+func (m *strictStructureMatcher) Match(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, previous []MessageMatch, progress ProgressReporter, logger *slog.Logger) ([]MessageMatch, error) {
+	return findStrictStructureBasedMatches(ctx, obfuscated, unobfuscated, m.options.known(previous), m.options, progress, logger)
+}
+
+type relaxedMatcher struct{ options matcherOptions }
+
+// NewRelaxedMatcher returns the matcher pairing the messages with a close
+// enough structure, keeping the ties as uncertain matches
+func NewRelaxedMatcher(opts ...Option) Matcher {
+	return &relaxedMatcher{newMatcherOptions(opts)}
+}
+
+func (m *relaxedMatcher) Name() string { return MatcherRelaxed }
+
+func (m *relaxedMatcher) Match(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, previous []MessageMatch, progress ProgressReporter, logger *slog.Logger) ([]MessageMatch, error) {
+	return findStructureBasedMatches(ctx, obfuscated, unobfuscated, m.options.known(previous), m.options, progress, logger)
+}
+
+type envelopeMatcher struct{ options matcherOptions }
+
+// NewEnvelopeMatcher returns the matcher pairing the envelopes by their number
+// of members, then the members of the paired messages by field number
+func NewEnvelopeMatcher(opts ...Option) Matcher {
+	return &envelopeMatcher{newMatcherOptions(opts)}
+}
+
+func (m *envelopeMatcher) Name() string { return MatcherEnvelope }
+
+func (m *envelopeMatcher) Match(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, previous []MessageMatch, progress ProgressReporter, logger *slog.Logger) ([]MessageMatch, error) {
+	return findEnvelopeBasedMatches(ctx, obfuscated, unobfuscated, m.options.known(previous), m.options, progress, logger)
+}
@@ -0,0 +1,104 @@
+package match
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sync"
+)
+
+// forEachParallel calls fn for every index in [0, n) across GOMAXPROCS
+// goroutines. fn must only write to state owned by its index, so callers can
+// merge the results in order and stay deterministic. When ctx is cancelled,
+// the indexes not started yet are skipped and its error is returned.
+func forEachParallel(ctx context.Context, n int, fn func(i int)) error {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 {
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			fn(i)
+		}
+		return ctx.Err()
+	}
+
+	indexes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if ctx.Err() == nil {
+					fn(i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// taskLogs holds the logs of the tasks of forEachParallel apart, so they are
+// written in the order of the tasks rather than the one they ran in and the
+// debug logs are the same from one run to the next. Below the debug level
+// the tasks log directly.
+type taskLogs struct {
+	logger  *slog.Logger
+	records [][]loggedRecord
+}
+
+// loggedRecord is a record and the handler it goes to, holding the
+// attributes of the logger it was logged with
+type loggedRecord struct {
+	handler slog.Handler
+	record  slog.Record
+}
+
+func newTaskLogs(ctx context.Context, logger *slog.Logger, n int) *taskLogs {
+	logs := &taskLogs{logger: logger}
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logs.records = make([][]loggedRecord, n)
+	}
+	return logs
+}
+
+// task returns the logger of the task i
+func (l *taskLogs) task(i int) *slog.Logger {
+	if l.records == nil {
+		return l.logger
+	}
+	return slog.New(recordingHandler{l.logger.Handler(), &l.records[i]})
+}
+
+// flush writes the logs of the tasks in order
+func (l *taskLogs) flush(ctx context.Context) {
+	for i, records := range l.records {
+		for _, logged := range records {
+			logged.handler.Handle(ctx, logged.record)
+		}
+		l.records[i] = nil
+	}
+}
+
+// recordingHandler keeps the records the handler it wraps enables
+type recordingHandler struct {
+	slog.Handler
+	records *[]loggedRecord
+}
+
+func (h recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	*h.records = append(*h.records, loggedRecord{h.Handler, record.Clone()})
+	return nil
+}
+
+func (h recordingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return recordingHandler{h.Handler.WithAttrs(attrs), h.records}
+}
+
+func (h recordingHandler) WithGroup(name string) slog.Handler {
+	return recordingHandler{h.Handler.WithGroup(name), h.records}
+}
@@ -0,0 +1,105 @@
+package match
+
+import "fmt"
+
+// The matchers a pipeline stage can run
+const (
+	MatcherClearName       = "clear_name"       // Messages whose name isn't obfuscated, to their namesake
+	MatcherEnvelope        = "envelope"         // Envelopes by size, then their members by field number
+	MatcherEnum            = "enum"             // Messages sharing their enums
+	MatcherStrictStructure = "strict_structure" // Messages with a unique perfectly matching structure
+	MatcherRelaxed         = "relaxed"          // Messages with a close structure
+)
+
+// Stage is one step of the matching pipeline: a matcher and its options.
+// Options a matcher doesn't use are ignored.
+type Stage struct {
+	Matcher  string `json:"matcher"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// Exact only pairs enums with the same values (enum)
+	Exact bool `json:"exact,omitempty"`
+	// Fuzzy also pairs enums by their value numbers and the fields using
+	// them when their value names differ (enum)
+	Fuzzy bool `json:"fuzzy,omitempty"`
+	// Threshold is the confidence in percent a match of the stage needs. When
+	// zero the relaxed matcher needs DefaultThreshold, the envelope members
+	// 60 and the other matchers keep every match.
+	Threshold float64 `json:"threshold,omitempty"`
+	// Weights of the scores making the confidence, DefaultWeights when nil
+	// (relaxed)
+	Weights *Weights `json:"weights,omitempty"`
+}
+
+// NewMatcher returns the matcher of a stage with its options, followed by opts
+func NewMatcher(stage Stage, opts ...Option) (Matcher, error) {
+	opts = append(stage.Options(), opts...)
+	switch stage.Matcher {
+	case MatcherClearName:
+		return NewClearNameMatcher(opts...), nil
+	case MatcherEnvelope:
+		return NewEnvelopeMatcher(opts...), nil
+	case MatcherEnum:
+		return NewEnumMatcher(opts...), nil
+	case MatcherStrictStructure:
+		return NewStrictStructureMatcher(opts...), nil
+	case MatcherRelaxed:
+		return NewRelaxedMatcher(opts...), nil
+	}
+	return nil, fmt.Errorf("unknown matcher %q", stage.Matcher)
+}
+
+// Options returns the options the stage sets for its matcher
+func (s Stage) Options() []Option {
+	var opts []Option
+	if s.Threshold != 0 {
+		opts = append(opts, WithThreshold(s.Threshold))
+	}
+	switch s.Matcher {
+	case MatcherEnum:
+		opts = append(opts, WithExactEnums(s.Exact), WithFuzzyEnums(s.Fuzzy))
+	case MatcherRelaxed:
+		if s.Weights != nil {
+			opts = append(opts, WithWeights(*s.Weights))
+		}
+	}
+	return opts
+}
+
+// DefaultPipeline returns the stages run when none are given: clear names
+// first, the other matchers skipping them and using them as anchors, then
+// envelopes, enums, strict structures and relaxed structures
+func DefaultPipeline() []Stage {
+	return []Stage{
+		{Matcher: MatcherClearName},
+		{Matcher: MatcherEnvelope},
+		{Matcher: MatcherEnum},
+		{Matcher: MatcherStrictStructure},
+		{Matcher: MatcherRelaxed},
+	}
+}
+
+// ValidatePipeline checks that every stage names a known matcher with
+// options in range
+func ValidatePipeline(stages []Stage) error {
+	for i, stage := range stages {
+		if stage.Threshold < 0 || stage.Threshold > 100 {
+			return fmt.Errorf("stage %d (%s): threshold %v is not between 0 and 100", i+1, stage.Matcher, stage.Threshold)
+		}
+		switch stage.Matcher {
+		case MatcherClearName, MatcherEnvelope, MatcherEnum, MatcherStrictStructure:
+		case MatcherRelaxed:
+			if w := stage.Weights; w != nil {
+				if min(w.FieldCount, w.FieldTypes, w.OneofCount, w.OneofFields, w.NestedCount) < 0 {
+					return fmt.Errorf("stage %d (%s): weights can't be negative", i+1, stage.Matcher)
+				}
+				if w.FieldCount+w.FieldTypes == 0 {
+					return fmt.Errorf("stage %d (%s): the field count or field types weight must be positive", i+1, stage.Matcher)
+				}
+			}
+		default:
+			return fmt.Errorf("stage %d: unknown matcher %q, expected %s, %s, %s, %s or %s",
+				i+1, stage.Matcher, MatcherClearName, MatcherEnvelope, MatcherEnum, MatcherStrictStructure, MatcherRelaxed)
+		}
+	}
+	return nil
+}
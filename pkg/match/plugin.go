@@ -0,0 +1,113 @@
+package match
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+)
+
+// pluginRequest is written as JSON on the stdin of a matcher plugin
+type pluginRequest struct {
+	Obfuscated []descriptor.MessageType `json:"obfuscated"` // Messages left to match
+	Clear      []descriptor.MessageType `json:"clear"`      // Clear messages not matched yet
+	Matches    []MessageMatch           `json:"matches"`    // Matches found so far
+}
+
+// pluginResponse is read as JSON from the stdout of a matcher plugin
+type pluginResponse struct {
+	Matches []struct {
+		Obfuscated string  `json:"obfuscated"`
+		Original   string  `json:"original"`
+		Confidence float64 `json:"confidence"`
+	} `json:"matches"`
+}
+
+// FindPluginMatches runs an external matcher. The plugin receives the messages
+// left to match along with the current matches on stdin, and answers with the
+// pairs it proposes on stdout. Its stderr goes to ours, for debugging.
+func FindPluginMatches(
+	command string,
+	obfuscated, unobfuscated *descriptor.Descriptor,
+	previousMatches []MessageMatch,
+	logger *slog.Logger,
+) ([]MessageMatch, error) {
+	name := strings.TrimSuffix(filepath.Base(command), filepath.Ext(command))
+
+	matchedObfuscated := make(map[string]bool)
+	matchedUnobfuscated := make(map[string]bool)
+	for _, pm := range previousMatches {
+		matchedObfuscated[pm.ObfuscatedMsg] = true
+		if len(pm.Alternatives) == 0 {
+			matchedUnobfuscated[pm.OriginalMsg] = true
+		}
+	}
+
+	request := pluginRequest{Obfuscated: []descriptor.MessageType{}, Clear: []descriptor.MessageType{}, Matches: previousMatches}
+	obfuscatedByName := make(map[string]descriptor.MessageType)
+	unobfuscatedByName := make(map[string]descriptor.MessageType)
+	for _, msg := range obfuscated.MessageType {
+		if !matchedObfuscated[msg.Name] {
+			request.Obfuscated = append(request.Obfuscated, msg)
+			obfuscatedByName[msg.Name] = msg
+		}
+	}
+	for _, msg := range unobfuscated.MessageType {
+		if !matchedUnobfuscated[msg.Name] {
+			request.Clear = append(request.Clear, msg)
+			unobfuscatedByName[msg.Name] = msg
+		}
+	}
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command(command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &output
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running plugin %s: %w", name, err)
+	}
+
+	var response pluginResponse
+	if err := json.Unmarshal(output.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("invalid response from plugin %s: %w", name, err)
+	}
+
+	// Only keep sane proposals: known messages, each one used once
+	var matches []MessageMatch
+	proposedObfuscated := make(map[string]bool)
+	proposedUnobfuscated := make(map[string]bool)
+	for _, proposal := range response.Matches {
+		obsMsg, okObs := obfuscatedByName[proposal.Obfuscated]
+		unobsMsg, okUnobs := unobfuscatedByName[proposal.Original]
+		if !okObs || !okUnobs || proposedObfuscated[obsMsg.Name] || proposedUnobfuscated[unobsMsg.Name] {
+			logger.Warn("ignoring plugin match", "plugin", name, "obfuscated", proposal.Obfuscated, "original", proposal.Original)
+			continue
+		}
+		proposedObfuscated[obsMsg.Name] = true
+		proposedUnobfuscated[unobsMsg.Name] = true
+
+		matches = append(matches, MessageMatch{
+			ObfuscatedMsg:  obsMsg.Name,
+			ObfuscatedFile: obsMsg.SourceFile,
+			OriginalMsg:    unobsMsg.Name,
+			OriginalFile:   unobsMsg.SourceFile,
+			MatchPercent:   min(max(proposal.Confidence, 0), 100),
+			Matcher:        "plugin:" + name,
+		})
+	}
+
+	logger.Info("plugin matching done", "plugin", name, "proposed", len(response.Matches), "accepted", len(matches))
+	return matches, nil
+}
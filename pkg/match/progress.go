@@ -0,0 +1,192 @@
+package match
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressReporter receives the progress of the matchers of a run. Each run
+// gets its own, so concurrent runs don't mix their counts, and front-ends can
+// provide theirs to display it.
+type ProgressReporter interface {
+	// Init starts a run over total obfuscated messages
+	Init(total int)
+	// AddMatches counts definitive matches
+	AddMatches(count int)
+	// GetProgress returns the share of the messages matched so far, in percent
+	GetProgress() float64
+	// Phase returns the counters of a matcher
+	Phase(name string) *PhaseCounters
+}
+
+// MatchingProgress is the default ProgressReporter, safe for concurrent use.
+// The zero value is ready to use.
+type MatchingProgress struct {
+	totalMessages int64
+	matchedSoFar  int64
+
+	mu     sync.Mutex
+	phases []*PhaseCounters
+}
+
+func (p *MatchingProgress) Init(total int) {
+	atomic.StoreInt64(&p.totalMessages, int64(total))
+	atomic.StoreInt64(&p.matchedSoFar, 0)
+}
+
+func (p *MatchingProgress) AddMatches(count int) {
+	atomic.AddInt64(&p.matchedSoFar, int64(count))
+}
+
+func (p *MatchingProgress) GetProgress() float64 {
+	total := atomic.LoadInt64(&p.totalMessages)
+	if total == 0 {
+		return 0
+	}
+	matched := atomic.LoadInt64(&p.matchedSoFar)
+	return float64(matched) / float64(total) * 100
+}
+
+// PhaseCounters counts the work of one matcher. They add up over the calls
+// of the matcher.
+type PhaseCounters struct {
+	Name        string
+	total       int64
+	running     int64
+	started     int32
+	processed   int64
+	candidates  int64
+	comparisons int64
+	matches     int64
+	nanos       int64
+}
+
+// Start counts total more obfuscated messages for the matcher to go
+// through, the matcher calls Finish once done with them
+func (c *PhaseCounters) Start(total int) {
+	atomic.AddInt64(&c.total, int64(total))
+	atomic.AddInt64(&c.running, 1)
+	atomic.StoreInt32(&c.started, 1)
+}
+
+// Finish marks the end of a call to the matcher
+func (c *PhaseCounters) Finish() {
+	atomic.AddInt64(&c.running, -1)
+}
+
+// Progress returns the share of its messages the matcher matched, in percent.
+// Each matcher works on what the previous ones left, so the ratios of the
+// phases don't add up.
+func (c *PhaseCounters) Progress() float64 {
+	total := atomic.LoadInt64(&c.total)
+	if total == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&c.matches)) / float64(total) * 100
+}
+
+// Complete tells whether the matcher ran and every call to it finished
+func (c *PhaseCounters) Complete() bool {
+	return atomic.LoadInt32(&c.started) == 1 && atomic.LoadInt64(&c.running) == 0
+}
+
+// AddProcessed counts obfuscated messages the matcher is done with
+func (c *PhaseCounters) AddProcessed(count int) {
+	atomic.AddInt64(&c.processed, int64(count))
+}
+
+// AddCandidates counts original messages considered for an obfuscated one
+func (c *PhaseCounters) AddCandidates(count int) {
+	atomic.AddInt64(&c.candidates, int64(count))
+}
+
+// AddComparisons counts full comparisons of a pair of messages
+func (c *PhaseCounters) AddComparisons(count int) {
+	atomic.AddInt64(&c.comparisons, int64(count))
+}
+
+// AddMatches counts accepted matches
+func (c *PhaseCounters) AddMatches(count int) {
+	atomic.AddInt64(&c.matches, int64(count))
+}
+
+// AddTime counts time spent in the matcher
+func (c *PhaseCounters) AddTime(d time.Duration) {
+	atomic.AddInt64(&c.nanos, int64(d))
+}
+
+// PhaseStats is a snapshot of the counters of a matcher
+type PhaseStats struct {
+	Matcher     string        `json:"matcher"`
+	Total       int64         `json:"total"` // Obfuscated messages the matcher went through
+	Complete    bool          `json:"complete"`
+	Processed   int64         `json:"processed"` // Obfuscated messages gone through so far
+	Candidates  int64         `json:"candidates"`
+	Comparisons int64         `json:"comparisons"`
+	Matches     int64         `json:"matches"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Stats returns the current values of the counters
+func (c *PhaseCounters) Stats() PhaseStats {
+	return PhaseStats{
+		Matcher:     c.Name,
+		Total:       atomic.LoadInt64(&c.total),
+		Complete:    c.Complete(),
+		Processed:   atomic.LoadInt64(&c.processed),
+		Candidates:  atomic.LoadInt64(&c.candidates),
+		Comparisons: atomic.LoadInt64(&c.comparisons),
+		Matches:     atomic.LoadInt64(&c.matches),
+		Duration:    time.Duration(atomic.LoadInt64(&c.nanos)),
+	}
+}
+
+// Phase returns the counters of a matcher, creating them on first use
+func (p *MatchingProgress) Phase(name string) *PhaseCounters {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, phase := range p.phases {
+		if phase.Name == name {
+			return phase
+		}
+	}
+	phase := &PhaseCounters{Name: name}
+	p.phases = append(p.phases, phase)
+	return phase
+}
+
+// Phases returns the counters of every matcher so far, in the order they
+// started, for front-ends polling the progress of each one
+func (p *MatchingProgress) Phases() []PhaseStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]PhaseStats, len(p.phases))
+	for i, phase := range p.phases {
+		stats[i] = phase.Stats()
+	}
+	return stats
+}
+
+// LogPhases logs the counters of every matcher, in the order they ran
+func (p *MatchingProgress) LogPhases(logger *slog.Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, phase := range p.phases {
+		stats := phase.Stats()
+		logger.Info("matcher summary",
+			"matcher", stats.Matcher,
+			"total", stats.Total,
+			"candidates", stats.Candidates,
+			"comparisons", stats.Comparisons,
+			"matches", stats.Matches,
+			"progress", fmt.Sprintf("%.1f%%", phase.Progress()),
+			"duration", stats.Duration.Round(time.Millisecond),
+		)
+	}
+}
@@ -0,0 +1,93 @@
+package match
+
+import (
+	"sort"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+)
+
+// MatchResult is the outcome of a run: what was matched, what is left to
+// decide and what is left unmatched
+type MatchResult struct {
+	// Accepted are the definitive matches, in the order they were found
+	Accepted []MessageMatch `json:"accepted"`
+	// Ambiguities are the matches with several equally good originals, see
+	// their Alternatives
+	Ambiguities []MessageMatch `json:"ambiguities"`
+	// Conflicts are the originals accepted for more than one obfuscated message
+	Conflicts []Conflict `json:"conflicts"`
+	// UnmatchedObfuscated and UnmatchedClear are the messages of each side no
+	// match refers to, sorted
+	UnmatchedObfuscated []string `json:"unmatchedObfuscated"`
+	UnmatchedClear      []string `json:"unmatchedClear"`
+	// Stats are the counters of each matcher, in the order they first ran
+	Stats []MatcherStats `json:"stats"`
+}
+
+// Conflict is an original message accepted for several obfuscated ones
+type Conflict struct {
+	Original   string   `json:"original"`
+	Obfuscated []string `json:"obfuscated"`
+}
+
+// NewMatchResult sorts matches out against the descriptors they were found in
+func NewMatchResult(matches []MessageMatch, obfuscated, clear *descriptor.Descriptor, stats []MatcherStats) *MatchResult {
+	result := &MatchResult{Stats: stats}
+	matchedObfuscated := make(map[string]bool)
+	matchedClear := make(map[string]bool)
+	claims := make(map[string][]string)
+	for _, match := range matches {
+		matchedObfuscated[match.ObfuscatedMsg] = true
+		matchedClear[match.OriginalMsg] = true
+		if len(match.Alternatives) > 0 {
+			result.Ambiguities = append(result.Ambiguities, match)
+			for _, alt := range match.Alternatives {
+				matchedClear[alt.Name] = true
+			}
+			continue
+		}
+		result.Accepted = append(result.Accepted, match)
+		claims[match.OriginalMsg] = append(claims[match.OriginalMsg], match.ObfuscatedMsg)
+	}
+
+	for original, claimants := range claims {
+		if len(claimants) > 1 {
+			result.Conflicts = append(result.Conflicts, Conflict{Original: original, Obfuscated: claimants})
+		}
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].Original < result.Conflicts[j].Original
+	})
+
+	result.UnmatchedObfuscated = unmatchedNames(obfuscated, matchedObfuscated)
+	result.UnmatchedClear = unmatchedNames(clear, matchedClear)
+	return result
+}
+
+// All returns every match, accepted ones first
+func (r *MatchResult) All() []MessageMatch {
+	return append(append([]MessageMatch{}, r.Accepted...), r.Ambiguities...)
+}
+
+// ByMatcher returns the matches found by one matcher, as named in their
+// Matcher field
+func (r *MatchResult) ByMatcher(matcher string) []MessageMatch {
+	var matches []MessageMatch
+	for _, match := range r.All() {
+		if match.Matcher == matcher {
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+func unmatchedNames(desc *descriptor.Descriptor, matched map[string]bool) []string {
+	var names []string
+	for _, msg := range desc.MessageType {
+		if !matched[msg.Name] {
+			names = append(names, msg.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
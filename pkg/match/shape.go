@@ -0,0 +1,145 @@
+package match
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+)
+
+// messageShape holds what the structure comparison derives from a message
+type messageShape struct {
+	key         structureKey
+	oneofFields [][]*descriptor.Field // Fields of each oneof, by oneof index
+
+	// Hash of the labels and types of the fields, in order. Only fields of
+	// primitive types ever compare equal, so a message with other fields
+	// can't be a perfect match.
+	fieldsHash uint64
+	primitive  bool
+
+	// Names of the fields by number and of the nested messages, along with
+	// the ones the obfuscator left clear, which the other message must share
+	fieldNames  map[int]string
+	nestedNames map[string]bool
+	clearFields map[int]string
+	clearNested []string
+}
+
+// messageShapes computes the shape of each message on first use and keeps it
+// for the next comparisons. It is safe for concurrent use.
+type messageShapes struct {
+	shapes sync.Map // *descriptor.MessageType -> *messageShape
+}
+
+func (c *messageShapes) of(msg *descriptor.MessageType) *messageShape {
+	if shape, ok := c.shapes.Load(msg); ok {
+		return shape.(*messageShape)
+	}
+
+	shape := &messageShape{
+		key:         structureKeyOf(msg),
+		oneofFields: make([][]*descriptor.Field, len(msg.OneOfDecl)),
+	}
+	for i := range shape.oneofFields {
+		shape.oneofFields[i] = getOneofFields(msg, i)
+	}
+
+	hash := fnv.New64a()
+	shape.primitive = true
+	for _, field := range msg.Field {
+		hash.Write([]byte(field.Label + " " + field.Type + ";"))
+		if _, ok := primitiveTypes[field.Type]; !ok {
+			shape.primitive = false
+		}
+	}
+	shape.fieldsHash = hash.Sum64()
+
+	shape.fieldNames = make(map[int]string, len(msg.Field))
+	for _, field := range msg.Field {
+		shape.fieldNames[field.Number] = field.Name
+		if IsClearName(field.Name) {
+			if shape.clearFields == nil {
+				shape.clearFields = make(map[int]string)
+			}
+			shape.clearFields[field.Number] = field.Name
+		}
+	}
+	shape.nestedNames = make(map[string]bool, len(msg.NestedType))
+	for _, nested := range msg.NestedType {
+		shape.nestedNames[nested.Name] = true
+		if IsClearName(nested.Name) {
+			shape.clearNested = append(shape.clearNested, nested.Name)
+		}
+	}
+
+	actual, _ := c.shapes.LoadOrStore(msg, shape)
+	return actual.(*messageShape)
+}
+
+// mayMatch tells whether compareMessageStructures can accept a pair, from the
+// counts of the messages only. Every score it doesn't know is taken as
+// perfect, so it never rejects a pair the full comparison would accept at
+// threshold. The pairs whose clear names disagree are ruled out too.
+func (c *messageShapes) mayMatch(obfs, unobs *descriptor.MessageType, threshold float64, weights Weights) bool {
+	return countsMayMatch(c.of(obfs).key, c.of(unobs).key, threshold, weights) && c.namesAgree(obfs, unobs)
+}
+
+// countsMayMatch is the part of mayMatch looking at the counts only, which
+// rules out whole buckets of original messages
+func countsMayMatch(a, b structureKey, threshold float64, weights Weights) bool {
+	if a.fields == 0 || b.fields == 0 {
+		return false
+	}
+
+	score := weights.FieldCount*countScore(a.fields, b.fields) + weights.FieldTypes
+	checks := weights.FieldCount + weights.FieldTypes
+	if a.oneofs > 0 || b.oneofs > 0 {
+		oneofPairs := float64(min(a.oneofs, b.oneofs))
+		score += weights.OneofCount*countScore(a.oneofs, b.oneofs) + weights.OneofFields*oneofPairs
+		checks += weights.OneofCount + weights.OneofFields*oneofPairs
+	}
+	if a.nested > 0 || b.nested > 0 {
+		score += weights.NestedCount * countScore(a.nested, b.nested)
+		checks += weights.NestedCount
+	}
+	if checks == 0 {
+		return false
+	}
+
+	// Some slack for the rounding of the full comparison
+	return score/checks*100 >= threshold-1e-9
+}
+
+// mayMatchPerfectly tells whether a pair can be a perfect structure match:
+// same counts, the same primitive fields in the same order and the same
+// clear names
+func (c *messageShapes) mayMatchPerfectly(obfs, unobs *descriptor.MessageType) bool {
+	a, b := c.of(obfs), c.of(unobs)
+	return a.key == b.key && a.primitive && b.primitive && a.fieldsHash == b.fieldsHash && c.namesAgree(obfs, unobs)
+}
+
+// namesAgree tells whether the names the obfuscator left clear in obfs, of
+// its fields and nested messages, are the ones of unobs: a clear field name
+// is the name of the field of unobs with the same number, a clear nested
+// message is declared by unobs too. They anchor the pair where the structure
+// alone can't tell.
+func (c *messageShapes) namesAgree(obfs, unobs *descriptor.MessageType) bool {
+	a, b := c.of(obfs), c.of(unobs)
+	for number, name := range a.clearFields {
+		if b.fieldNames[number] != name {
+			return false
+		}
+	}
+	for _, name := range a.clearNested {
+		if !b.nestedNames[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// countScore is the similarity of two counts used by compareMessageStructures
+func countScore(a, b int) float64 {
+	return 1 - float64(max(a, b)-min(a, b))/float64(max(a, b))
+}
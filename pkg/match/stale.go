@@ -0,0 +1,43 @@
+package match
+
+import "github.com/ruinedyourlife/deobfs/pkg/descriptor"
+
+// FuzzyThreshold is the confidence under which a message resembles an original
+// one not even fuzzily
+const FuzzyThreshold = 60
+
+// FindUnrelatedMessages returns the messages among names which score below
+// FuzzyThreshold against every original message, with the default weights.
+// Messages without fields are left out, there is nothing to compare. Many
+// unrelated messages hint at originals older than the obfuscated client.
+func FindUnrelatedMessages(obfuscated, unobfuscated *descriptor.Descriptor, names []string) []string {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	shapes := &messageShapes{}
+	unobsMsgs := messagePointers(unobfuscated.MessageType)
+	var unrelated []string
+	for _, obsMsg := range messagePointers(obfuscated.MessageType) {
+		if !wanted[obsMsg.Name] || len(obsMsg.Field) == 0 {
+			continue
+		}
+		if !resemblesAny(shapes, obsMsg, unobsMsgs) {
+			unrelated = append(unrelated, obsMsg.Name)
+		}
+	}
+	return unrelated
+}
+
+func resemblesAny(shapes *messageShapes, obsMsg *descriptor.MessageType, unobsMsgs []*descriptor.MessageType) bool {
+	for _, unobsMsg := range unobsMsgs {
+		if !shapes.mayMatch(obsMsg, unobsMsg, FuzzyThreshold, DefaultWeights) {
+			continue
+		}
+		if _, confidence := compareMessageStructures(shapes, DefaultWeights, obsMsg, unobsMsg); confidence >= FuzzyThreshold {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,417 @@
+package match
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/event"
+)
+
+// findStrictStructureBasedMatches finds messages that have matching structure/fields.
+// The comparisons of each pass run in parallel, the matches keep their order.
+func findStrictStructureBasedMatches(
+	ctx context.Context,
+	obfuscated, unobfuscated *descriptor.Descriptor,
+	previousMatches []MessageMatch,
+	options matcherOptions,
+	progress ProgressReporter,
+	logger *slog.Logger,
+) ([]MessageMatch, error) {
+	// We’ll store final structure-based matches here
+	var matches []MessageMatch
+	counters := progress.Phase(MatcherStrictStructure)
+	start := time.Now()
+	defer func() { counters.AddTime(time.Since(start)) }()
+
+	// Keep track of which messages are already matched (including those from previousMatches)
+	matchedObfuscated := make(map[string]bool)
+	matchedUnobfuscated := make(map[string]bool)
+
+	// Mark messages from the previous matchers as already matched
+	for _, em := range previousMatches {
+		matchedObfuscated[em.ObfuscatedMsg] = true
+		matchedUnobfuscated[em.OriginalMsg] = true
+	}
+
+	// Build the slice of unmatched messages
+	var unmatchedObs []*descriptor.MessageType
+	for _, msg := range messagePointers(obfuscated.MessageType) {
+		if !matchedObfuscated[msg.Name] {
+			unmatchedObs = append(unmatchedObs, msg)
+		}
+	}
+	corpus := options.corpus(unobfuscated)
+
+	// Count how many we started with—useful for summary logging
+	startingUnmatched := len(unmatchedObs)
+	counters.Start(startingUnmatched)
+	defer counters.Finish()
+
+	// Shapes are computed once, every pass compares the same messages again.
+	// The originals read from an index are new ones every time, their shapes
+	// are dropped with the chunk.
+	shapes := &messageShapes{}
+
+	// Iteratively peel off single-candidate matches
+	somethingChanged := true
+	passes := 0
+	// Messages with several perfect candidates in the last pass, by index in unmatchedObs
+	var ambiguous map[int][]*descriptor.MessageType
+	for somethingChanged {
+		passes++
+		somethingChanged = false
+		ambiguous = make(map[int][]*descriptor.MessageType)
+
+		// We'll keep track of newly matched in this pass
+		newlyMatchedObs := make([]string, 0)
+
+		size := options.chunkOf(len(unmatchedObs))
+		for first := 0; first < len(unmatchedObs); first += size {
+			chunk := unmatchedObs[first:min(first+size, len(unmatchedObs))]
+			if options.index != nil {
+				shapes = &messageShapes{}
+			}
+
+			// Find all possible "perfect" matches of every message of the
+			// chunk in parallel, against the messages unmatched when the
+			// chunk started which have the same shape. The ones matched by
+			// the messages before are dropped when the message is reached,
+			// like when they are all compared at the start of the pass.
+			passCandidates, err := perfectCandidates(ctx, shapes, corpus, chunk, matchedUnobfuscated, counters, passes == 1)
+			if err != nil {
+				return nil, err
+			}
+
+			// Go through each unmatched obfuscated message in order, so matches
+			// accepted earlier in the pass are skipped like before
+			for i, obsMsg := range chunk {
+				if matchedObfuscated[obsMsg.Name] {
+					continue
+				}
+
+				var candidates []*descriptor.MessageType
+				for _, unobsMsg := range passCandidates[i] {
+					if !matchedUnobfuscated[unobsMsg.Name] && !options.rejects(obsMsg.Name, unobsMsg.Name) {
+						candidates = append(candidates, unobsMsg)
+					}
+				}
+
+				// If exactly one perfect match, we accept it
+				if len(candidates) == 1 {
+					matched := candidates[0]
+
+					// Because compareMessageStructures returns a confidence
+					// we'll retrieve it again for logging/storing
+					_, confidence := compareMessageStructures(shapes, DefaultWeights, obsMsg, matched)
+					if confidence < options.threshold {
+						logger.Debug("structure match under the threshold",
+							"obfuscated", obsMsg.Name,
+							"original", matched.Name,
+							"confidence", confidence,
+							"threshold", options.threshold,
+						)
+						continue
+					}
+					matchedObfuscated[obsMsg.Name] = true
+					matchedUnobfuscated[matched.Name] = true
+					newlyMatchedObs = append(newlyMatchedObs, obsMsg.Name)
+
+					match := MessageMatch{
+						ObfuscatedMsg:  obsMsg.Name,
+						ObfuscatedFile: obsMsg.SourceFile,
+						OriginalMsg:    matched.Name,
+						OriginalFile:   matched.SourceFile,
+						MatchPercent:   confidence, // should be 100
+						Matcher:        MatcherStrictStructure,
+					}
+					matches = append(matches, match)
+					event.Emit(ctx, event.Event{Kind: event.MatchFound, Matcher: match.Matcher, Match: &match, Pass: passes})
+
+					logger.Debug("structure-based match",
+						"obfuscated", obsMsg.Name,
+						"original", matched.Name,
+						"confidence", confidence,
+					)
+
+					somethingChanged = true
+				} else if len(candidates) > 1 {
+					ambiguous[first+i] = candidates
+				}
+			}
+		}
+
+		event.Emit(ctx, event.Event{Kind: event.PassComplete, Matcher: MatcherStrictStructure, Pass: passes, Matches: len(newlyMatchedObs)})
+
+		// Remove newly matched obs messages from unmatchedObs
+		if somethingChanged && len(newlyMatchedObs) > 0 {
+			var tempObs []*descriptor.MessageType
+			for _, oMsg := range unmatchedObs {
+				if !matchedObfuscated[oMsg.Name] {
+					tempObs = append(tempObs, oMsg)
+				}
+			}
+			unmatchedObs = tempObs
+		}
+	}
+
+	// The messages still having several perfect candidates are left to the next matchers
+	for i, obsMsg := range unmatchedObs {
+		candidates := ambiguous[i]
+		if len(candidates) == 0 {
+			continue
+		}
+		match := MessageMatch{
+			ObfuscatedMsg:  obsMsg.Name,
+			ObfuscatedFile: obsMsg.SourceFile,
+			OriginalMsg:    candidates[0].Name,
+			OriginalFile:   candidates[0].SourceFile,
+			MatchPercent:   100,
+			Matcher:        MatcherStrictStructure,
+		}
+		for _, candidate := range candidates[1:] {
+			match.Alternatives = append(match.Alternatives, Alternative{Name: candidate.Name, File: candidate.SourceFile, Confidence: 100})
+		}
+		event.Emit(ctx, event.Event{
+			Kind:    event.MatchRejected,
+			Matcher: match.Matcher,
+			Match:   &match,
+			Pass:    passes,
+			Reason:  fmt.Sprintf("%d perfect candidates", len(candidates)),
+		})
+	}
+
+	// Update progress when we find new matches
+	progress.AddMatches(len(matches))
+	counters.AddMatches(len(matches))
+
+	// After no more single-candidate matches remain, we can do a summary
+	strictMatches := len(matches)
+	logger.Info("strict structure matching summary",
+		"initial_unmatched_obfuscated", startingUnmatched,
+		"strict_matches_found", strictMatches,
+		"passes_needed", passes,
+		"matching_progress", fmt.Sprintf("%.1f%%", progress.GetProgress()),
+	)
+
+	// Return only the strict matches. The rest remain unmatched/ambiguous.
+	return matches, nil
+}
+
+// perfectCandidates returns the originals not matched yet which are a perfect
+// structure match of each message of chunk, in the order of the corpus. The
+// messages are counted as processed when first is set, the first pass going
+// through all of them.
+func perfectCandidates(ctx context.Context, shapes *messageShapes, corpus clearCorpus, chunk []*descriptor.MessageType, matchedUnobfuscated map[string]bool, counters *PhaseCounters, first bool) ([][]*descriptor.MessageType, error) {
+	// The messages of the chunk by the bucket of their candidates
+	byKey := make(map[structureKey][]int)
+	for i, msg := range chunk {
+		if len(msg.Field) > 0 {
+			key := shapes.of(msg).key
+			byKey[key] = append(byKey[key], i)
+		} else if first {
+			counters.AddProcessed(1)
+		}
+	}
+	keys := make([]structureKey, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sortStructureKeys(keys)
+
+	candidates := make([][]*descriptor.MessageType, len(chunk))
+	for _, key := range keys {
+		bucket, err := corpus.bucket(key)
+		if err != nil {
+			return nil, err
+		}
+		var unmatched []*descriptor.MessageType
+		for _, unobs := range bucket {
+			if !matchedUnobfuscated[unobs.msg.Name] {
+				unmatched = append(unmatched, unobs.msg)
+			}
+		}
+		members := byKey[key]
+		err = forEachParallel(ctx, len(members), func(m int) {
+			i := members[m]
+			counters.AddCandidates(len(unmatched))
+			comparisons := 0
+			for _, unobsMsg := range unmatched {
+				if !shapes.mayMatchPerfectly(chunk[i], unobsMsg) {
+					continue
+				}
+				comparisons++
+				// For 100% strict matching
+				if isPerfectStructureMatch(shapes, chunk[i], unobsMsg) {
+					candidates[i] = append(candidates[i], unobsMsg)
+				}
+			}
+			counters.AddComparisons(comparisons)
+			// The next passes only go through the messages left again
+			if first {
+				counters.AddProcessed(1)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return candidates, nil
+}
+
+// Returns true if both messages have matching structure, with a confidence
+// score: the average of the scores of the checks, weighed by weights
+func compareMessageStructures(shapes *messageShapes, weights Weights, obfs, unobs *descriptor.MessageType) (bool, float64) {
+	confidence := scoreMessageStructures(shapes, weights, obfs, unobs, nil)
+
+	// Only consider it a match if confidence is above threshold
+	return confidence >= DefaultThreshold, confidence
+}
+
+// scoreMessageStructures returns the confidence of compareMessageStructures,
+// passing each check to record when it isn't nil
+func scoreMessageStructures(shapes *messageShapes, weights Weights, obfs, unobs *descriptor.MessageType, record func(check string, score, weight float64)) float64 {
+	// Skip messages with no fields
+	if len(obfs.Field) == 0 || len(unobs.Field) == 0 {
+		return 0
+	}
+
+	// Compare basic structure
+	matchScore := 0.0
+	totalChecks := 0.0
+	check := func(name string, score, weight float64) {
+		matchScore += weight * score
+		totalChecks += weight
+		if record != nil {
+			record(name, score, weight)
+		}
+	}
+
+	// Check field count similarity
+	fieldCountDiff := float64(math.Abs(float64(len(obfs.Field) - len(unobs.Field))))
+	fieldCountScore := 1.0 - (fieldCountDiff / float64(math.Max(float64(len(obfs.Field)), float64(len(unobs.Field)))))
+	check("field count", fieldCountScore, weights.FieldCount)
+
+	// Check field types in order
+	matchingFields := 0
+	maxFields := min(len(obfs.Field), len(unobs.Field))
+	for i := 0; i < maxFields; i++ {
+		// Compare field properties
+		if compareFields(&obfs.Field[i], &unobs.Field[i]) {
+			matchingFields++
+		}
+	}
+
+	if maxFields > 0 {
+		fieldTypeScore := float64(matchingFields) / float64(maxFields)
+		check("field types", fieldTypeScore, weights.FieldTypes)
+	}
+
+	// Check oneof count and structure
+	if len(obfs.OneOfDecl) > 0 || len(unobs.OneOfDecl) > 0 {
+		oneofCountDiff := float64(math.Abs(float64(len(obfs.OneOfDecl) - len(unobs.OneOfDecl))))
+		oneofScore := 1.0 - (oneofCountDiff / float64(max(len(obfs.OneOfDecl), len(unobs.OneOfDecl))))
+		check("oneof count", oneofScore, weights.OneofCount)
+
+		// Compare oneof fields
+		for i := 0; i < min(len(obfs.OneOfDecl), len(unobs.OneOfDecl)); i++ {
+			obfsOneofFields := shapes.of(obfs).oneofFields[i]
+			unobsOneofFields := shapes.of(unobs).oneofFields[i]
+
+			oneofFieldMatch := compareOneofFields(obfsOneofFields, unobsOneofFields)
+			name := "oneof fields"
+			if record != nil {
+				name = fmt.Sprintf("oneof %d fields", i)
+			}
+			check(name, oneofFieldMatch, weights.OneofFields)
+		}
+	}
+
+	// Check nested message count and structure
+	if len(obfs.NestedType) > 0 || len(unobs.NestedType) > 0 {
+		nestedCountDiff := float64(math.Abs(float64(len(obfs.NestedType) - len(unobs.NestedType))))
+		nestedScore := 1.0 - (nestedCountDiff / float64(max(len(obfs.NestedType), len(unobs.NestedType))))
+		check("nested count", nestedScore, weights.NestedCount)
+	}
+
+	// Calculate final confidence
+	if totalChecks == 0 {
+		return 0
+	}
+
+	return (matchScore / totalChecks) * 100
+}
+
+// Wrapper to check if a structure match is perfect
+func isPerfectStructureMatch(shapes *messageShapes, obfs, unobs *descriptor.MessageType) bool {
+	if !shapes.mayMatchPerfectly(obfs, unobs) {
+		return false
+	}
+	isMatch, confidence := compareMessageStructures(shapes, DefaultWeights, obfs, unobs)
+	return isMatch && confidence == 100
+}
+
+// Helper functions
+func compareFields(obfs, unobs *descriptor.Field) bool {
+	// Compare basic field properties
+	if obfs.Label != unobs.Label {
+		return false
+	}
+
+	// Compare types, handling both primitive and message types
+	return compareTypes(obfs.Type, unobs.Type)
+}
+
+// Types compatible with each other, by primitive type
+var primitiveTypes = map[string][]string{
+	"int32":  {"int32"},
+	"int64":  {"int64"},
+	"string": {"string"},
+	"bool":   {"bool"},
+}
+
+func compareTypes(obfsType, unobsType string) bool {
+	// Handle primitive types
+	compatTypes, ok := primitiveTypes[obfsType]
+	return ok && contains(compatTypes, unobsType)
+}
+
+func getOneofFields(msg *descriptor.MessageType, oneofIndex int) []*descriptor.Field {
+	var fields []*descriptor.Field
+	for i := range msg.Field {
+		if field := &msg.Field[i]; field.OneOfIndex != nil && *field.OneOfIndex == oneofIndex {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func compareOneofFields(obfsFields, unobsFields []*descriptor.Field) float64 {
+	if len(obfsFields) == 0 || len(unobsFields) == 0 {
+		return 0
+	}
+
+	matchingFields := 0
+	for _, obfsField := range obfsFields {
+		for _, unobsField := range unobsFields {
+			if compareFields(obfsField, unobsField) {
+				matchingFields++
+				break
+			}
+		}
+	}
+
+	return float64(matchingFields) / float64(max(len(obfsFields), len(unobsFields)))
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,251 @@
+package match
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/event"
+)
+
+// A comparison scoring at most nearMissMargin percent below the threshold is
+// a near miss. The best maxNearMisses ones of each message left unmatched are
+// logged, with what differs.
+const (
+	nearMissMargin = 10
+	maxNearMisses  = 5
+)
+
+// findStructureBasedMatches finds messages whose structure is close enough to an
+// original one, without requiring a perfect match. When several originals share
+// the best score, the match is recorded as uncertain with its alternatives.
+func findStructureBasedMatches(
+	ctx context.Context,
+	obfuscated, unobfuscated *descriptor.Descriptor,
+	previousMatches []MessageMatch,
+	options matcherOptions,
+	progress ProgressReporter,
+	logger *slog.Logger,
+) ([]MessageMatch, error) {
+	var matches []MessageMatch
+	threshold, weights := options.thresholdOr(DefaultThreshold), options.weights
+	counters := progress.Phase(MatcherRelaxed)
+	start := time.Now()
+	defer func() { counters.AddTime(time.Since(start)) }()
+
+	matchedObfuscated := make(map[string]bool)
+	matchedUnobfuscated := make(map[string]bool)
+	for _, pm := range previousMatches {
+		matchedObfuscated[pm.ObfuscatedMsg] = true
+		matchedUnobfuscated[pm.OriginalMsg] = true
+	}
+
+	var obsMsgs []*descriptor.MessageType
+	for _, obsMsg := range messagePointers(obfuscated.MessageType) {
+		if !matchedObfuscated[obsMsg.Name] {
+			obsMsgs = append(obsMsgs, obsMsg)
+		}
+	}
+	remaining := len(obsMsgs)
+	counters.Start(remaining)
+	defer counters.Finish()
+
+	// The originals left to each message, counted like the candidates were
+	// when every message went through all of them
+	unmatchedUnobs := 0
+	for _, unobsMsg := range unobfuscated.MessageType {
+		if !matchedUnobfuscated[unobsMsg.Name] {
+			unmatchedUnobs++
+		}
+	}
+
+	corpus := options.corpus(unobfuscated)
+	definitive := 0
+
+	// The pruning lets the near misses through when they are logged
+	nearMisses := logger.Enabled(ctx, slog.LevelDebug)
+	pruneThreshold := threshold
+	if nearMisses {
+		pruneThreshold = threshold - nearMissMargin
+	}
+	size := options.chunkOf(len(obsMsgs))
+	for first := 0; first < len(obsMsgs); first += size {
+		chunk := obsMsgs[first:min(first+size, len(obsMsgs))]
+		// The candidates are scored against the originals left when the chunk
+		// starts, and the ones matched by the messages before are dropped when
+		// the message is reached, like scoring them then
+		shapes := &messageShapes{}
+		scored := make([][]scoredMessage, len(chunk))
+		missed := make([][]scoredMessage, len(chunk))
+		keys := corpus.keys()
+		// A message is processed once the last bucket it needs is scored
+		processedAt := make([]int, len(keys)+1)
+		for _, obsMsg := range chunk {
+			last := -1
+			for k, key := range keys {
+				if countsMayMatch(shapes.of(obsMsg).key, key, pruneThreshold, weights) {
+					last = k
+				}
+			}
+			processedAt[last+1]++
+		}
+		counters.AddProcessed(processedAt[0])
+		for k, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			var wanted []int
+			for i, obsMsg := range chunk {
+				if countsMayMatch(shapes.of(obsMsg).key, key, pruneThreshold, weights) {
+					wanted = append(wanted, i)
+				}
+			}
+			if len(wanted) == 0 {
+				continue
+			}
+			bucket, err := corpus.bucket(key)
+			if err != nil {
+				return nil, err
+			}
+			for _, i := range wanted {
+				compared := 0
+				for _, unobs := range bucket {
+					// Rule out the pairs which can't match before comparing them
+					if matchedUnobfuscated[unobs.msg.Name] || options.rejects(chunk[i].Name, unobs.msg.Name) || !shapes.namesAgree(chunk[i], unobs.msg) {
+						continue
+					}
+					compared++
+					_, confidence := compareMessageStructures(shapes, weights, chunk[i], unobs.msg)
+					if confidence > 0 && confidence >= threshold {
+						scored[i] = append(scored[i], scoredMessage{unobs.msg, confidence, unobs.order})
+					} else if nearMisses && confidence >= threshold-nearMissMargin {
+						missed[i] = append(missed[i], scoredMessage{unobs.msg, confidence, unobs.order})
+					}
+				}
+				counters.AddComparisons(compared)
+			}
+			counters.AddProcessed(processedAt[k+1])
+		}
+
+		for i, obsMsg := range chunk {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			candidates := unmatchedScores(scored[i], matchedUnobfuscated)
+			counters.AddCandidates(unmatchedUnobs)
+			if len(candidates) == 0 {
+				logNearMisses(logger, obsMsg, unmatchedScores(missed[i], matchedUnobfuscated), threshold)
+				continue
+			}
+
+			sortScores(candidates)
+
+			best := candidates[0]
+			match := MessageMatch{
+				ObfuscatedMsg:  obsMsg.Name,
+				ObfuscatedFile: obsMsg.SourceFile,
+				OriginalMsg:    best.msg.Name,
+				OriginalFile:   best.msg.SourceFile,
+				MatchPercent:   best.confidence,
+				Matcher:        MatcherRelaxed,
+			}
+
+			// Every other candidate with the same score makes the match uncertain
+			for _, c := range candidates[1:] {
+				if c.confidence < best.confidence {
+					break
+				}
+				match.Alternatives = append(match.Alternatives, Alternative{
+					Name:       c.msg.Name,
+					File:       c.msg.SourceFile,
+					Confidence: c.confidence,
+				})
+			}
+
+			if len(match.Alternatives) > 0 {
+				names := make([]string, len(match.Alternatives))
+				for i, alt := range match.Alternatives {
+					names[i] = alt.Name
+				}
+				logger.Debug("found structure-based match with alternatives",
+					"obfuscated", obsMsg.Name,
+					"original", best.msg.Name,
+					"confidence", best.confidence,
+					"alternatives", strings.Join(names, ", "),
+				)
+			} else {
+				// Only definitive matches consume the original message
+				matchedUnobfuscated[best.msg.Name] = true
+				unmatchedUnobs--
+				definitive++
+				logger.Debug("structure-based match",
+					"obfuscated", obsMsg.Name,
+					"original", best.msg.Name,
+					"confidence", best.confidence,
+				)
+			}
+
+			matches = append(matches, match)
+			event.Emit(ctx, event.Event{Kind: event.MatchFound, Matcher: match.Matcher, Match: &match})
+		}
+	}
+
+	progress.AddMatches(definitive)
+	counters.AddMatches(len(matches))
+
+	logger.Info("structure matching summary",
+		"remaining_messages", remaining,
+		"structure_matches_found", len(matches),
+		"matching_progress", fmt.Sprintf("%.1f%%", progress.GetProgress()),
+	)
+
+	return matches, nil
+}
+
+// scoredMessage is an original message with its confidence and its position
+// in the corpus
+type scoredMessage struct {
+	msg        *descriptor.MessageType
+	confidence float64
+	order      int
+}
+
+// unmatchedScores returns the scores of the originals not matched yet
+func unmatchedScores(scores []scoredMessage, matchedUnobfuscated map[string]bool) []scoredMessage {
+	var unmatched []scoredMessage
+	for _, score := range scores {
+		if !matchedUnobfuscated[score.msg.Name] {
+			unmatched = append(unmatched, score)
+		}
+	}
+	return unmatched
+}
+
+// sortScores sorts the scores by confidence, the ties in the order of the corpus
+func sortScores(scores []scoredMessage) {
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].confidence != scores[j].confidence {
+			return scores[i].confidence > scores[j].confidence
+		}
+		return scores[i].order < scores[j].order
+	})
+}
+
+// logNearMisses logs why the best near misses of a message left unmatched
+// didn't reach the threshold
+func logNearMisses(logger *slog.Logger, obsMsg *descriptor.MessageType, misses []scoredMessage, threshold float64) {
+	sortScores(misses)
+	for _, miss := range misses[:min(len(misses), maxNearMisses)] {
+		logger.Debug("near miss",
+			"obfuscated", obsMsg.Name,
+			"original", miss.msg.Name,
+			"confidence", miss.confidence,
+			"threshold", threshold,
+			"reasons", structureMismatches(obsMsg, miss.msg),
+		)
+	}
+}
@@ -0,0 +1,47 @@
+package match
+
+import (
+	"log/slog"
+	"time"
+)
+
+// PhaseTiming is the time spent in one phase of a run
+type PhaseTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// PhaseTimer records the duration of the phases of a run, in order. A nil
+// timer records nothing.
+type PhaseTimer struct {
+	phases []PhaseTiming
+}
+
+// Start starts timing a phase, the returned function ends it
+func (t *PhaseTimer) Start(name string) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.phases = append(t.phases, PhaseTiming{Name: name, Duration: time.Since(start)})
+	}
+}
+
+// Phases returns the timings recorded so far
+func (t *PhaseTimer) Phases() []PhaseTiming {
+	if t == nil {
+		return nil
+	}
+	return t.phases
+}
+
+// Log logs the time spent in each phase and the total
+func (t *PhaseTimer) Log(logger *slog.Logger) {
+	var total time.Duration
+	for _, phase := range t.Phases() {
+		logger.Info("phase timing", "phase", phase.Name, "duration", phase.Duration.Round(time.Millisecond))
+		total += phase.Duration
+	}
+	logger.Info("phase timing", "phase", "total", "duration", total.Round(time.Millisecond))
+}
@@ -0,0 +1,183 @@
+package report
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+)
+
+// The type positions of a line of a proto file: declarations, field types,
+// map keys and values, and rpc requests and responses
+var (
+	declarationRegex = regexp.MustCompile(`^\s*(?:message|enum|service|extend)\s+(\.?[A-Za-z_][\w.]*)`)
+	fieldTypeRegex   = regexp.MustCompile(`^\s*(?:(?:repeated|optional|required)\s+)?(\.?[A-Za-z_][\w.]*)\s+[A-Za-z_]\w*\s*=`)
+	mapTypeRegex     = regexp.MustCompile(`map\s*<\s*(\.?[A-Za-z_][\w.]*)\s*,\s*(\.?[A-Za-z_][\w.]*)\s*>`)
+	rpcTypeRegex     = regexp.MustCompile(`\(\s*(?:stream\s+)?(\.?[A-Za-z_][\w.]*)\s*\)`)
+)
+
+// Renames returns the obfuscated -> original message name mapping for a set of matches
+func Renames(matches []mapping.MessageMatch) map[string]string {
+	renames := make(map[string]string)
+	for _, match := range matches {
+		// Uncertain matches are not applied
+		if len(match.Alternatives) > 0 {
+			continue
+		}
+		renames[match.ObfuscatedMsg] = match.OriginalMsg
+	}
+	return renames
+}
+
+// Apply writes a copy of every proto file in srcDir to outDir with the
+// matched obfuscated message names replaced by their original names. It stops
+// when ctx is cancelled.
+func Apply(ctx context.Context, matches []mapping.MessageMatch, srcDir, outDir string) error {
+	return ApplyFS(ctx, matches, os.DirFS(srcDir), outDir)
+}
+
+// ApplyFS is Apply reading the proto files from fsys. The
+// aliases recorded by descriptor.FilterFiles are written too, as renamed copies of
+// the file they duplicate.
+func ApplyFS(ctx context.Context, matches []mapping.MessageMatch, fsys fs.FS, outDir string) error {
+	return ApplySubset(ctx, matches, fsys, outDir, func(string) bool { return true })
+}
+
+// ApplySubset is ApplyFS writing only the files and aliases keep
+// accepts, given their slash path in fsys. The references to the messages of
+// the other files are renamed all the same.
+func ApplySubset(ctx context.Context, matches []mapping.MessageMatch, fsys fs.FS, outDir string, keep func(path string) bool) error {
+	renames := Renames(matches)
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	aliases, err := descriptor.LoadFileAliases(fsys)
+	if err != nil {
+		return err
+	}
+
+	err = fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".proto" || !keep(path) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		destination := filepath.Join(outDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+			return err
+		}
+
+		return renameFile(fsys, path, destination, renames)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range aliases.Names() {
+		if !keep(alias) {
+			continue
+		}
+		destination := filepath.Join(outDir, filepath.FromSlash(alias))
+		if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+			return err
+		}
+		if err := renameFile(fsys, aliases[alias], destination, renames); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renameFile(fsys fs.FS, source, destination string, renames map[string]string) error {
+	srcFile, err := fsys.Open(source)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	writer := bufio.NewWriter(destFile)
+	scanner := bufio.NewScanner(srcFile)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Imports reference file names, which are kept as is
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "import ") && !strings.HasPrefix(trimmed, "syntax") && !strings.HasPrefix(trimmed, "package ") {
+			line = renameIdentifiers(line, renames)
+		}
+
+		if _, err := writer.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+// Rename the message types declared or referenced by the line. Field names,
+// enum values and options are kept, even when they equal an obfuscated name.
+func renameIdentifiers(line string, renames map[string]string) string {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(trimmed, "option "):
+		return line
+	case strings.HasPrefix(trimmed, "rpc "):
+		return renameTypes(line, rpcTypeRegex, renames)
+	}
+	for _, regex := range []*regexp.Regexp{declarationRegex, fieldTypeRegex, mapTypeRegex} {
+		line = renameTypes(line, regex, renames)
+	}
+	return line
+}
+
+// renameTypes renames the type paths captured by the groups of regex in line
+func renameTypes(line string, regex *regexp.Regexp, renames map[string]string) string {
+	matches := regex.FindAllStringSubmatchIndex(line, -1)
+	// From the end, so the earlier offsets stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		groups := matches[i]
+		for g := len(groups)/2 - 1; g >= 1; g-- {
+			start, end := groups[2*g], groups[2*g+1]
+			if start < 0 {
+				continue
+			}
+			line = line[:start] + renameTypePath(line[start:end], renames) + line[end:]
+		}
+	}
+	return line
+}
+
+// Apply the renames to every component of a type path like Outer.Inner
+func renameTypePath(path string, renames map[string]string) string {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		if renamed, ok := renames[part]; ok {
+			parts[i] = renamed
+		}
+	}
+	return strings.Join(parts, ".")
+}
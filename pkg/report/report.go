@@ -0,0 +1,77 @@
+// Package report writes the results of a match run: the mapping file other
+// tools read, and the text reports.
+package report
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+)
+
+// Mapping is the content of a mapping.json file
+type Mapping = mapping.Mapping
+
+// NewMapping records the matches along with the hashes of the corpora they come from
+func NewMapping(matches []mapping.MessageMatch, obfuscated, clear *descriptor.Descriptor) *Mapping {
+	return &Mapping{
+		Version:   mapping.Version,
+		Matches:   matches,
+		Files:     obfuscated.Files,
+		ClearHash: descriptor.CorpusHash(clear),
+	}
+}
+
+// WriteMapping writes the matches to a mapping.json file, along with the
+// hashes of the corpora they come from for incremental runs
+func WriteMapping(matches []mapping.MessageMatch, obfuscated, clear *descriptor.Descriptor, path string) error {
+	return WriteMappingFile(NewMapping(matches, obfuscated, clear), path, nil)
+}
+
+// WriteMappingFile writes a mapping to a JSON file, with its matches sorted
+// and its checksum, signed with key when it isn't nil
+func WriteMappingFile(m *Mapping, path string, key ed25519.PrivateKey) error {
+	output := *m
+	output.Matches = mapping.SortedMatches(m.Matches)
+	var err error
+	if key != nil {
+		err = output.Sign(key)
+	} else {
+		err = output.Seal()
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return WriteError(path, err)
+	}
+	return nil
+}
+
+// LoadMapping reads a mapping.json file
+func LoadMapping(path string) (*Mapping, error) {
+	return mapping.Load(path)
+}
+
+// WriteError adds a hint to the errors writing a report to path, for the
+// missing or read-only report directories
+func WriteError(path string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return descriptor.WithHint(err, fmt.Sprintf("create the %s directory, or run deobfs where it exists", filepath.Dir(path)))
+	case errors.Is(err, fs.ErrPermission):
+		return descriptor.WithHint(err, fmt.Sprintf("the %s directory isn't writable, fix its permissions or run from a directory you own", filepath.Dir(path)))
+	}
+	return err
+}
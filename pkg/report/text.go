@@ -0,0 +1,98 @@
+package report
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+)
+
+// WriteTextFile writes the text report of the matches to outputFile
+func WriteTextFile(ctx context.Context, matches []mapping.MessageMatch, outputFile string) error {
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return WriteError(outputFile, err)
+	}
+	defer file.Close()
+
+	if err := WriteText(ctx, file, matches); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// WriteText streams the text report of the matches to w, through a
+// fixed-size buffer whatever the number of matches. It stops when ctx is cancelled.
+func WriteText(ctx context.Context, w io.Writer, matches []mapping.MessageMatch) error {
+	report := bufio.NewWriter(w)
+
+	report.WriteString("Message Matches Report\n")
+	report.WriteString("======================\n\n")
+
+	// Sort matches for consistent output
+	matches = mapping.SortedMatches(matches)
+
+	// Calculate column widths
+	var maxObfsMsg, maxOrigMsg, maxOrigFile int
+	for _, match := range matches {
+		maxObfsMsg = max(maxObfsMsg, len(match.ObfuscatedMsg))
+		maxOrigMsg = max(maxOrigMsg, len(match.OriginalMsg))
+		maxOrigFile = max(maxOrigFile, len(filepath.Base(match.OriginalFile)))
+	}
+
+	// Write header
+	format := fmt.Sprintf("%%-%ds  →  %%-%ds  %%-%ds  [conf: %%%d.2f%%%%]\n",
+		maxObfsMsg, maxOrigMsg, maxOrigFile, 6)
+
+	fmt.Fprintf(report, format,
+		"Obf",
+		"Orig",
+		"File",
+		0.0,
+	)
+
+	// Write separator
+	totalWidth := maxObfsMsg + maxOrigMsg + maxOrigFile + 23 // 20 for spacing and symbols
+	report.WriteString(strings.Repeat("-", totalWidth) + "\n")
+
+	// Write matches
+	for _, match := range matches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(match.Alternatives) > 0 {
+			// For uncertain matches, list all possibilities as alternatives
+			allPossibilities := []string{fmt.Sprintf("%s (%s, %.2f%%)",
+				match.OriginalMsg, filepath.Base(match.OriginalFile), match.MatchPercent)}
+			for _, alt := range match.Alternatives {
+				allPossibilities = append(allPossibilities, fmt.Sprintf("%s (%s, %.2f%%)",
+					alt.Name, filepath.Base(alt.File), alt.Confidence))
+			}
+			fmt.Fprintf(report, format,
+				match.ObfuscatedMsg,
+				"???", // Show uncertainty in main match
+				"???", // Don't show file when uncertain
+				match.MatchPercent,
+			)
+			fmt.Fprintf(report, "    Possible matches: %s\n",
+				strings.Join(allPossibilities, ", "))
+		} else {
+			// For definitive matches
+			fmt.Fprintf(report, format,
+				match.ObfuscatedMsg,
+				match.OriginalMsg,
+				filepath.Base(match.OriginalFile),
+				match.MatchPercent,
+			)
+		}
+	}
+
+	fmt.Fprintf(report, "\nTotal matches: %d\n", len(matches))
+
+	return report.Flush()
+}
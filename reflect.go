@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// runReflect serves the deobfuscated protos over the gRPC reflection protocol,
+// so grpcurl, buf curl or Postman can introspect the schema
+func runReflect(args []string) {
+	flags := flag.NewFlagSet("reflect", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:50051", "address to listen on")
+	protoDir := flags.String("protos", "protos/deobfuscated", "directory of the deobfuscated proto files")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	files, skipped, err := utils.LoadProtoFiles(*protoDir)
+	if err != nil {
+		logger.Error("error loading deobfuscated protos", "error", err)
+		os.Exit(1)
+	}
+	if len(skipped) > 0 {
+		logger.Warn("some proto files can't be loaded, they won't be served", "files", len(skipped))
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		logger.Error("error listening", "error", err)
+		os.Exit(1)
+	}
+
+	server := grpc.NewServer()
+	reflectionServer := reflection.NewServerV1(reflection.ServerOptions{
+		Services:           server,
+		DescriptorResolver: files,
+		ExtensionResolver:  &protoregistry.Types{},
+	})
+	reflectionv1.RegisterServerReflectionServer(server, reflectionServer)
+	reflectionv1alpha.RegisterServerReflectionServer(server, reflection.NewServer(reflection.ServerOptions{
+		Services:           server,
+		DescriptorResolver: files,
+		ExtensionResolver:  &protoregistry.Types{},
+	}))
+
+	logger.Info("serving the deobfuscated schema over gRPC reflection", "addr", *addr, "files", files.NumFiles())
+	if err := server.Serve(listener); err != nil {
+		logger.Error("reflection server stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+const reviewUsage = `usage: deobfs review <command>
+
+commands:
+  export [-mapping file] [-below 90] [-output review.txt]   write the uncertain matches and the ones below a confidence to a queue to edit
+  import [-output seeds.json] <queue files...>              add the decisions of edited queues to a seed file
+`
+
+// runReview exports the matches to review to a queue file edited by hand and
+// imports the decisions back as seeds, without the interactive confirmation
+func runReview(args []string) {
+	flags := flag.NewFlagSet("review", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, reviewUsage) }
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "export":
+		exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+		mappingFile := exportFlags.String("mapping", "reports/mapping.json", "mapping file to review")
+		below := exportFlags.Float64("below", 90, "confidence under which a match is reviewed, the uncertain ones always are")
+		output := exportFlags.String("output", "review.txt", "queue file to write, - for stdout")
+		exportFlags.Parse(commandArgs)
+
+		mapping, err := utils.LoadMapping(*mappingFile)
+		if err != nil {
+			logger.Error("error loading mapping file", "error", err)
+			os.Exit(1)
+		}
+		queue := utils.NewReviewQueue(mapping.Matches, *below)
+
+		out := os.Stdout
+		if *output != "-" {
+			if out, err = os.Create(*output); err != nil {
+				logger.Error("error creating review queue", "error", err)
+				os.Exit(1)
+			}
+			defer out.Close()
+		}
+		if err := utils.WriteReviewQueue(out, queue); err != nil {
+			logger.Error("error writing review queue", "error", err)
+			os.Exit(1)
+		}
+		if *output != "-" {
+			logger.Info("review queue written", "file", *output, "entries", len(queue))
+		}
+	case "import":
+		importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+		output := importFlags.String("output", "seeds.json", "seed file to create or add the decisions to")
+		importFlags.Parse(commandArgs)
+
+		if importFlags.NArg() == 0 {
+			flags.Usage()
+			os.Exit(2)
+		}
+
+		var existing []utils.Seed
+		if _, err := os.Stat(*output); err == nil {
+			if existing, err = utils.LoadSeeds(*output); err != nil {
+				logger.Error("error loading existing seed file", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		var decided []utils.Seed
+		for _, path := range importFlags.Args() {
+			queue, err := readReviewQueue(path)
+			if err != nil {
+				logger.Error("error reading review queue", "file", path, "error", err)
+				os.Exit(1)
+			}
+			seeds := utils.ReviewSeeds(queue, "review")
+			logger.Info("imported review queue", "file", path, "entries", len(queue), "decisions", len(seeds), "pending", len(queue)-len(seeds))
+			decided = append(decided, seeds...)
+		}
+
+		seeds := utils.MergeSeeds(existing, decided)
+		if err := utils.WriteSeeds(seeds, *output); err != nil {
+			logger.Error("error writing seed file", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("seed file written", "file", *output, "seeds", len(seeds))
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+func readReviewQueue(path string) ([]utils.ReviewEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return utils.ParseReviewQueue(file)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// Small protodec output, the clear protos it matches and the expected mapping
+//
+//go:embed protos/selftest
+var selftestFixtures embed.FS
+
+const selftestDir = "protos/selftest"
+
+// runSelftest runs the whole pipeline on the embedded fixtures, filtering,
+// parsing, matching and renaming, and checks the result against the expected
+// mapping, so a build can be trusted before pointing it at a real dump
+func runSelftest(args []string) {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "show the logs of the pipeline")
+	flags.Parse(args)
+
+	level := utils.LevelError
+	if *verbose {
+		level = utils.LevelDebug
+	}
+	logger := utils.InitLogger(level)
+
+	work, err := os.MkdirTemp("", "deobfs-selftest-")
+	if err != nil {
+		logger.Error("error creating temporary directory", "error", err)
+		os.Exit(1)
+	}
+	failures, err := selftest(context.Background(), work, logger)
+	os.RemoveAll(work)
+	if err != nil {
+		fmt.Printf("FAIL %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, failure := range failures {
+		fmt.Printf("FAIL %s\n", failure)
+	}
+	if len(failures) > 0 {
+		fmt.Printf("selftest failed: %d problems\n", len(failures))
+		os.Exit(1)
+	}
+	fmt.Println("PASS selftest")
+}
+
+// selftest runs the pipeline in work. A step failing is returned as an error,
+// the differences with the expected results as failures.
+func selftest(ctx context.Context, work string, logger *slog.Logger) ([]string, error) {
+	fixtures, err := fs.Sub(selftestFixtures, selftestDir)
+	if err != nil {
+		return nil, err
+	}
+	source, err := fs.Sub(fixtures, "decompiled")
+	if err != nil {
+		return nil, err
+	}
+	clearFS, err := fs.Sub(fixtures, "clear")
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(fixtures, "expected.json")
+	if err != nil {
+		return nil, err
+	}
+	expected, err := mapping.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading expected mapping: %w", err)
+	}
+
+	profile, err := utils.GetProfile("dofus")
+	if err != nil {
+		return nil, err
+	}
+	filtered := filepath.Join(work, "filtered")
+	if err := descriptor.Filter(source, filtered, profile.AssembliesOfInterest); err != nil {
+		return nil, fmt.Errorf("filtering: %w", err)
+	}
+
+	obfuscated, err := descriptor.Load(ctx, filtered, logger)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the filtered protos: %w", err)
+	}
+	clear, err := descriptor.LoadFS(ctx, clearFS, "selftest", logger)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the clear protos: %w", err)
+	}
+
+	result, err := match.Match(ctx, obfuscated, clear, match.Options{Logger: logger})
+	if err != nil {
+		return nil, fmt.Errorf("matching: %w", err)
+	}
+	matches := result.All()
+	utils.SetFieldMappings(matches, obfuscated, clear)
+
+	deobfuscated := filepath.Join(work, "deobfuscated")
+	if err := utils.ApplyMatches(ctx, matches, filtered, deobfuscated); err != nil {
+		return nil, fmt.Errorf("renaming: %w", err)
+	}
+
+	return compareSelftest(expected.Matches, matches, filtered, deobfuscated), nil
+}
+
+// compareSelftest lists the differences between the expected matches and the
+// found ones, and checks the renamed protos declare the original names
+func compareSelftest(expected, found []match.MessageMatch, filtered, deobfuscated string) []string {
+	var failures []string
+	byObfuscated := make(map[string]match.MessageMatch)
+	for _, m := range found {
+		byObfuscated[m.ObfuscatedMsg] = m
+	}
+
+	for _, want := range expected {
+		got, ok := byObfuscated[want.ObfuscatedMsg]
+		delete(byObfuscated, want.ObfuscatedMsg)
+		switch {
+		case !ok:
+			failures = append(failures, fmt.Sprintf("%s: not matched, expected %s", want.ObfuscatedMsg, want.OriginalMsg))
+			continue
+		case got.OriginalMsg != want.OriginalMsg || len(got.Alternatives) > 0:
+			failures = append(failures, fmt.Sprintf("%s: matched with %s, expected %s", want.ObfuscatedMsg, formatMatchCandidates(got), want.OriginalMsg))
+			continue
+		case got.Matcher != want.Matcher:
+			failures = append(failures, fmt.Sprintf("%s: matched by %s, expected %s", want.ObfuscatedMsg, got.Matcher, want.Matcher))
+		}
+		if got := fieldNames(got.Fields); got != fieldNames(want.Fields) {
+			failures = append(failures, fmt.Sprintf("%s: fields %s, expected %s", want.ObfuscatedMsg, got, fieldNames(want.Fields)))
+		}
+
+		var content []byte
+		rel, err := filepath.Rel(filtered, got.ObfuscatedFile)
+		if err == nil {
+			content, err = os.ReadFile(filepath.Join(deobfuscated, rel))
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: renamed proto: %v", want.ObfuscatedMsg, err))
+		} else if !strings.Contains(string(content), "message "+want.OriginalMsg+" {") {
+			failures = append(failures, fmt.Sprintf("%s: renamed proto doesn't declare %s", want.ObfuscatedMsg, want.OriginalMsg))
+		}
+	}
+
+	for _, m := range utils.SortedMatches(mapValues(byObfuscated)) {
+		failures = append(failures, fmt.Sprintf("%s: unexpected match with %s", m.ObfuscatedMsg, formatMatchCandidates(m)))
+	}
+	return failures
+}
+
+func formatMatchCandidates(m match.MessageMatch) string {
+	names := []string{m.OriginalMsg}
+	for _, alt := range m.Alternatives {
+		names = append(names, alt.Name)
+	}
+	return strings.Join(names, " | ")
+}
+
+func fieldNames(fields []mapping.FieldMapping) string {
+	var names []string
+	for _, field := range fields {
+		names = append(names, fmt.Sprintf("%d:%s=%s", field.Number, field.Obfuscated, field.Original))
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+func mapValues(matches map[string]match.MessageMatch) []match.MessageMatch {
+	values := make([]match.MessageMatch, 0, len(matches))
+	for _, m := range matches {
+		values = append(values, m)
+	}
+	return values
+}
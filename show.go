@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runShow renders an existing mapping file without rerunning the matching
+func runShow(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	mappingFile := flags.String("mapping", "reports/mapping.json", "mapping file to show")
+	noPager := flags.Bool("no-pager", false, "print directly to stdout instead of using a pager")
+	noColor := flags.Bool("no-color", false, "show the confidence bands with +, ~ and ! markers instead of colors")
+	flags.Parse(args)
+
+	if *noColor {
+		color.NoColor = true
+	}
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	mapping, err := utils.LoadMapping(*mappingFile)
+	if err != nil {
+		logger.Error("error loading mapping file", "error", err)
+		os.Exit(1)
+	}
+
+	// Lines fit the terminal, piped output keeps them whole
+	width := utils.TerminalWidth(os.Stdout)
+
+	// Only page when a human is looking at the output
+	if *noPager || !isatty.IsTerminal(os.Stdout.Fd()) {
+		utils.PrintMapping(os.Stdout, mapping, width)
+		return
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		logger.Error("error starting pager", "error", err)
+		os.Exit(1)
+	}
+	if err := cmd.Start(); err != nil {
+		// Fall back to plain output when no pager is available
+		utils.PrintMapping(os.Stdout, mapping, width)
+		return
+	}
+
+	utils.PrintMapping(stdin, mapping, width)
+	stdin.Close()
+	cmd.Wait()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// writeSplitOutputs writes a mapping and a deobfuscated tree per assembly the
+// protos were filtered for, reports/mapping.<assembly>.json and
+// protos/deobfuscated.<assembly>, for the consumers needing one protocol only.
+// The renamed references to the messages of the other assemblies are kept.
+func writeSplitOutputs(ctx context.Context, matches []utils.MessageMatch, filtered fs.FS, filteredDir string, obfuscated, unobfuscated *utils.Descriptor, purge bool, paths *utils.PathAnonymizer, key ed25519.PrivateKey, logger *slog.Logger) error {
+	assemblies, err := utils.LoadFileAssemblies(filtered)
+	if err != nil {
+		return err
+	}
+	if len(assemblies) == 0 {
+		logger.Warn("the assemblies of the filtered protos aren't recorded, filter them again to split the outputs")
+		return nil
+	}
+
+	files := make(map[string]map[string]bool)
+	for file, assembly := range assemblies {
+		if files[assembly] == nil {
+			files[assembly] = make(map[string]bool)
+		}
+		files[assembly][file] = true
+	}
+	groups := make(map[string][]utils.MessageMatch)
+	for _, match := range matches {
+		rel, err := filepath.Rel(filteredDir, match.ObfuscatedFile)
+		if err != nil {
+			continue
+		}
+		assembly := assemblies[filepath.ToSlash(rel)]
+		groups[assembly] = append(groups[assembly], match)
+	}
+
+	names := make([]string, 0, len(files))
+	for assembly := range files {
+		names = append(names, assembly)
+	}
+	sort.Strings(names)
+	for _, assembly := range names {
+		name := unsafeNameChars.ReplaceAllString(assembly, "_")
+		if name == "" {
+			name = "other"
+		}
+
+		mapping := utils.NewMapping(groups[assembly], obfuscated, unobfuscated)
+		mapping.Files = make(map[string]string)
+		for file := range files[assembly] {
+			path := filepath.Join(filteredDir, filepath.FromSlash(file))
+			if hash, ok := obfuscated.Files[path]; ok {
+				mapping.Files[path] = hash
+			}
+		}
+		if err := utils.WriteSignedMapping(paths.Mapping(mapping), filepath.Join("reports", "mapping."+name+".json"), key); err != nil {
+			return err
+		}
+
+		outDir := filepath.Join("protos", "deobfuscated."+name)
+		if purge {
+			if _, err := utils.PurgeProtos(outDir); err != nil {
+				return err
+			}
+		}
+		keep := func(path string) bool { return files[assembly][path] }
+		if err := utils.ApplyMatchesSubset(ctx, matches, filtered, outDir, keep); err != nil {
+			return err
+		}
+		logger.Info("outputs of the assembly written", "assembly", assembly, "matches", len(groups[assembly]), "files", len(files[assembly]))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PathAnonymizer rewrites the local paths written to reports and mappings,
+// so they can be shared without the user names and directory layout of the
+// machine. Paths under the working directory become relative to it, the
+// ones under a corpus root relative to the root, named by its base name, the
+// ones under the home directory start with ~ and the others keep their base
+// name under a digest of their directory, so two files never share a path.
+// Relative paths are left as they are. A nil anonymizer leaves every path as
+// it is.
+type PathAnonymizer struct {
+	workDir string
+	home    string
+	roots   []string
+	names   []string // Names of the roots, their base names told apart
+}
+
+// NewPathAnonymizer returns an anonymizer for the given corpus roots, the
+// directories or archives of the protos. Empty roots are ignored.
+func NewPathAnonymizer(roots ...string) *PathAnonymizer {
+	a := &PathAnonymizer{}
+	a.workDir, _ = os.Getwd()
+	a.home, _ = os.UserHomeDir()
+	named := make(map[string]int)
+	for _, root := range roots {
+		if root == "" || IsURL(root) {
+			continue
+		}
+		abs, err := filepath.Abs(root)
+		if err != nil || slices.Contains(a.roots, abs) {
+			continue
+		}
+		name := filepath.Base(abs)
+		if named[name]++; named[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, named[name])
+		}
+		a.roots = append(a.roots, abs)
+		a.names = append(a.names, name)
+	}
+	return a
+}
+
+// Path returns the anonymized form of path
+func (a *PathAnonymizer) Path(path string) string {
+	if a == nil || !filepath.IsAbs(path) {
+		return path
+	}
+	if rel, ok := under(a.workDir, path); ok {
+		return rel
+	}
+	for i, root := range a.roots {
+		if rel, ok := under(root, path); ok {
+			return filepath.Join(a.names[i], rel)
+		}
+	}
+	if rel, ok := under(a.home, path); ok {
+		return filepath.Join("~", rel)
+	}
+	digest := sha256.Sum256([]byte(filepath.Dir(path)))
+	return filepath.Join(hex.EncodeToString(digest[:4]), filepath.Base(path))
+}
+
+// Arg returns the anonymized form of a command line argument, a path or a
+// -flag=path
+func (a *PathAnonymizer) Arg(arg string) string {
+	if name, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(name, "-") {
+		return name + "=" + a.Path(value)
+	}
+	return a.Path(arg)
+}
+
+// Matches returns a copy of matches with their files anonymized
+func (a *PathAnonymizer) Matches(matches []MessageMatch) []MessageMatch {
+	if a == nil {
+		return matches
+	}
+	anonymized := make([]MessageMatch, len(matches))
+	for i, match := range matches {
+		match.ObfuscatedFile = a.Path(match.ObfuscatedFile)
+		match.OriginalFile = a.Path(match.OriginalFile)
+		if len(match.Alternatives) > 0 {
+			match.Alternatives = append([]Alternative(nil), match.Alternatives...)
+			for j := range match.Alternatives {
+				match.Alternatives[j].File = a.Path(match.Alternatives[j].File)
+			}
+		}
+		anonymized[i] = match
+	}
+	return anonymized
+}
+
+// Mapping returns a copy of mapping with its files anonymized
+func (a *PathAnonymizer) Mapping(mapping *Mapping) *Mapping {
+	if a == nil {
+		return mapping
+	}
+	anonymized := *mapping
+	anonymized.Matches = a.Matches(mapping.Matches)
+	anonymized.Files = a.hashes(mapping.Files)
+	return &anonymized
+}
+
+// Manifest returns a copy of manifest with its command line, flags, inputs
+// and files anonymized
+func (a *PathAnonymizer) Manifest(manifest *RunManifest) *RunManifest {
+	if a == nil {
+		return manifest
+	}
+	anonymized := *manifest
+	anonymized.Command = make([]string, len(manifest.Command))
+	for i, arg := range manifest.Command {
+		anonymized.Command[i] = a.Arg(arg)
+	}
+	anonymized.Flags = make(map[string]string, len(manifest.Flags))
+	for name, value := range manifest.Flags {
+		anonymized.Flags[name] = a.Path(value)
+	}
+	anonymized.Inputs = make(map[string]ManifestInput, len(manifest.Inputs))
+	for role, input := range manifest.Inputs {
+		input.Path = a.Path(input.Path)
+		input.Error = a.text(input.Error)
+		anonymized.Inputs[role] = input
+	}
+	anonymized.Obfuscated = a.hashes(manifest.Obfuscated)
+	anonymized.Clear = a.hashes(manifest.Clear)
+	return &anonymized
+}
+
+// hashes returns a copy of the hashes of files by path with the paths
+// anonymized
+func (a *PathAnonymizer) hashes(files map[string]string) map[string]string {
+	if files == nil {
+		return nil
+	}
+	anonymized := make(map[string]string, len(files))
+	for path, hash := range files {
+		anonymized[a.Path(path)] = hash
+	}
+	return anonymized
+}
+
+// text anonymizes the absolute paths of a message, like an error, word by word
+func (a *PathAnonymizer) text(message string) string {
+	words := strings.Split(message, " ")
+	for i, word := range words {
+		trimmed := strings.TrimRight(word, ":,")
+		words[i] = a.Path(trimmed) + word[len(trimmed):]
+	}
+	return strings.Join(words, " ")
+}
+
+// under returns path relative to dir when it is inside it
+func under(dir, path string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is a match decision of a run, a line of the audit log
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	Run  string    `json:"run"` // Start of the run, shared by its records
+	// accepted, uncertain when the match has alternatives, or rejected
+	Decision   string  `json:"decision"`
+	Matcher    string  `json:"matcher"`
+	Pass       int     `json:"pass,omitempty"` // Of the strict structure matcher
+	Obfuscated string  `json:"obfuscated"`
+	Original   string  `json:"original"`
+	Confidence float64 `json:"confidence"`
+	Reason     string  `json:"reason,omitempty"`
+	// The match as decided, with its enum matches and alternatives
+	Evidence *MessageMatch `json:"evidence"`
+}
+
+// AuditLog appends the match decisions of runs to a JSONL file, which is never
+// rewritten, so a contested mapping can be traced back to the run and the
+// evidence behind it. It is safe for concurrent use.
+type AuditLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	run     string
+	paths   *PathAnonymizer
+}
+
+// OpenAuditLog opens the audit log at path for a new run, creating it when
+// missing. The files of the evidence are anonymized by paths when it isn't nil.
+func OpenAuditLog(path string, paths *PathAnonymizer) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{
+		file:    file,
+		encoder: json.NewEncoder(file),
+		run:     time.Now().UTC().Format(time.RFC3339Nano),
+		paths:   paths,
+	}, nil
+}
+
+// Handle records the found and rejected matches, it is an EventHandler
+func (a *AuditLog) Handle(event Event) {
+	if event.Match == nil || (event.Kind != EventMatchFound && event.Kind != EventMatchRejected) {
+		return
+	}
+
+	decision := "accepted"
+	switch {
+	case event.Kind == EventMatchRejected:
+		decision = "rejected"
+	case len(event.Match.Alternatives) > 0:
+		decision = "uncertain"
+	}
+	matcher := event.Matcher
+	if matcher == "" {
+		matcher = event.Match.Matcher
+	}
+	evidence := event.Match
+	if a.paths != nil {
+		evidence = &a.paths.Matches([]MessageMatch{*event.Match})[0]
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.encoder.Encode(AuditRecord{
+		Time:       time.Now().UTC(),
+		Run:        a.run,
+		Decision:   decision,
+		Matcher:    matcher,
+		Pass:       event.Pass,
+		Obfuscated: event.Match.ObfuscatedMsg,
+		Original:   event.Match.OriginalMsg,
+		Confidence: event.Match.MatchPercent,
+		Reason:     event.Reason,
+		Evidence:   evidence,
+	})
+}
+
+// Close closes the file of the audit log
+func (a *AuditLog) Close() error {
+	return a.file.Close()
+}
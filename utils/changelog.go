@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GenerateChangelog describes the protocol changes between two descriptor sets:
+// added/removed messages and enums, added/removed/renumbered fields and enum value changes
+func GenerateChangelog(oldDesc, newDesc *Descriptor) string {
+	var changelog strings.Builder
+
+	changelog.WriteString("Protocol Changelog\n")
+	changelog.WriteString("==================\n")
+
+	oldMessages := flattenMessages(oldDesc.MessageType, "")
+	newMessages := flattenMessages(newDesc.MessageType, "")
+	oldEnums := flattenEnums(oldDesc)
+	newEnums := flattenEnums(newDesc)
+
+	var added, removed, changed []string
+	for _, path := range sortedKeys(newMessages) {
+		if _, exists := oldMessages[path]; !exists {
+			added = append(added, fmt.Sprintf("  + %s (%s)", path, filepath.Base(newMessages[path].SourceFile)))
+		}
+	}
+	for _, path := range sortedKeys(oldMessages) {
+		newMsg, exists := newMessages[path]
+		if !exists {
+			removed = append(removed, fmt.Sprintf("  - %s (%s)", path, filepath.Base(oldMessages[path].SourceFile)))
+			continue
+		}
+		if changes := diffFields(oldMessages[path], newMsg); len(changes) > 0 {
+			changed = append(changed, fmt.Sprintf("  ~ %s\n%s", path, strings.Join(changes, "\n")))
+		}
+	}
+
+	var addedEnums, removedEnums, changedEnums []string
+	for _, path := range sortedKeys(newEnums) {
+		if _, exists := oldEnums[path]; !exists {
+			addedEnums = append(addedEnums, fmt.Sprintf("  + %s", path))
+		}
+	}
+	for _, path := range sortedKeys(oldEnums) {
+		newEnum, exists := newEnums[path]
+		if !exists {
+			removedEnums = append(removedEnums, fmt.Sprintf("  - %s", path))
+			continue
+		}
+		if changes := diffEnumValues(oldEnums[path], newEnum); len(changes) > 0 {
+			changedEnums = append(changedEnums, fmt.Sprintf("  ~ %s\n%s", path, strings.Join(changes, "\n")))
+		}
+	}
+
+	writeChangelogSection(&changelog, "Added messages", added)
+	writeChangelogSection(&changelog, "Removed messages", removed)
+	writeChangelogSection(&changelog, "Changed messages", changed)
+	writeChangelogSection(&changelog, "Added enums", addedEnums)
+	writeChangelogSection(&changelog, "Removed enums", removedEnums)
+	writeChangelogSection(&changelog, "Changed enums", changedEnums)
+
+	changelog.WriteString(fmt.Sprintf("\nSummary: %d added, %d removed, %d changed messages; %d added, %d removed, %d changed enums\n",
+		len(added), len(removed), len(changed), len(addedEnums), len(removedEnums), len(changedEnums)))
+
+	return changelog.String()
+}
+
+func writeChangelogSection(changelog *strings.Builder, title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	changelog.WriteString(fmt.Sprintf("\n%s (%d):\n", title, len(lines)))
+	for _, line := range lines {
+		changelog.WriteString(line + "\n")
+	}
+}
+
+// Compare fields by name, so a field keeping its name with another number is reported as renumbered
+func diffFields(oldMsg, newMsg MessageType) []string {
+	var changes []string
+
+	newByName := make(map[string]Field)
+	for _, field := range newMsg.Field {
+		newByName[field.Name] = field
+	}
+	oldByName := make(map[string]bool)
+
+	for _, oldField := range oldMsg.Field {
+		oldByName[oldField.Name] = true
+		newField, exists := newByName[oldField.Name]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("      - field %s", formatField(oldField)))
+			continue
+		}
+		if oldField.Number != newField.Number {
+			changes = append(changes, fmt.Sprintf("      ~ field %s renumbered %d -> %d", oldField.Name, oldField.Number, newField.Number))
+		}
+		if oldField.Label != newField.Label || oldField.Type != newField.Type {
+			changes = append(changes, fmt.Sprintf("      ~ field %s type changed %s -> %s",
+				oldField.Name, strings.TrimSpace(oldField.Label+" "+oldField.Type), strings.TrimSpace(newField.Label+" "+newField.Type)))
+		}
+	}
+
+	for _, newField := range newMsg.Field {
+		if !oldByName[newField.Name] {
+			changes = append(changes, fmt.Sprintf("      + field %s", formatField(newField)))
+		}
+	}
+
+	return changes
+}
+
+func diffEnumValues(oldEnum, newEnum EnumType) []string {
+	var changes []string
+
+	newByName := make(map[string]int)
+	for _, value := range newEnum.Value {
+		newByName[value.Name] = value.Number
+	}
+	oldByName := make(map[string]bool)
+
+	for _, oldValue := range oldEnum.Value {
+		oldByName[oldValue.Name] = true
+		newNumber, exists := newByName[oldValue.Name]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("      - %s = %d", oldValue.Name, oldValue.Number))
+		} else if newNumber != oldValue.Number {
+			changes = append(changes, fmt.Sprintf("      ~ %s renumbered %d -> %d", oldValue.Name, oldValue.Number, newNumber))
+		}
+	}
+
+	for _, newValue := range newEnum.Value {
+		if !oldByName[newValue.Name] {
+			changes = append(changes, fmt.Sprintf("      + %s = %d", newValue.Name, newValue.Number))
+		}
+	}
+
+	return changes
+}
+
+func formatField(field Field) string {
+	return fmt.Sprintf("%s %s = %d", strings.TrimSpace(field.Label+" "+field.Type), field.Name, field.Number)
+}
+
+// Index every message, including nested ones, by its dotted path
+func flattenMessages(messages []MessageType, parentPath string) map[string]MessageType {
+	flat := make(map[string]MessageType)
+	for _, msg := range messages {
+		path := msg.Name
+		if parentPath != "" {
+			path = parentPath + "." + msg.Name
+		}
+		flat[path] = msg
+		for nestedPath, nested := range flattenMessages(msg.NestedType, path) {
+			if nested.SourceFile == "" {
+				nested.SourceFile = msg.SourceFile
+			}
+			flat[nestedPath] = nested
+		}
+	}
+	return flat
+}
+
+// Index every enum, including the ones nested in messages, by its dotted path
+func flattenEnums(desc *Descriptor) map[string]EnumType {
+	flat := make(map[string]EnumType)
+	for _, enum := range desc.EnumType {
+		flat[enum.Name] = enum
+	}
+	for path, msg := range flattenMessages(desc.MessageType, "") {
+		for _, enum := range msg.EnumType {
+			flat[path+"."+enum.Name] = enum
+		}
+	}
+	return flat
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
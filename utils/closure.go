@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// wellKnownFiles are the files of the well-known types a standalone proto
+// can still import, by type name
+var wellKnownFiles = map[string]string{
+	"Any":         "any.proto",
+	"Duration":    "duration.proto",
+	"Empty":       "empty.proto",
+	"FieldMask":   "field_mask.proto",
+	"Struct":      "struct.proto",
+	"Value":       "struct.proto",
+	"ListValue":   "struct.proto",
+	"NullValue":   "struct.proto",
+	"Timestamp":   "timestamp.proto",
+	"DoubleValue": "wrappers.proto",
+	"FloatValue":  "wrappers.proto",
+	"Int64Value":  "wrappers.proto",
+	"UInt64Value": "wrappers.proto",
+	"Int32Value":  "wrappers.proto",
+	"UInt32Value": "wrappers.proto",
+	"BoolValue":   "wrappers.proto",
+	"StringValue": "wrappers.proto",
+	"BytesValue":  "wrappers.proto",
+}
+
+// FindMessage returns the message of files named name, by its full name or
+// its name alone, nested ones included. A name several messages have is an
+// error listing them.
+func FindMessage(files *protoregistry.Files, name string) (protoreflect.MessageDescriptor, error) {
+	if desc, err := files.FindDescriptorByName(protoreflect.FullName(name)); err == nil {
+		if msg, ok := desc.(protoreflect.MessageDescriptor); ok {
+			return msg, nil
+		}
+	}
+
+	var found []protoreflect.Descriptor
+	for _, desc := range declarationsNamed(files, name) {
+		if _, ok := desc.(protoreflect.MessageDescriptor); ok {
+			found = append(found, desc)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("message %s not found", name)
+	case 1:
+		return found[0].(protoreflect.MessageDescriptor), nil
+	}
+	names := make([]string, len(found))
+	for i, msg := range found {
+		names[i] = string(msg.FullName())
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("several messages are named %s, give the full name of one: %s", name, strings.Join(names, ", "))
+}
+
+// declarationsNamed returns the messages and enums of files named name,
+// nested ones included
+func declarationsNamed(files *protoregistry.Files, name string) []protoreflect.Descriptor {
+	var found []protoreflect.Descriptor
+	var walkEnums func(enums protoreflect.EnumDescriptors)
+	walkEnums = func(enums protoreflect.EnumDescriptors) {
+		for i := 0; i < enums.Len(); i++ {
+			if string(enums.Get(i).Name()) == name {
+				found = append(found, enums.Get(i))
+			}
+		}
+	}
+	var walk func(messages protoreflect.MessageDescriptors)
+	walk = func(messages protoreflect.MessageDescriptors) {
+		for i := 0; i < messages.Len(); i++ {
+			msg := messages.Get(i)
+			if string(msg.Name()) == name {
+				found = append(found, msg)
+			}
+			walkEnums(msg.Enums())
+			walk(msg.Messages())
+		}
+	}
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		walkEnums(file.Enums())
+		walk(file.Messages())
+		return true
+	})
+	return found
+}
+
+// resolvePlaceholder returns the declaration of files a placeholder stands
+// for. The files of an import cycle only see placeholders of each other, by
+// full name, and the ones of the types they couldn't resolve are named
+// *.Name, found when a single declaration has the name.
+func resolvePlaceholder(files *protoregistry.Files, placeholder protoreflect.Descriptor) (protoreflect.Descriptor, bool) {
+	name := string(placeholder.FullName())
+	if relative, ok := strings.CutPrefix(name, "*."); ok {
+		found := declarationsNamed(files, relative[strings.LastIndex(relative, ".")+1:])
+		var matching []protoreflect.Descriptor
+		for _, desc := range found {
+			if strings.HasSuffix("."+string(desc.FullName()), "."+relative) {
+				matching = append(matching, desc)
+			}
+		}
+		if len(matching) == 1 {
+			return matching[0], true
+		}
+		return nil, false
+	}
+	resolved, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	return resolved, err == nil
+}
+
+// ExtractMessage writes a standalone proto file declaring msg and every
+// message and enum it references, transitively. The declarations are written
+// whole, as top-level ones, in the package of msg: the names of the other
+// packages lose their package, and two declarations of the same name are an
+// error. The well-known types are imported, the other types files don't
+// resolve are an error.
+func ExtractMessage(files *protoregistry.Files, msg protoreflect.MessageDescriptor) ([]byte, error) {
+	closure := &messageClosure{files: files, seen: make(map[protoreflect.FullName]bool), imports: make(map[string]bool)}
+	closure.add(topLevelDeclaration(msg))
+	for i := 0; i < len(closure.declarations); i++ {
+		if message, ok := closure.declarations[i].(protoreflect.MessageDescriptor); ok {
+			closure.visitMessage(message)
+		}
+	}
+	if len(closure.unresolved) > 0 {
+		sort.Strings(closure.unresolved)
+		return nil, fmt.Errorf("types declared by no loaded file: %s", strings.Join(closure.unresolved, ", "))
+	}
+
+	// The message first, the declarations it references after it by name
+	rest := closure.declarations[1:]
+	sort.Slice(rest, func(i, j int) bool { return relativeName(rest[i]) < relativeName(rest[j]) })
+	names := make(map[string]protoreflect.FullName)
+	for _, declaration := range closure.declarations {
+		name := relativeName(declaration)
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("%s and %s have the same name once in one package", other, declaration.FullName())
+		}
+		names[name] = declaration.FullName()
+	}
+
+	file := msg.ParentFile()
+	var out bytes.Buffer
+	if file.Syntax() == protoreflect.Proto2 {
+		out.WriteString("syntax = \"proto2\";\n")
+	} else {
+		out.WriteString("syntax = \"proto3\";\n")
+	}
+	if file.Package() != "" {
+		fmt.Fprintf(&out, "\npackage %s;\n", file.Package())
+	}
+	if len(closure.imports) > 0 {
+		out.WriteString("\n")
+		for _, imported := range sortedKeys(closure.imports) {
+			fmt.Fprintf(&out, "import \"%s\";\n", imported)
+		}
+	}
+	printer := &protoPrinter{out: &out, files: files, pkg: string(file.Package()), proto2: file.Syntax() == protoreflect.Proto2}
+	for _, declaration := range closure.declarations {
+		out.WriteString("\n")
+		switch declaration := declaration.(type) {
+		case protoreflect.MessageDescriptor:
+			printer.message(declaration, "")
+		case protoreflect.EnumDescriptor:
+			printer.enum(declaration, "")
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// messageClosure gathers the top-level declarations a message references
+type messageClosure struct {
+	files        *protoregistry.Files
+	declarations []protoreflect.Descriptor
+	seen         map[protoreflect.FullName]bool
+	imports      map[string]bool
+	unresolved   []string
+}
+
+func (c *messageClosure) add(declaration protoreflect.Descriptor) {
+	if !c.seen[declaration.FullName()] {
+		c.seen[declaration.FullName()] = true
+		c.declarations = append(c.declarations, declaration)
+	}
+}
+
+// visitMessage adds the declarations the fields of msg and of its nested
+// messages reference
+func (c *messageClosure) visitMessage(msg protoreflect.MessageDescriptor) {
+	fields := msg.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		var referenced protoreflect.Descriptor
+		switch {
+		case field.Message() != nil:
+			referenced = field.Message()
+		case field.Enum() != nil:
+			referenced = field.Enum()
+		default:
+			continue
+		}
+		c.reference(referenced)
+	}
+	nested := msg.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		c.visitMessage(nested.Get(i))
+	}
+}
+
+func (c *messageClosure) reference(referenced protoreflect.Descriptor) {
+	name := referenced.FullName()
+	if wellKnown(referenced) {
+		if file, ok := wellKnownFiles[string(name.Name())]; ok {
+			c.imports["google/protobuf/"+file] = true
+			return
+		}
+	}
+	if referenced.IsPlaceholder() {
+		resolved, ok := resolvePlaceholder(c.files, referenced)
+		if !ok {
+			if !c.seen[name] {
+				c.seen[name] = true
+				c.unresolved = append(c.unresolved, strings.TrimPrefix(string(name), "*."))
+			}
+			return
+		}
+		referenced = resolved
+	}
+	c.add(topLevelDeclaration(referenced))
+}
+
+// wellKnown tells whether desc is a type of the google.protobuf package,
+// which the files don't declare
+func wellKnown(desc protoreflect.Descriptor) bool {
+	return strings.HasPrefix(strings.TrimPrefix(string(desc.FullName()), "*."), "google.protobuf.")
+}
+
+// topLevelDeclaration returns the top-level message or enum declaring desc
+func topLevelDeclaration(desc protoreflect.Descriptor) protoreflect.Descriptor {
+	for {
+		parent := desc.Parent()
+		if parent == nil {
+			return desc
+		}
+		if _, ok := parent.(protoreflect.FileDescriptor); ok {
+			return desc
+		}
+		desc = parent
+	}
+}
+
+// relativeName returns the name of desc in its package
+func relativeName(desc protoreflect.Descriptor) string {
+	name := string(desc.FullName())
+	if pkg := string(desc.ParentFile().Package()); pkg != "" {
+		name = strings.TrimPrefix(name, pkg+".")
+	}
+	return name
+}
+
+// protoPrinter writes messages and enums as proto source
+type protoPrinter struct {
+	out    *bytes.Buffer
+	files  *protoregistry.Files
+	pkg    string // Package of the extracted file, declaring every type
+	proto2 bool
+}
+
+func (p *protoPrinter) message(msg protoreflect.MessageDescriptor, indent string) {
+	fmt.Fprintf(p.out, "%smessage %s {\n", indent, msg.Name())
+	fields := msg.Fields()
+	printed := make(map[protoreflect.FullName]bool)
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		oneof := field.ContainingOneof()
+		if oneof == nil || oneof.IsSynthetic() {
+			p.field(field, indent+"  ")
+			continue
+		}
+		if printed[oneof.FullName()] {
+			continue
+		}
+		printed[oneof.FullName()] = true
+		fmt.Fprintf(p.out, "%s  oneof %s {\n", indent, oneof.Name())
+		members := oneof.Fields()
+		for j := 0; j < members.Len(); j++ {
+			p.field(members.Get(j), indent+"    ")
+		}
+		fmt.Fprintf(p.out, "%s  }\n", indent)
+	}
+
+	nested := msg.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		if !nested.Get(i).IsMapEntry() {
+			p.message(nested.Get(i), indent+"  ")
+		}
+	}
+	enums := msg.Enums()
+	for i := 0; i < enums.Len(); i++ {
+		p.enum(enums.Get(i), indent+"  ")
+	}
+	fmt.Fprintf(p.out, "%s}\n", indent)
+}
+
+func (p *protoPrinter) field(field protoreflect.FieldDescriptor, indent string) {
+	label := ""
+	switch {
+	case field.IsMap():
+	case field.Cardinality() == protoreflect.Repeated:
+		label = "repeated "
+	case field.ContainingOneof() != nil && !field.ContainingOneof().IsSynthetic():
+	case field.Cardinality() == protoreflect.Required:
+		label = "required "
+	case p.proto2 || field.HasOptionalKeyword():
+		label = "optional "
+	}
+
+	fieldType := p.typeName(field)
+	if field.IsMap() {
+		fieldType = fmt.Sprintf("map<%s, %s>", p.typeName(field.MapKey()), p.typeName(field.MapValue()))
+	}
+	fmt.Fprintf(p.out, "%s%s%s %s = %d;\n", indent, label, fieldType, field.Name(), field.Number())
+}
+
+func (p *protoPrinter) enum(enum protoreflect.EnumDescriptor, indent string) {
+	fmt.Fprintf(p.out, "%senum %s {\n", indent, enum.Name())
+	values := enum.Values()
+	for i := 0; i < values.Len(); i++ {
+		fmt.Fprintf(p.out, "%s  %s = %d;\n", indent, values.Get(i).Name(), values.Get(i).Number())
+	}
+	fmt.Fprintf(p.out, "%s}\n", indent)
+}
+
+// typeName returns the type of a field as written in the extracted file,
+// the references fully qualified so no declaration of a nested scope shadows
+// them
+func (p *protoPrinter) typeName(field protoreflect.FieldDescriptor) string {
+	var referenced protoreflect.Descriptor
+	switch {
+	case field.Message() != nil:
+		referenced = field.Message()
+	case field.Enum() != nil:
+		referenced = field.Enum()
+	default:
+		return field.Kind().String()
+	}
+	if wellKnown(referenced) {
+		return "." + strings.TrimPrefix(string(referenced.FullName()), "*.")
+	}
+	// Placeholders have no file, their name is looked up like the closure did
+	if referenced.IsPlaceholder() {
+		resolved, ok := resolvePlaceholder(p.files, referenced)
+		if !ok {
+			return string(referenced.FullName())
+		}
+		referenced = resolved
+	}
+	if p.pkg == "" {
+		return "." + relativeName(referenced)
+	}
+	return "." + p.pkg + "." + relativeName(referenced)
+}
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/utils/frame"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// MessageRegistry holds the compiled descriptors of every top-level message of a proto directory
+type MessageRegistry struct {
+	messages map[string]protoreflect.MessageDescriptor
+	// Obfuscated name -> name in the registry, for messages renamed by ApplyMatches
+	renames map[string]string
+	// Protocol id -> obfuscated name
+	ids map[int]string
+	// Files which failed to compile
+	Skipped []string
+}
+
+// LoadMessageRegistry compiles the proto files of dir. The matches are used to
+// find renamed messages from their obfuscated names.
+func LoadMessageRegistry(dir string, matches []MessageMatch) (*MessageRegistry, error) {
+	registry := &MessageRegistry{
+		messages: make(map[string]protoreflect.MessageDescriptor),
+		renames:  BuildRenameMap(matches),
+		ids:      make(map[int]string),
+	}
+	for _, match := range matches {
+		if match.MessageId != 0 {
+			registry.ids[match.MessageId] = match.ObfuscatedMsg
+		}
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(info.Name()) != ".proto" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		file, err := compileProto(dir, filepath.ToSlash(rel))
+		if err != nil {
+			// Some extracted files have import cycles, their messages can't be decoded
+			registry.Skipped = append(registry.Skipped, rel)
+			return nil
+		}
+
+		for i := 0; i < file.Messages().Len(); i++ {
+			msg := file.Messages().Get(i)
+			registry.messages[string(msg.Name())] = msg
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// Find returns the descriptor of a message from its obfuscated or deobfuscated name
+func (r *MessageRegistry) Find(name string) (protoreflect.MessageDescriptor, bool) {
+	if renamed, ok := r.renames[name]; ok {
+		name = renamed
+	}
+	msg, ok := r.messages[name]
+	return msg, ok
+}
+
+// FindById returns the descriptor of a message from its protocol id
+func (r *MessageRegistry) FindById(id int) (protoreflect.MessageDescriptor, bool) {
+	name, ok := r.ids[id]
+	if !ok {
+		return nil, false
+	}
+	return r.Find(name)
+}
+
+// FindEnvelope returns the top-level message wrapping every protocol message
+func (r *MessageRegistry) FindEnvelope() (protoreflect.MessageDescriptor, error) {
+	var candidates []string
+	for name, msg := range r.messages {
+		if frame.IsEnvelope(msg) {
+			candidates = append(candidates, name)
+		}
+	}
+
+	if len(candidates) != 1 {
+		sort.Strings(candidates)
+		return nil, fmt.Errorf("found %d envelope candidates (%s), set the envelope explicitly", len(candidates), strings.Join(candidates, ", "))
+	}
+	return r.messages[candidates[0]], nil
+}
+
+// FindMessageByName implements protoregistry.MessageTypeResolver for protojson
+func (r *MessageRegistry) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if msg, ok := r.Find(string(name.Name())); ok {
+		return dynamicpb.NewMessageType(msg), nil
+	}
+	return protoregistry.GlobalTypes.FindMessageByName(name)
+}
+
+// FindMessageByURL implements protoregistry.MessageTypeResolver for protojson
+func (r *MessageRegistry) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	name := url[strings.LastIndex(url, "/")+1:]
+	return r.FindMessageByName(protoreflect.FullName(name))
+}
+
+func (r *MessageRegistry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return nil, protoregistry.NotFound
+}
+
+func (r *MessageRegistry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return nil, protoregistry.NotFound
+}
+
+// DecodedMessage is a protocol message decoded from the traffic
+type DecodedMessage struct {
+	Kind    string // Envelope member, like request, response or event
+	Uid     int64
+	Type    string // Name from the type URL, before deobfuscation
+	Name    string
+	Body    string // JSON
+	Payload []byte // Raw message, as captured
+}
+
+// TrafficDecoder splits the data of TCP flows into frames and decodes them
+// with the envelope message
+type TrafficDecoder struct {
+	registry  *MessageRegistry
+	envelope  protoreflect.MessageDescriptor
+	splitters map[string]*frame.Splitter
+}
+
+func NewTrafficDecoder(registry *MessageRegistry, envelope protoreflect.MessageDescriptor) *TrafficDecoder {
+	return &TrafficDecoder{
+		registry:  registry,
+		envelope:  envelope,
+		splitters: make(map[string]*frame.Splitter),
+	}
+}
+
+// Feed appends data received on a flow and decodes every complete frame
+func (d *TrafficDecoder) Feed(flow string, data []byte) ([]DecodedMessage, []error) {
+	splitter, ok := d.splitters[flow]
+	if !ok {
+		splitter = &frame.Splitter{}
+		d.splitters[flow] = splitter
+	}
+
+	var errs []error
+	frames, err := splitter.Feed(data)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", flow, err))
+	}
+
+	var messages []DecodedMessage
+	for _, f := range frames {
+		msg, err := d.decodeFrame(f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, errs
+}
+
+func (d *TrafficDecoder) decodeFrame(data []byte) (*DecodedMessage, error) {
+	envelope, err := frame.ParseEnvelope(d.envelope, data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := &DecodedMessage{
+		Kind:    envelope.Kind,
+		Uid:     envelope.Uid,
+		Type:    envelope.TypeName(),
+		Name:    envelope.TypeName(),
+		Payload: envelope.Value,
+	}
+	desc, ok := d.registry.Find(decoded.Name)
+	if !ok {
+		return decoded, nil
+	}
+	decoded.Name = string(desc.Name())
+
+	content := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(envelope.Value, content); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", decoded.Name, err)
+	}
+
+	body, err := protojson.MarshalOptions{Resolver: d.registry}.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("formatting %s: %w", decoded.Name, err)
+	}
+	decoded.Body = string(body)
+
+	return decoded, nil
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// The descriptor model and the filtering live in the public descriptor
+// package, the matches in the mapping package with the files they are
+// written to
+type (
+	Descriptor      = descriptor.Descriptor
+	MessageType     = descriptor.MessageType
+	Field           = descriptor.Field
+	OneOfDecl       = descriptor.OneOfDecl
+	EnumType        = descriptor.EnumType
+	EnumValue       = descriptor.EnumValue
+	ParseError      = descriptor.ParseError
+	ParseFailure    = descriptor.ParseFailure
+	Config          = descriptor.FilterConfig
+	FilterFailures  = descriptor.FilterFailures
+	FilterStats     = descriptor.FilterStats
+	AssemblyStats   = descriptor.AssemblyStats
+	OverlappingFile = descriptor.OverlappingFile
+	FileAliases     = descriptor.FileAliases
+	FileAssemblies  = descriptor.FileAssemblies
+	HintError       = descriptor.HintError
+
+	EnumMatch    = mapping.EnumMatch
+	MessageMatch = mapping.MessageMatch
+	Alternative  = mapping.Alternative
+	FieldMapping = mapping.FieldMapping
+)
+
+const (
+	SyntaxNormalize = descriptor.SyntaxNormalize
+	SyntaxPreserve  = descriptor.SyntaxPreserve
+)
+
+// LoadAndParseProtos parses the proto files of a directory or a .zip/.tar.gz
+// archive named in filter, every one when filter is empty
+func LoadAndParseProtos(ctx context.Context, dir string, filter []string, logger *slog.Logger) (*Descriptor, error) {
+	fsys, err := descriptor.OpenSource(dir)
+	if err != nil {
+		return nil, err
+	}
+	return descriptor.LoadFiles(ctx, fsys, dir, filter, logger)
+}
+
+// LoadAndParseProtosFS parses the proto files of fsys named in filter, every
+// one when filter is empty, reporting their source files relative to name
+func LoadAndParseProtosFS(ctx context.Context, fsys fs.FS, name string, filter []string, logger *slog.Logger) (*Descriptor, error) {
+	return descriptor.LoadFiles(ctx, fsys, name, filter, logger)
+}
+
+// ParseProtoFile parses the content of a single proto file
+func ParseProtoFile(content string) (*Descriptor, error) {
+	return descriptor.Parse(content)
+}
+
+// IsArchive tells whether path is a proto archive supported by OpenProtoSource
+func IsArchive(path string) bool {
+	return descriptor.IsArchive(path)
+}
+
+// OpenProtoSource opens a directory or a .zip/.tar.gz archive of proto files
+func OpenProtoSource(path string) (fs.FS, error) {
+	return descriptor.OpenSource(path)
+}
+
+// FilterProtoFiles processes proto files according to the given configuration
+func FilterProtoFiles(config Config) error {
+	return descriptor.FilterFiles(config)
+}
+
+// FilterProtoFilesFS is FilterProtoFiles keeping the filtered files in memory
+func FilterProtoFilesFS(config Config) (fs.FS, error) {
+	return descriptor.FilterFS(config)
+}
+
+// ValidateSyntax checks syntax is a value of Config.Syntax
+func ValidateSyntax(syntax string) error {
+	return descriptor.ValidateSyntax(syntax)
+}
+
+// LoadFileAliases reads the aliases the filtering recorded in fsys
+func LoadFileAliases(fsys fs.FS) (FileAliases, error) {
+	return descriptor.LoadFileAliases(fsys)
+}
+
+// LoadFileAssemblies reads the assemblies the filtering recorded in fsys
+func LoadFileAssemblies(fsys fs.FS) (FileAssemblies, error) {
+	return descriptor.LoadFileAssemblies(fsys)
+}
+
+// PurgeProtos removes the proto files below dir, returning how many
+func PurgeProtos(dir string) (int, error) {
+	return descriptor.PurgeProtos(dir)
+}
+
+// SelectMessages returns the messages of desc matching include and not exclude
+func SelectMessages(desc *Descriptor, include, exclude []string, references bool) (*Descriptor, error) {
+	return descriptor.SelectMessages(desc, include, exclude, references)
+}
+
+// WithoutMessages returns a copy of desc without the given top-level messages
+func WithoutMessages(desc *Descriptor, names map[string]bool) *Descriptor {
+	return descriptor.WithoutMessages(desc, names)
+}
+
+// CorpusHash hashes the content of every file of a corpus
+func CorpusHash(desc *Descriptor) string {
+	return descriptor.CorpusHash(desc)
+}
+
+// FileDescriptorProto converts the descriptor of a single proto file
+func FileDescriptorProto(desc *Descriptor, path string) (*descriptorpb.FileDescriptorProto, error) {
+	return descriptor.FileDescriptorProto(desc, path)
+}
+
+// NewFileDescriptor converts the descriptor of a single proto file to a
+// protoreflect.FileDescriptor
+func NewFileDescriptor(desc *Descriptor, path string, files *protoregistry.Files) (protoreflect.FileDescriptor, error) {
+	return descriptor.FileDescriptor(desc, path, files)
+}
+
+// NewProtoRegistry converts every proto file of fsys and registers them
+func NewProtoRegistry(fsys fs.FS) (*protoregistry.Files, []string, error) {
+	return descriptor.Registry(fsys)
+}
+
+// DiscoveredAssembly is an assembly declared by proto files of a protodec output
+type DiscoveredAssembly = descriptor.DiscoveredAssembly
+
+// DiscoverAssemblies lists the assemblies the proto files of fsys declare
+func DiscoverAssemblies(fsys fs.FS) ([]DiscoveredAssembly, error) {
+	return descriptor.DiscoverAssemblies(fsys)
+}
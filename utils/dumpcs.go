@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+var (
+	dumpClassRegex = regexp.MustCompile(`^\s*(?:(?:public|internal|private|protected|sealed|abstract|static|partial)\s+)*class\s+(\w+)`)
+	// Constant fields holding the protocol id of a generated class
+	dumpIdRegex = regexp.MustCompile(`^\s*(?:public|internal)\s+const\s+(?:int|uint|short|ushort|long)\s+(?:ProtocolId|MessageId|Id|PROTOCOL_ID|MESSAGE_ID)\s*=\s*(\d+)\s*;`)
+	// Registration table entries like `{ 1234, typeof(Foo) }` when the dumper kept the initializers
+	dumpRegistrationRegex = regexp.MustCompile(`\{\s*(\d+)\s*,\s*typeof\((?:[\w.]+\.)?(\w+)\)\s*\}`)
+)
+
+// ParseMessageIds reads the dump.cs written by Il2CppDumper and returns the
+// protocol id of every class declaring one, by class name
+func ParseMessageIds(dumpFile string) (map[string]int, error) {
+	file, err := os.Open(dumpFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ids := make(map[string]int)
+	currentClass := ""
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if match := dumpClassRegex.FindStringSubmatch(line); match != nil {
+			currentClass = match[1]
+			continue
+		}
+
+		if match := dumpIdRegex.FindStringSubmatch(line); match != nil && currentClass != "" {
+			if id, err := strconv.Atoi(match[1]); err == nil {
+				ids[currentClass] = id
+			}
+			continue
+		}
+
+		for _, match := range dumpRegistrationRegex.FindAllStringSubmatch(line, -1) {
+			if id, err := strconv.Atoi(match[1]); err == nil {
+				ids[match[2]] = id
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dumpFile, err)
+	}
+
+	return ids, nil
+}
+
+// AssignMessageIds stores the protocol ids on the top-level messages of desc,
+// returning how many messages got one
+func AssignMessageIds(desc *Descriptor, ids map[string]int) int {
+	assigned := 0
+	for i := range desc.MessageType {
+		if id, ok := ids[desc.MessageType[i].Name]; ok {
+			desc.MessageType[i].Id = id
+			assigned++
+		}
+	}
+	return assigned
+}
+
+// SetMatchIds copies the protocol ids of the obfuscated messages to their matches
+func SetMatchIds(matches []MessageMatch, obfuscated *Descriptor) {
+	ids := make(map[string]int)
+	for _, msg := range obfuscated.MessageType {
+		if msg.Id != 0 {
+			ids[msg.Name] = msg.Id
+		}
+	}
+	for i := range matches {
+		matches[i].MessageId = ids[matches[i].ObfuscatedMsg]
+	}
+}
+
+// SeedsById names the top-level messages of desc like the matches of a
+// previous mapping with the same protocol id: the ids stay when the obfuscated
+// names are re-rolled between builds. Uncertain matches aren't carried.
+func SeedsById(desc *Descriptor, previous []MessageMatch, source string) []Seed {
+	originals := make(map[int]string)
+	for _, match := range previous {
+		if match.MessageId != 0 && len(match.Alternatives) == 0 {
+			originals[match.MessageId] = match.OriginalMsg
+		}
+	}
+
+	var seeds []Seed
+	for _, msg := range desc.MessageType {
+		if original, ok := originals[msg.Id]; ok && msg.Id != 0 {
+			seeds = append(seeds, Seed{Obfuscated: msg.Name, Original: original, Source: fmt.Sprintf("%s:id:%d", source, msg.Id)})
+		}
+	}
+	return seeds
+}
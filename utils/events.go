@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/ruinedyourlife/deobfs/pkg/event"
+)
+
+// The events live in the public event package
+type (
+	EventKind    = event.Kind
+	Event        = event.Event
+	EventHandler = event.Handler
+)
+
+const (
+	EventFileParsed    = event.FileParsed
+	EventMatchFound    = event.MatchFound
+	EventMatchRejected = event.MatchRejected
+	EventPassComplete  = event.PassComplete
+	EventStageStarted  = event.StageStarted
+	EventStageComplete = event.StageComplete
+	EventProgress      = event.Progress // See NDJSONEvents
+)
+
+// WithEventHandler returns a context whose runs send their events to handler.
+// The handlers of ctx still get them.
+func WithEventHandler(ctx context.Context, handler EventHandler) context.Context {
+	return event.WithHandler(ctx, handler)
+}
+
+// EmitEvent sends event to the handler of ctx, if any
+func EmitEvent(ctx context.Context, e Event) {
+	event.Emit(ctx, e)
+}
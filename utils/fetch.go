@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultClearProtosURL is the community snapshot of clear proto files
+const DefaultClearProtosURL = "https://github.com/LuaxY/dofus-unity-protocol-builder/archive/HEAD.zip"
+
+// FetchClearProtos downloads a zip archive of clear proto files, caches it and
+// extracts its proto files into outputDir. It returns the number of files extracted.
+func FetchClearProtos(url, outputDir string, refresh bool, logger *slog.Logger) (int, error) {
+	archive, _, err := cachedDownload(url, refresh, logger)
+	if err != nil {
+		return 0, err
+	}
+
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return 0, fmt.Errorf("opening archive %s: %w", archive, err)
+	}
+	defer reader.Close()
+
+	var protos []*zip.File
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() && strings.HasSuffix(file.Name, ".proto") {
+			protos = append(protos, file)
+		}
+	}
+	if len(protos) == 0 {
+		return 0, fmt.Errorf("no proto files found in %s", url)
+	}
+
+	// Keep the hierarchy below the deepest directory shared by all proto files
+	prefix := path.Dir(protos[0].Name)
+	for _, file := range protos[1:] {
+		for prefix != "." && !strings.HasPrefix(file.Name, prefix+"/") {
+			prefix = path.Dir(prefix)
+		}
+	}
+
+	for _, file := range protos {
+		rel := strings.TrimPrefix(file.Name, prefix+"/")
+		destination := filepath.Join(outputDir, filepath.FromSlash(rel))
+		if !strings.HasPrefix(destination, filepath.Clean(outputDir)+string(os.PathSeparator)) {
+			return 0, fmt.Errorf("invalid file path in archive: %s", file.Name)
+		}
+		if err := extractZipFile(file, destination); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(protos), nil
+}
+
+// Download url into the user cache directory, reusing a previous download unless refresh is set.
+// It also tells whether the file was just downloaded.
+func cachedDownload(url string, refresh bool, logger *slog.Logger) (string, bool, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", false, err
+	}
+	cacheDir = filepath.Join(cacheDir, "deobfs")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", false, err
+	}
+
+	// Keep the archive extension, OpenProtoSource relies on it
+	extension := ".zip"
+	if IsArchive(url) && !strings.HasSuffix(strings.ToLower(url), ".zip") {
+		extension = ".tar.gz"
+	}
+
+	hash := sha256.Sum256([]byte(url))
+	cached := filepath.Join(cacheDir, hex.EncodeToString(hash[:8])+extension)
+	if _, err := os.Stat(cached); err == nil && !refresh {
+		logger.Info("using cached archive", "file", cached)
+		return cached, false, nil
+	}
+
+	logger.Info("downloading archive", "url", url)
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+
+	// Write to a temporary file first so an interrupted download isn't cached
+	tmp, err := os.CreateTemp(cacheDir, "download-*")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", false, err
+	}
+
+	return cached, true, os.Rename(tmp.Name(), cached)
+}
+
+// IsURL tells whether a source is to be downloaded
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// FetchSource downloads a proto archive, reusing the cached copy when there is
+// one, and returns its local path. When checksum (a sha256 in hex) is set, the
+// archive must match it; a cached copy which doesn't is downloaded again.
+func FetchSource(url, checksum string, logger *slog.Logger) (string, error) {
+	archive, fresh, err := cachedDownload(url, false, logger)
+	if err != nil {
+		return "", err
+	}
+	if checksum == "" {
+		return archive, nil
+	}
+
+	if err := verifySHA256(archive, checksum); err != nil {
+		if fresh {
+			os.Remove(archive)
+			return "", err
+		}
+		logger.Warn("cached archive doesn't match the checksum, downloading it again", "error", err)
+		if archive, _, err = cachedDownload(url, true, logger); err != nil {
+			return "", err
+		}
+		if err := verifySHA256(archive, checksum); err != nil {
+			os.Remove(archive)
+			return "", err
+		}
+	}
+	return archive, nil
+}
+
+func verifySHA256(file, checksum string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, sum)
+	}
+	return nil
+}
+
+func extractZipFile(file *zip.File, destination string) error {
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	_, err = io.Copy(dest, src)
+	return err
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+)
+
+// The matches whose aligned fields disagree on their numbers
+type (
+	FieldNumberMismatch = match.FieldNumberMismatch
+	SuspiciousMatch     = match.SuspiciousMatch
+)
+
+// GenerateFieldNumberReport writes the suspicious matches with the fields
+// whose numbers disagree
+func GenerateFieldNumberReport(suspicious []SuspiciousMatch, outputFile string) error {
+	var report strings.Builder
+	report.WriteString("Field Number Mismatches (suspicious matches)\n")
+	report.WriteString("============================================\n\n")
+
+	for _, entry := range suspicious {
+		match := entry.Match
+		report.WriteString(fmt.Sprintf("%s  →  %s  [%s, conf: %.2f%%]\n", match.ObfuscatedMsg, match.OriginalMsg, match.Matcher, match.MatchPercent))
+		for _, mismatch := range entry.Mismatches {
+			report.WriteString(fmt.Sprintf("    field %d: %s = %d  vs  %s = %d\n", mismatch.Position+1,
+				mismatch.Obfuscated, mismatch.ObfuscatedNumber, mismatch.Original, mismatch.OriginalNumber))
+		}
+	}
+	report.WriteString(fmt.Sprintf("\nTotal suspicious matches: %d\n", len(suspicious)))
+
+	if err := os.WriteFile(outputFile, []byte(report.String()), 0644); err != nil {
+		return reportError(outputFile, err)
+	}
+	return nil
+}
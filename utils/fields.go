@@ -0,0 +1,39 @@
+package utils
+
+// SetFieldMappings pairs the fields of every definitive match with the fields
+// of its original message having the same number. The obfuscation keeps the
+// field numbers, only their names change.
+func SetFieldMappings(matches []MessageMatch, obfuscated, unobfuscated *Descriptor) {
+	obfuscatedMsgs := messagesByName(obfuscated)
+	originalMsgs := messagesByName(unobfuscated)
+	for i := range matches {
+		match := &matches[i]
+		match.Fields = nil
+		obsMsg, unobsMsg := obfuscatedMsgs[match.ObfuscatedMsg], originalMsgs[match.OriginalMsg]
+		if len(match.Alternatives) > 0 || obsMsg == nil || unobsMsg == nil {
+			continue
+		}
+
+		originalFields := make(map[int]string)
+		for _, field := range unobsMsg.Field {
+			originalFields[field.Number] = field.Name
+		}
+		for _, field := range obsMsg.Field {
+			if original, ok := originalFields[field.Number]; ok {
+				match.Fields = append(match.Fields, FieldMapping{
+					Number:     field.Number,
+					Obfuscated: field.Name,
+					Original:   original,
+				})
+			}
+		}
+	}
+}
+
+func messagesByName(desc *Descriptor) map[string]*MessageType {
+	messages := make(map[string]*MessageType, len(desc.MessageType))
+	for i := range desc.MessageType {
+		messages[desc.MessageType[i].Name] = &desc.MessageType[i]
+	}
+	return messages
+}
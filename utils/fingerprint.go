@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CorpusFingerprint describes the structure of a proto corpus, ignoring the
+// names which change with every obfuscation
+type CorpusFingerprint struct {
+	Hash       string         `json:"hash"`
+	RecordedAt time.Time      `json:"recordedAt"`
+	Messages   map[string]int `json:"messages"` // Message fingerprint -> number of messages having it
+}
+
+// FingerprintCorpus computes the structural fingerprint of every top-level message
+func FingerprintCorpus(desc *Descriptor) *CorpusFingerprint {
+	fingerprint := &CorpusFingerprint{
+		RecordedAt: time.Now().UTC(),
+		Messages:   make(map[string]int),
+	}
+
+	for _, msg := range desc.MessageType {
+		fingerprint.Messages[MessageFingerprint(msg)]++
+	}
+
+	hash := sha256.New()
+	for _, key := range sortedKeys(fingerprint.Messages) {
+		fmt.Fprintf(hash, "%s:%d\n", key, fingerprint.Messages[key])
+	}
+	fingerprint.Hash = hex.EncodeToString(hash.Sum(nil))[:16]
+
+	return fingerprint
+}
+
+// MessageFingerprint hashes the structure of a message: field numbers,
+// labels and scalar types, oneofs, nested messages and enum values
+func MessageFingerprint(msg MessageType) string {
+	hash := sha256.Sum256([]byte(messageShape(msg)))
+	return hex.EncodeToString(hash[:8])
+}
+
+func messageShape(msg MessageType) string {
+	var parts []string
+	for _, field := range msg.Field {
+		kind := field.Type
+		if !primitiveTypes[field.Type] {
+			// Obfuscated message or enum name
+			kind = "ref"
+			if strings.HasPrefix(field.Type, "map<") {
+				kind = "map"
+			}
+		}
+		oneof := -1
+		if field.OneOfIndex != nil {
+			oneof = *field.OneOfIndex
+		}
+		parts = append(parts, fmt.Sprintf("f%d:%s:%s:%d", field.Number, field.Label, kind, oneof))
+	}
+	for _, enum := range msg.EnumType {
+		numbers := make([]string, len(enum.Value))
+		for i, value := range enum.Value {
+			numbers[i] = fmt.Sprint(value.Number)
+		}
+		parts = append(parts, "e("+strings.Join(numbers, ",")+")")
+	}
+	for _, nested := range msg.NestedType {
+		parts = append(parts, "m("+messageShape(nested)+")")
+	}
+	parts = append(parts, fmt.Sprintf("o%d", len(msg.OneOfDecl)))
+
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+// CorpusChanges compares two fingerprints, returning how many messages
+// appeared and disappeared
+func CorpusChanges(previous, current *CorpusFingerprint) (added, removed int) {
+	for key, count := range current.Messages {
+		if diff := count - previous.Messages[key]; diff > 0 {
+			added += diff
+		}
+	}
+	for key, count := range previous.Messages {
+		if diff := count - current.Messages[key]; diff > 0 {
+			removed += diff
+		}
+	}
+	return added, removed
+}
+
+const fingerprintFile = "fingerprint.json"
+
+// LoadFingerprint reads the fingerprint recorded in a workspace, returning nil when there is none
+func LoadFingerprint(workspace string) (*CorpusFingerprint, error) {
+	data, err := os.ReadFile(filepath.Join(workspace, fingerprintFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fingerprint CorpusFingerprint
+	if err := json.Unmarshal(data, &fingerprint); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", fingerprintFile, err)
+	}
+	return &fingerprint, nil
+}
+
+// SaveFingerprint records a fingerprint in a workspace
+func SaveFingerprint(workspace string, fingerprint *CorpusFingerprint) error {
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fingerprint, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(workspace, fingerprintFile), data, 0644)
+}
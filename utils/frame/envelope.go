@@ -0,0 +1,87 @@
+package frame
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const anyFullName = "google.protobuf.Any"
+
+// Envelope is the content of a frame: the envelope oneof member which is set
+// (request, response or event), its uid and the wrapped google.protobuf.Any
+type Envelope struct {
+	Kind    string
+	Uid     int64
+	TypeURL string
+	Value   []byte
+}
+
+// TypeName returns the message name of the type URL
+func (e *Envelope) TypeName() string {
+	return e.TypeURL[strings.LastIndex(e.TypeURL, "/")+1:]
+}
+
+// IsEnvelope tells whether a message looks like an envelope: a single oneof
+// whose members all carry a google.protobuf.Any
+func IsEnvelope(msg protoreflect.MessageDescriptor) bool {
+	if msg.Oneofs().Len() != 1 || msg.Fields().Len() != msg.Oneofs().Get(0).Fields().Len() {
+		return false
+	}
+
+	members := msg.Oneofs().Get(0).Fields()
+	for i := 0; i < members.Len(); i++ {
+		if members.Get(i).Message() == nil || findAnyField(members.Get(i).Message()) == nil {
+			return false
+		}
+	}
+	return members.Len() > 0
+}
+
+// ParseEnvelope decodes a frame with the envelope descriptor
+func ParseEnvelope(envelopeDesc protoreflect.MessageDescriptor, frame []byte) (*Envelope, error) {
+	if envelopeDesc.Oneofs().Len() == 0 {
+		return nil, fmt.Errorf("%s is not an envelope message", envelopeDesc.FullName())
+	}
+
+	envelope := dynamicpb.NewMessage(envelopeDesc)
+	if err := proto.Unmarshal(frame, envelope); err != nil {
+		return nil, fmt.Errorf("decoding envelope: %w", err)
+	}
+
+	member := envelope.WhichOneof(envelopeDesc.Oneofs().Get(0))
+	if member == nil {
+		return nil, errors.New("empty envelope")
+	}
+	inner := envelope.Get(member).Message()
+
+	parsed := &Envelope{Kind: string(member.Name())}
+	fields := inner.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		switch {
+		case field.Kind() == protoreflect.Int32Kind || field.Kind() == protoreflect.Int64Kind:
+			parsed.Uid = inner.Get(field).Int()
+		case field.Message() != nil && field.Message().FullName() == anyFullName:
+			anyMsg := inner.Get(field).Message()
+			parsed.TypeURL = anyMsg.Get(anyMsg.Descriptor().Fields().ByName("type_url")).String()
+			parsed.Value = anyMsg.Get(anyMsg.Descriptor().Fields().ByName("value")).Bytes()
+		}
+	}
+
+	return parsed, nil
+}
+
+func findAnyField(msg protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	for i := 0; i < msg.Fields().Len(); i++ {
+		field := msg.Fields().Get(i)
+		if field.Message() != nil && field.Message().FullName() == anyFullName {
+			return field
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package frame
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// MaxFrameSize bounds the length prefix, so garbage data isn't buffered forever
+const MaxFrameSize = 16 << 20
+
+var (
+	ErrFrameTooLarge = errors.New("frame length exceeds MaxFrameSize")
+	ErrBadLength     = errors.New("malformed frame length varint")
+)
+
+// Splitter splits the data of one direction of a connection into frames.
+// Every frame is a protobuf message prefixed by its varint-encoded length.
+type Splitter struct {
+	buffer []byte
+}
+
+// Feed appends data and returns every frame which is now complete
+func (s *Splitter) Feed(data []byte) ([][]byte, error) {
+	s.buffer = append(s.buffer, data...)
+
+	var frames [][]byte
+	for {
+		length, n := binary.Uvarint(s.buffer)
+		// The stream can't be resynchronized after either
+		if n < 0 {
+			s.buffer = nil
+			return frames, ErrBadLength
+		}
+		if length > MaxFrameSize {
+			s.buffer = nil
+			return frames, ErrFrameTooLarge
+		}
+		if n == 0 || uint64(len(s.buffer)-n) < length {
+			// Incomplete frame
+			break
+		}
+
+		frame := make([]byte, length)
+		copy(frame, s.buffer[n:n+int(length)])
+		frames = append(frames, frame)
+		s.buffer = s.buffer[n+int(length):]
+	}
+
+	return frames, nil
+}
+
+// Buffered returns the number of bytes of the incomplete frame
+func (s *Splitter) Buffered() int {
+	return len(s.buffer)
+}
+
+// Encode prefixes a payload with its length
+func Encode(payload []byte) []byte {
+	frame := binary.AppendUvarint(nil, uint64(len(payload)))
+	return append(frame, payload...)
+}
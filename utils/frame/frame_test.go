@@ -0,0 +1,177 @@
+package frame
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The client to server stream of a capture, as split by TCP: a request
+// (uid 7, hfv) and an event (zzz) framed one after the other, the first
+// segment ending inside the type URL of the request
+var capturedSegments = []string{
+	"250a230807121f0a1374",
+	"7970652e616e6b616d612e636f6d2f6866761208087b1202686918051b1a190a170a13747970652e616e6b616d612e636f6d2f7a7a7a1200",
+}
+
+func capturedStream(t *testing.T) [][]byte {
+	t.Helper()
+	var segments [][]byte
+	for _, segment := range capturedSegments {
+		data, err := hex.DecodeString(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, data)
+	}
+	return segments
+}
+
+func TestSplitterCapturedStream(t *testing.T) {
+	segments := capturedStream(t)
+	var splitter Splitter
+
+	frames, err := splitter.Feed(segments[0])
+	if err != nil {
+		t.Fatalf("feeding the first segment: %v", err)
+	}
+	if len(frames) != 0 {
+		t.Fatalf("got %d frames out of a partial frame, want 0", len(frames))
+	}
+	if splitter.Buffered() != len(segments[0]) {
+		t.Fatalf("buffered %d bytes, want %d", splitter.Buffered(), len(segments[0]))
+	}
+
+	frames, err = splitter.Feed(segments[1])
+	if err != nil {
+		t.Fatalf("feeding the second segment: %v", err)
+	}
+	if len(frames) != 2 || len(frames[0]) != 0x25 || len(frames[1]) != 0x1b {
+		t.Fatalf("got frames of %v bytes, want 37 and 27", frameLengths(frames))
+	}
+	if splitter.Buffered() != 0 {
+		t.Fatalf("buffered %d bytes after complete frames, want 0", splitter.Buffered())
+	}
+}
+
+func TestSplitterByteByByte(t *testing.T) {
+	stream := bytes.Join(capturedStream(t), nil)
+	var splitter Splitter
+
+	var frames [][]byte
+	for i := range stream {
+		got, err := splitter.Feed(stream[i : i+1])
+		if err != nil {
+			t.Fatalf("feeding byte %d: %v", i, err)
+		}
+		frames = append(frames, got...)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	if !bytes.Equal(Encode(frames[0]), stream[:1+0x25]) {
+		t.Fatalf("re-encoding the first frame doesn't give the captured bytes")
+	}
+}
+
+func TestSplitterInvalidLengths(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"oversized", []byte{0x81, 0x80, 0x80, 0x10}, ErrFrameTooLarge},
+		{"overflowing varint", bytes.Repeat([]byte{0xff}, 11), ErrBadLength},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var splitter Splitter
+			_, err := splitter.Feed(test.data)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("got error %v, want %v", err, test.want)
+			}
+			if splitter.Buffered() != 0 {
+				t.Fatalf("kept %d bytes of a stream which can't be resynchronized", splitter.Buffered())
+			}
+		})
+	}
+}
+
+func TestSplitterFramesBeforeInvalidLength(t *testing.T) {
+	stream := append(bytes.Join(capturedStream(t), nil), 0x81, 0x80, 0x80, 0x10)
+	var splitter Splitter
+
+	frames, err := splitter.Feed(stream)
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrFrameTooLarge)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames before the oversized one, want 2", len(frames))
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	envelope := gameEnvelope(t)
+	if !IsEnvelope(envelope) {
+		t.Fatalf("%s isn't recognized as an envelope", envelope.FullName())
+	}
+
+	var splitter Splitter
+	frames, err := splitter.Feed(bytes.Join(capturedStream(t), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kind     string
+		uid      int64
+		typeName string
+		value    string
+	}{
+		{"request", 7, "hfv", "087b120268691805"},
+		{"event", 0, "zzz", ""},
+	}
+	for i, test := range tests {
+		parsed, err := ParseEnvelope(envelope, frames[i])
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if parsed.Kind != test.kind || parsed.Uid != test.uid || parsed.TypeName() != test.typeName || hex.EncodeToString(parsed.Value) != test.value {
+			t.Errorf("frame %d: got %s uid %d %s %x, want %s uid %d %s %s", i,
+				parsed.Kind, parsed.Uid, parsed.TypeName(), parsed.Value, test.kind, test.uid, test.typeName, test.value)
+		}
+	}
+
+	if _, err := ParseEnvelope(envelope, nil); err == nil {
+		t.Errorf("an empty frame parsed, want an empty envelope error")
+	}
+	if _, err := ParseEnvelope(envelope, []byte{0x0a, 0x05}); err == nil {
+		t.Errorf("a truncated frame parsed, want a decoding error")
+	}
+}
+
+// gameEnvelope compiles the envelope of the clear game protos
+func gameEnvelope(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{"../../protos/clear/game"}}),
+	}
+	files, err := compiler.Compile(context.Background(), "message.proto")
+	if err != nil {
+		t.Fatalf("compiling the game envelope: %v", err)
+	}
+	return files[0].Messages().ByName("Message")
+}
+
+func frameLengths(frames [][]byte) []int {
+	lengths := make([]int, len(frames))
+	for i, frame := range frames {
+		lengths[i] = len(frame)
+	}
+	return lengths
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/report"
+)
+
+// hintClear tells how to get clear protos
+const hintClear = "run `deobfs fetch-clear` and pass -clear protos/clear, or leave -clear out to use the embedded baseline"
+
+// withHint wraps err with hint, nil staying nil
+func withHint(err error, hint string) error {
+	return descriptor.WithHint(err, hint)
+}
+
+// ClearProtosError tells how to get clear protos when the ones of path are
+// missing or hold no message
+func ClearProtosError(path string, err error) error {
+	return withHint(fmt.Errorf("clear protos %s: %w", path, err), hintClear)
+}
+
+// ReportsDirError tells how to fix the usual reasons the reports directory
+// dir can't be created: its parent not writable, or a file in its place
+func ReportsDirError(dir string, err error) error {
+	if errors.Is(err, syscall.ENOTDIR) {
+		return withHint(err, fmt.Sprintf("%s isn't a directory, move it away or run from another directory", dir))
+	}
+	return reportError(dir, err)
+}
+
+// reportError tells how to fix the usual reasons a report can't be written
+// to path: its directory missing or not writable
+func reportError(path string, err error) error {
+	return report.WriteError(path, err)
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS versions (
+	id          INTEGER PRIMARY KEY,
+	name        TEXT NOT NULL UNIQUE,
+	recorded_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS mappings (
+	version_id     INTEGER NOT NULL REFERENCES versions(id),
+	obfuscated_msg TEXT NOT NULL,
+	original_msg   TEXT NOT NULL,
+	confidence     REAL NOT NULL,
+	matcher        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mappings_original ON mappings(original_msg);
+CREATE INDEX IF NOT EXISTS mappings_obfuscated ON mappings(obfuscated_msg);
+`
+
+// History is a persistent store of the mappings of every recorded game version
+type History struct {
+	db *sql.DB
+}
+
+// HistoryEntry is the mapping of a message in a given game version
+type HistoryEntry struct {
+	Version       string
+	RecordedAt    time.Time
+	ObfuscatedMsg string
+	OriginalMsg   string
+	Confidence    float64
+}
+
+// OpenHistory opens (or creates) the history database of a workspace directory
+func OpenHistory(workspace string) (*History, error) {
+	if err := os.MkdirAll(workspace, 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := openSQLite(filepath.Join(workspace, "history.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating history schema: %w", err)
+	}
+
+	return &History{db: db}, nil
+}
+
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// Record stores the definitive matches of a game version, replacing any
+// previous record of the same version
+func (h *History) Record(version string, matches []MessageMatch) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mappings WHERE version_id = (SELECT id FROM versions WHERE name = ?)`, version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO versions (name, recorded_at) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET recorded_at = excluded.recorded_at`,
+		version, time.Now()); err != nil {
+		return err
+	}
+
+	var versionID int64
+	if err := tx.QueryRow(`SELECT id FROM versions WHERE name = ?`, version).Scan(&versionID); err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		// Uncertain matches are not part of the history
+		if len(match.Alternatives) > 0 {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO mappings (version_id, obfuscated_msg, original_msg, confidence, matcher) VALUES (?, ?, ?, ?, ?)`,
+			versionID, match.ObfuscatedMsg, match.OriginalMsg, match.MatchPercent, match.Matcher); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Versions returns the recorded game versions, oldest first
+func (h *History) Versions() ([]string, error) {
+	rows, err := h.db.Query(`SELECT name FROM versions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		versions = append(versions, name)
+	}
+	return versions, rows.Err()
+}
+
+// Lookup returns the mappings of a message, given by its original or obfuscated
+// name, in a version (or in every version when version is empty), oldest first
+func (h *History) Lookup(name, version string) ([]HistoryEntry, error) {
+	query := `SELECT v.name, v.recorded_at, m.obfuscated_msg, m.original_msg, m.confidence
+		FROM mappings m JOIN versions v ON v.id = m.version_id
+		WHERE (m.original_msg = ? OR m.obfuscated_msg = ?)`
+	args := []any{name, name}
+	if version != "" {
+		query += ` AND v.name = ?`
+		args = append(args, version)
+	}
+	query += ` ORDER BY v.id`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		if err := rows.Scan(&entry.Version, &entry.RecordedAt, &entry.ObfuscatedMsg, &entry.OriginalMsg, &entry.Confidence); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// FirstSeen returns the first recorded version in which a message was matched
+func (h *History) FirstSeen(name string) (*HistoryEntry, error) {
+	entries, err := h.Lookup(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("message %s not found in history", name)
+	}
+	return &entries[0], nil
+}
+
+// Alias is an obfuscated name an original message had over consecutive
+// recorded versions
+type Alias struct {
+	Obfuscated   string `json:"obfuscated"`
+	FirstVersion string `json:"firstVersion"`
+	LastVersion  string `json:"lastVersion"`
+}
+
+// AliasChain is the sequence of obfuscated names of an original message,
+// oldest first, for tools still referencing old names
+type AliasChain struct {
+	Original string  `json:"original"`
+	Aliases  []Alias `json:"aliases"`
+}
+
+// AliasChains returns the alias chains of the original messages, sorted by
+// name. With a name, original or obfuscated in any version, only the chains
+// of the messages it names are returned.
+func (h *History) AliasChains(name string) ([]AliasChain, error) {
+	query := `SELECT m.original_msg, m.obfuscated_msg, v.name
+		FROM mappings m JOIN versions v ON v.id = m.version_id`
+	var args []any
+	if name != "" {
+		query += ` WHERE m.original_msg IN (SELECT original_msg FROM mappings WHERE original_msg = ? OR obfuscated_msg = ?)`
+		args = append(args, name, name)
+	}
+	query += ` ORDER BY m.original_msg, v.id, m.obfuscated_msg`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chains []AliasChain
+	for rows.Next() {
+		var original, obfuscated, version string
+		if err := rows.Scan(&original, &obfuscated, &version); err != nil {
+			return nil, err
+		}
+		if len(chains) == 0 || chains[len(chains)-1].Original != original {
+			chains = append(chains, AliasChain{Original: original})
+		}
+		chain := &chains[len(chains)-1]
+		// A name kept from a version to the next one extends its alias
+		if last := len(chain.Aliases) - 1; last >= 0 && chain.Aliases[last].Obfuscated == obfuscated {
+			chain.Aliases[last].LastVersion = version
+			continue
+		}
+		chain.Aliases = append(chain.Aliases, Alias{Obfuscated: obfuscated, FirstVersion: version, LastVersion: version})
+	}
+	return chains, rows.Err()
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// RunHooks runs shell commands after a match run, with env added to their
+// environment. Every hook is run even when a previous one failed.
+func RunHooks(hooks []string, env map[string]string, logger *slog.Logger) error {
+	var environ []string
+	for _, key := range sortedKeys(env) {
+		environ = append(environ, key+"="+env[key])
+	}
+
+	failed := 0
+	for _, hook := range hooks {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", hook)
+		} else {
+			cmd = exec.Command("sh", "-c", hook)
+		}
+		cmd.Env = append(os.Environ(), environ...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		logger.Info("running hook", "command", hook)
+		if err := cmd.Run(); err != nil {
+			logger.Error("hook failed", "command", hook, "error", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hooks failed", failed, len(hooks))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+)
+
+var primitiveTypes = map[string]bool{
+	"double": true, "float": true, "int32": true, "int64": true, "uint32": true, "uint64": true,
+	"sint32": true, "sint64": true, "fixed32": true, "fixed64": true, "sfixed32": true, "sfixed64": true,
+	"bool": true, "string": true, "bytes": true,
+}
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Message Matches Report</title>
+<style>
+body { font-family: monospace; margin: 2em; }
+details { border-bottom: 1px solid #ddd; padding: 4px 0; }
+summary { cursor: pointer; }
+.conf { float: right; }
+.uncertain { color: #b58900; }
+table { border-collapse: collapse; margin: 8px 0 8px 2em; }
+td, th { padding: 2px 12px; text-align: left; }
+tr.ok { background: #e6f4ea; }
+tr.ref { background: #eef2fb; }
+tr.mismatch { background: #fce8e6; }
+tr.missing { background: #fef7e0; }
+</style>
+</head>
+<body>
+<h1>Message Matches Report</h1>
+<p>Total matches: {{len .}}</p>
+{{range .}}
+<details>
+<summary>{{.ObfuscatedMsg}} → {{if .Uncertain}}<span class="uncertain">???</span>{{else}}{{.OriginalMsg}}{{end}} <span class="conf">{{if .Uncertain}}???{{else}}{{.File}}{{end}} [{{.Matcher}}] {{printf "%.2f" .MatchPercent}}%</span></summary>
+{{if .Alternatives}}<p>Possible matches: {{.OriginalMsg}} ({{.File}}, {{printf "%.2f" .MatchPercent}}%){{range .Alternatives}}, {{.Name}} ({{.File}}, {{printf "%.2f" .Confidence}}%){{end}}</p>{{end}}
+<table>
+<tr><th>#</th><th>{{.ObfuscatedMsg}}</th><th></th><th>{{.OriginalMsg}}</th><th></th></tr>
+{{range .Fields}}<tr class="{{.Class}}"><td>{{.Number}}</td><td>{{.ObfuscatedType}}</td><td>{{.ObfuscatedName}}</td><td>{{.OriginalType}}</td><td>{{.OriginalName}}</td></tr>
+{{end}}</table>
+{{range .EnumMatches}}<p>enum {{.ObfuscatedEnum}} → {{.OriginalEnum}}: {{.Values}}</p>
+{{end}}</details>
+{{end}}
+</body>
+</html>
+`
+
+type htmlMatch struct {
+	MessageMatch
+	File      string
+	Uncertain bool
+	Fields    []htmlField
+}
+
+type htmlField struct {
+	Number         int
+	ObfuscatedType string
+	ObfuscatedName string
+	OriginalType   string
+	OriginalName   string
+	Class          string
+}
+
+// GenerateHTMLReport writes the matches as an HTML page where every match
+// expands to both message definitions with their fields aligned side by side
+func GenerateHTMLReport(matches []MessageMatch, obfuscated, unobfuscated *Descriptor, outputFile string) error {
+	tmpl, err := template.New("report").Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+
+	obfsMessages := indexMessages(obfuscated)
+	unobsMessages := indexMessages(unobfuscated)
+
+	sorted := SortedMatches(matches)
+
+	var pages []htmlMatch
+	for _, match := range sorted {
+		page := htmlMatch{
+			MessageMatch: match,
+			File:         filepath.Base(match.OriginalFile),
+			Uncertain:    len(match.Alternatives) > 0,
+		}
+		page.Alternatives = append([]Alternative{}, match.Alternatives...)
+		for i := range page.Alternatives {
+			page.Alternatives[i].File = filepath.Base(page.Alternatives[i].File)
+		}
+
+		for _, pair := range alignFields(obfsMessages[match.ObfuscatedMsg], unobsMessages[match.OriginalMsg]) {
+			page.Fields = append(page.Fields, htmlField{
+				Number:         pair.number,
+				ObfuscatedType: formatFieldType(pair.obfuscated),
+				ObfuscatedName: pair.obfuscated.Name,
+				OriginalType:   formatFieldType(pair.original),
+				OriginalName:   pair.original.Name,
+				Class:          fieldPairClass(pair),
+			})
+		}
+		pages = append(pages, page)
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return reportError(outputFile, err)
+	}
+	defer file.Close()
+
+	if err := tmpl.Execute(file, pages); err != nil {
+		return fmt.Errorf("rendering html report: %w", err)
+	}
+	return nil
+}
+
+func formatFieldType(field Field) string {
+	if field.Label != "" {
+		return field.Label + " " + field.Type
+	}
+	return field.Type
+}
+
+// Classify an aligned field pair for highlighting
+func fieldPairClass(pair fieldPair) string {
+	switch {
+	case pair.obfuscated.Name == "" || pair.original.Name == "":
+		return "missing"
+	case pair.obfuscated.Label != pair.original.Label:
+		return "mismatch"
+	case primitiveTypes[pair.obfuscated.Type] || primitiveTypes[pair.original.Type]:
+		if pair.obfuscated.Type == pair.original.Type {
+			return "ok"
+		}
+		return "mismatch"
+	default:
+		// Both reference messages or enums, whose names can't be compared
+		return "ref"
+	}
+}
@@ -0,0 +1,19 @@
+package utils
+
+// CarryForwardMatches returns the matches of a previous mapping which still
+// hold: the ones of obfuscated files whose content didn't change. Nothing is
+// carried when the previous mapping has no hashes or the clear corpus changed,
+// since every match may be different then.
+func CarryForwardMatches(previous *Mapping, obfuscated, unobfuscated *Descriptor) ([]MessageMatch, bool) {
+	if len(previous.Files) == 0 || previous.ClearHash != CorpusHash(unobfuscated) {
+		return nil, false
+	}
+
+	var carried []MessageMatch
+	for _, match := range previous.Matches {
+		if hash, ok := obfuscated.Files[match.ObfuscatedFile]; ok && hash == previous.Files[match.ObfuscatedFile] {
+			carried = append(carried, match)
+		}
+	}
+	return carried, true
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+)
+
+// The Dofus 2.x messages and the name suggestions made from them
+type (
+	LegacyField   = match.LegacyField
+	LegacyMessage = match.LegacyMessage
+	LegacyHint    = match.LegacyHint
+)
+
+// LoadLegacyProtocol reads a Dofus 2.x protocol description: a JSON list of
+// messages with their fields, either as an array or under "messages"
+func LoadLegacyProtocol(path string) ([]LegacyMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []LegacyMessage
+	if err := json.Unmarshal(data, &messages); err == nil {
+		return messages, nil
+	}
+	var wrapped struct {
+		Messages []LegacyMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return wrapped.Messages, nil
+}
+
+// GenerateLegacyHintsReport writes the legacy name suggestions
+func GenerateLegacyHintsReport(hints []LegacyHint, outputFile string) error {
+	sort.SliceStable(hints, func(i, j int) bool {
+		if hints[i].ObfuscatedFile != hints[j].ObfuscatedFile {
+			return hints[i].ObfuscatedFile < hints[j].ObfuscatedFile
+		}
+		return hints[i].ObfuscatedMsg < hints[j].ObfuscatedMsg
+	})
+
+	var report strings.Builder
+	report.WriteString("Dofus 2.x Name Hints (low confidence)\n")
+	report.WriteString("=====================================\n\n")
+
+	maxObfsMsg := 0
+	for _, hint := range hints {
+		maxObfsMsg = max(maxObfsMsg, len(hint.ObfuscatedMsg))
+	}
+	for _, hint := range hints {
+		report.WriteString(fmt.Sprintf("%-*s  ~  %s  [conf: %6.2f%%]\n",
+			maxObfsMsg, hint.ObfuscatedMsg, strings.Join(hint.LegacyNames, " | "), hint.Confidence))
+	}
+	report.WriteString(fmt.Sprintf("\nTotal hints: %d\n", len(hints)))
+
+	if err := os.WriteFile(outputFile, []byte(report.String()), 0644); err != nil {
+		return reportError(outputFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Installation holds the files of a Unity client needed for extraction
+type Installation struct {
+	Dir          string
+	GameAssembly string
+	Metadata     string
+}
+
+var steamLibraryRegex = regexp.MustCompile(`"path"\s+"([^"]+)"`)
+
+// FindInstallation looks for the client of a profile in the usual Ankama
+// Launcher and Steam install locations of the current platform
+func FindInstallation(profile Profile) (*Installation, error) {
+	candidates := installationCandidates(profile.InstallDirs)
+	for _, dir := range candidates {
+		if install, err := InstallationAt(dir); err == nil {
+			return install, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s installation found in %s", profile.Name, strings.Join(candidates, ", "))
+}
+
+// InstallationAt checks that dir contains GameAssembly.dll and its global-metadata.dat
+func InstallationAt(dir string) (*Installation, error) {
+	gameAssembly := filepath.Join(dir, "GameAssembly.dll")
+	if _, err := os.Stat(gameAssembly); err != nil {
+		return nil, fmt.Errorf("GameAssembly.dll not found in %s", dir)
+	}
+
+	metadata, _ := filepath.Glob(filepath.Join(dir, "*_Data", "il2cpp_data", "Metadata", "global-metadata.dat"))
+	if len(metadata) == 0 {
+		return nil, fmt.Errorf("global-metadata.dat not found in %s", dir)
+	}
+
+	return &Installation{
+		Dir:          dir,
+		GameAssembly: gameAssembly,
+		Metadata:     metadata[0],
+	}, nil
+}
+
+func installationCandidates(installDirs []string) []string {
+	var candidates []string
+	home, _ := os.UserHomeDir()
+
+	// Ankama Launcher install roots
+	var roots []string
+	var steamDirs []string
+	switch runtime.GOOS {
+	case "windows":
+		if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+			roots = append(roots, filepath.Join(localAppData, "Ankama"))
+		}
+		for _, programFiles := range []string{os.Getenv("ProgramFiles(x86)"), os.Getenv("ProgramFiles")} {
+			if programFiles == "" {
+				continue
+			}
+			roots = append(roots, filepath.Join(programFiles, "Ankama"))
+			steamDirs = append(steamDirs, filepath.Join(programFiles, "Steam"))
+		}
+	default:
+		// Windows client running through Wine or Proton
+		if home != "" {
+			roots = append(roots, filepath.Join(home, ".wine", "drive_c", "users", filepath.Base(home), "AppData", "Local", "Ankama"))
+			steamDirs = append(steamDirs,
+				filepath.Join(home, ".steam", "steam"),
+				filepath.Join(home, ".local", "share", "Steam"),
+				filepath.Join(home, "Library", "Application Support", "Steam"),
+			)
+		}
+	}
+
+	for _, root := range roots {
+		for _, dir := range installDirs {
+			candidates = append(candidates, filepath.Join(root, dir))
+		}
+	}
+	for _, steamDir := range steamDirs {
+		for _, library := range steamLibraries(steamDir) {
+			for _, dir := range installDirs {
+				candidates = append(candidates, filepath.Join(library, "steamapps", "common", dir))
+			}
+		}
+	}
+
+	return candidates
+}
+
+// Steam can have several library folders, listed in libraryfolders.vdf
+func steamLibraries(steamDir string) []string {
+	libraries := []string{steamDir}
+
+	content, err := os.ReadFile(filepath.Join(steamDir, "steamapps", "libraryfolders.vdf"))
+	if err == nil {
+		for _, match := range steamLibraryRegex.FindAllStringSubmatch(string(content), -1) {
+			library := strings.ReplaceAll(match[1], `\\`, `\`)
+			if library != steamDir {
+				libraries = append(libraries, library)
+			}
+		}
+	}
+
+	return libraries
+}
@@ -2,9 +2,13 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -22,13 +26,20 @@ const (
 	LevelError = LogLevel(slog.LevelError)
 )
 
-const maxEnumValuesLength = 80
+// Enum values are cut to this length when the width of the terminal is
+// unknown, and never shorter than minEnumValuesLength
+const (
+	maxEnumValuesLength = 80
+	minEnumValuesLength = 20
+)
 
-func truncateEnumValues(values string) string {
-	if len(values) <= maxEnumValuesLength {
-		return values
+// fitEnumValues cuts values to the columns of a terminal of width left after
+// used ones. The JSON logs, the log file and mapping.json keep them whole.
+func fitEnumValues(values string, width, used int) string {
+	if width == 0 {
+		return truncateText(values, maxEnumValuesLength)
 	}
-	return values[:maxEnumValuesLength] + "..."
+	return truncateText(values, max(width-used, minEnumValuesLength))
 }
 
 type PrettyHandler struct {
@@ -100,11 +111,12 @@ func (h *PrettyHandler) Handle(ctx context.Context, r slog.Record) error {
 			case "original_enum":
 				origEnum = color.YellowString(attr.v)
 			case "values":
-				values = truncateEnumValues(attr.v)
+				values = attr.v
 			}
 		}
-		output = fmt.Sprintf("%s     matching enum: %s -> %s with values: %s",
-			level, obfsEnum, origEnum, values)
+		output = fmt.Sprintf("%s     matching enum: %s -> %s with values: ",
+			level, obfsEnum, origEnum)
+		output += fitEnumValues(values, TerminalWidth(os.Stdout), visibleWidth(output))
 
 	case "enum matching summary":
 		var withEnums, found string
@@ -139,11 +151,11 @@ func (h *PrettyHandler) Handle(ctx context.Context, r slog.Record) error {
 			case "name":
 				name = color.RedString(attr.v)
 			case "enums":
-				enums = truncateEnumValues(attr.v)
+				enums = attr.v
 			}
 		}
-		output = fmt.Sprintf("%s     %s (enum values: %s)",
-			level, name, enums)
+		output = fmt.Sprintf("%s     %s (enum values: ", level, name)
+		output += fitEnumValues(enums, TerminalWidth(os.Stdout), visibleWidth(output)+1) + ")"
 
 	case "strict structure matching summary":
 		var remaining, found, passes string
@@ -251,23 +263,231 @@ func (h *PrettyHandler) Handle(ctx context.Context, r slog.Record) error {
 	}
 
 	// Write to output
-	_, err := fmt.Fprintln(os.Stdout, output)
-	return err
+	return writeLogLine(output)
+}
+
+// LogFormat is how the logs are written
+type LogFormat string
+
+const (
+	LogFormatPretty LogFormat = "pretty" // Colored summaries, for terminals
+	LogFormatJSON   LogFormat = "json"   // One slog JSON object per line, for log tooling
+)
+
+// ParseLogFormat checks the name of a log format
+func ParseLogFormat(name string) (LogFormat, error) {
+	switch format := LogFormat(name); format {
+	case LogFormatPretty, LogFormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown log format %s (available: %s, %s)", name, LogFormatPretty, LogFormatJSON)
+}
+
+// The subsystems whose logs can have their own level, see ModuleLogger
+var LogModules = []string{"filter", "parse", "match", "report"}
+
+// LogLevels are the level of the logs and the ones of some modules
+type LogLevels struct {
+	Default LogLevel
+	Modules map[string]LogLevel
+}
+
+// ParseLogLevels parses a comma separated list of levels, a bare one setting
+// the default level and module=level the one of a module, like "info,match=debug"
+func ParseLogLevels(spec string) (LogLevels, error) {
+	levels := LogLevels{Default: LevelInfo, Modules: make(map[string]LogLevel)}
+	for _, item := range strings.Split(spec, ",") {
+		module, name, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			module, name = "", module
+		}
+		level, err := parseLogLevel(name)
+		if err != nil {
+			return LogLevels{}, err
+		}
+		if !found {
+			levels.Default = level
+			continue
+		}
+		if !slices.Contains(LogModules, module) {
+			return LogLevels{}, fmt.Errorf("unknown log module %s (available: %s)", module, strings.Join(LogModules, ", "))
+		}
+		levels.Modules[module] = level
+	}
+	return levels, nil
+}
+
+func parseLogLevel(name string) (LogLevel, error) {
+	switch name {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %s (available: debug, info, warn, error)", name)
+}
+
+// lowest returns the lowest of the levels, which the handler must let through
+func (l LogLevels) lowest() LogLevel {
+	lowest := l.Default
+	for _, level := range l.Modules {
+		lowest = min(lowest, level)
+	}
+	return lowest
 }
 
 func InitLogger(level LogLevel) *slog.Logger {
+	return InitLoggerFormat(level, LogFormatPretty)
+}
+
+// InitLoggerFormat sets up the default logger, writing in format
+func InitLoggerFormat(level LogLevel, format LogFormat) *slog.Logger {
+	return InitLoggerLevels(LogLevels{Default: level}, format)
+}
+
+// InitLoggerLevels sets up the default logger, writing in format with the
+// level of their module for the loggers of ModuleLogger
+func InitLoggerLevels(levels LogLevels, format LogFormat) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: slog.Level(levels.lowest()),
+	}
+
+	var handler slog.Handler
+	var prettyHandler *PrettyHandler
+	if format == LogFormatJSON {
+		// Messages and values would carry the escape codes of the colors
+		color.NoColor = true
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		prettyHandler = &PrettyHandler{slog.NewTextHandler(os.Stdout, opts), nil}
+		handler = prettyHandler
+	}
+
+	Logger = slog.New(&moduleHandler{handler: handler, levels: levels})
+	if prettyHandler != nil {
+		prettyHandler.l = Logger
+	}
+	slog.SetDefault(Logger)
+	return Logger
+}
+
+const moduleKey = "module"
+
+// ModuleLogger returns the logger of a module of LogModules, which
+// InitLoggerLevels can give its own level
+func ModuleLogger(logger *slog.Logger, module string) *slog.Logger {
+	return logger.With(moduleKey, module)
+}
+
+// moduleHandler drops the records below the level of their module. The
+// module attribute is only used to pick the level, it isn't written, so the
+// PrettyHandler keeps formatting the records of the module loggers.
+type moduleHandler struct {
+	handler slog.Handler
+	levels  LogLevels
+	module  string
+}
+
+func (h *moduleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	threshold, ok := h.levels.Modules[h.module]
+	if !ok {
+		threshold = h.levels.Default
+	}
+	return level >= slog.Level(threshold) && h.handler.Enabled(ctx, level)
+}
+
+func (h *moduleHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler.Handle(ctx, r)
+}
+
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := *h
+	var others []slog.Attr
+	for _, attr := range attrs {
+		if attr.Key == moduleKey {
+			derived.module = attr.Value.String()
+		} else {
+			others = append(others, attr)
+		}
+	}
+	if len(others) > 0 {
+		derived.handler = h.handler.WithAttrs(others)
+	}
+	return &derived
+}
+
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	return &moduleHandler{h.handler.WithGroup(name), h.levels, h.module}
+}
+
+// TeeLogs returns a logger writing the records of logger, and every record
+// down to debug level to w, in format without colors. It becomes the default logger.
+func TeeLogs(logger *slog.Logger, w io.Writer, format LogFormat) *slog.Logger {
 	opts := &slog.HandlerOptions{
-		Level: slog.Level(level),
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() == slog.KindString {
+				a.Value = slog.StringValue(ansiRegex.ReplaceAllString(a.Value.String(), ""))
+			}
+			return a
+		},
+	}
+	var file slog.Handler = slog.NewTextHandler(w, opts)
+	if format == LogFormatJSON {
+		file = slog.NewJSONHandler(w, opts)
 	}
 
-	handler := slog.NewTextHandler(os.Stdout, opts)
-	prettyHandler := &PrettyHandler{handler, nil}
-	Logger = slog.New(prettyHandler)
-	prettyHandler.l = Logger
+	Logger = slog.New(&teeHandler{[]slog.Handler{logger.Handler(), file}})
 	slog.SetDefault(Logger)
 	return Logger
 }
 
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// teeHandler hands the records to every handler enabled for their level
+type teeHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return &teeHandler{handlers}
+}
+
+func (h *teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return &teeHandler{handlers}
+}
+
 // Helper to create a progress bar
 func createProgressBar(percent float64) string {
 	width := 30
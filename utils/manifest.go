@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// RunManifest records what a matching run was made from, so its mapping can
+// be reproduced or disputed later: the hashes of the inputs, the effective
+// settings, the version of the tool and the timings
+type RunManifest struct {
+	Tool       string                   `json:"tool"`
+	GoVersion  string                   `json:"goVersion,omitempty"`
+	Command    []string                 `json:"command"`
+	Flags      map[string]string        `json:"flags"`                // Effective value of every flag
+	Config     any                      `json:"config"`               // Effective configuration, the config file with the flags applied
+	Inputs     map[string]ManifestInput `json:"inputs"`               // By role: source, clear, config, seed...
+	Obfuscated map[string]string        `json:"obfuscated,omitempty"` // Content hashes of the filtered files
+	Clear      map[string]string        `json:"clear,omitempty"`      // Content hashes of the clear files
+	ClearHash  string                   `json:"clearHash,omitempty"`
+	StartedAt  time.Time                `json:"startedAt"`
+	FinishedAt time.Time                `json:"finishedAt"`
+	Timings    []ManifestTiming         `json:"timings"`
+}
+
+// ManifestInput is an input of a run given by path. Directories are hashed
+// as the list of their files with their hashes, and the embedded clear protos
+// by their snapshot version.
+type ManifestInput struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"` // Why it couldn't be hashed
+}
+
+// ManifestTiming is the time spent in a phase of the run
+type ManifestTiming struct {
+	Phase        string `json:"phase"`
+	Milliseconds int64  `json:"milliseconds"`
+}
+
+// ToolVersion returns the version of the running deobfs. Builds from a
+// checkout get a pseudo-version holding the VCS revision, the older
+// toolchains only record the revision apart.
+func ToolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	version := "(devel)"
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			version += " " + setting.Value
+		}
+	}
+	return version
+}
+
+// NewManifestInput hashes the file or directory at path, recording the
+// error instead when it can't be read
+func NewManifestInput(path string) ManifestInput {
+	input := ManifestInput{Path: path}
+	hash, err := HashInput(path)
+	if err != nil {
+		input.Error = err.Error()
+	}
+	input.SHA256 = hash
+	return input
+}
+
+// HashInput returns the sha256 of a file, or of the sorted list of the files
+// of a directory with their own sha256
+func HashInput(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return hashFile(path)
+	}
+
+	hashes := make(map[string]string)
+	err = filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(rel)], err = hashFile(p)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, p := range sortedKeys(hashes) {
+		fmt.Fprintf(hash, "%s:%s\n", p, hashes[p])
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SetTimings records the phases of timer in the manifest
+func (m *RunManifest) SetTimings(timer *PhaseTimer) {
+	m.Timings = nil
+	for _, phase := range timer.Phases() {
+		m.Timings = append(m.Timings, ManifestTiming{Phase: phase.Name, Milliseconds: phase.Duration.Milliseconds()})
+	}
+}
+
+// WriteManifest writes a run manifest to a JSON file
+func WriteManifest(manifest *RunManifest, outputFile string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputFile, append(data, '\n'), 0644); err != nil {
+		return reportError(outputFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"crypto/ed25519"
+
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+	"github.com/ruinedyourlife/deobfs/pkg/report"
+)
+
+// Mapping is the machine-readable result of a matching run
+type Mapping = mapping.Mapping
+
+// ErrNoChecksum is returned by Mapping.Verify for the mappings without checksum
+var ErrNoChecksum = mapping.ErrNoChecksum
+
+// NewMapping records the matches along with the hashes of the corpora they come from
+func NewMapping(matches []MessageMatch, obfuscated, unobfuscated *Descriptor) *Mapping {
+	return report.NewMapping(matches, obfuscated, unobfuscated)
+}
+
+// SortedMatches returns a copy of matches in the order of the reports
+func SortedMatches(matches []MessageMatch) []MessageMatch {
+	return mapping.SortedMatches(matches)
+}
+
+// WriteMapping writes a mapping to a JSON file, with its matches sorted and
+// its checksum
+func WriteMapping(result *Mapping, outputFile string) error {
+	return report.WriteMappingFile(result, outputFile, nil)
+}
+
+// WriteSignedMapping is WriteMapping signing the checksum with key, when it
+// isn't nil
+func WriteSignedMapping(result *Mapping, outputFile string, key ed25519.PrivateKey) error {
+	return report.WriteMappingFile(result, outputFile, key)
+}
+
+// LoadMapping reads a JSON mapping file written by WriteMapping
+func LoadMapping(path string) (*Mapping, error) {
+	return mapping.Load(path)
+}
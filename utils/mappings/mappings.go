@@ -0,0 +1,109 @@
+// Package mappings is the former home of the matchers, now in pkg/match. Its
+// names alias the ones of pkg/match.
+package mappings
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ruinedyourlife/deobfs/pkg/descriptor"
+	"github.com/ruinedyourlife/deobfs/pkg/mapping"
+	"github.com/ruinedyourlife/deobfs/pkg/match"
+)
+
+// The matchers, their options and the results of the analyses
+type (
+	Matcher        = match.Matcher
+	Option         = match.Option
+	Weights        = match.Weights
+	ClearIndex     = match.ClearIndex
+	ScoreComponent = match.ScoreComponent
+	Candidate      = match.Candidate
+)
+
+// The confidences the structure matchers need by default
+const (
+	DefaultThreshold = match.DefaultThreshold
+	FuzzyThreshold   = match.FuzzyThreshold
+)
+
+// DefaultWeights weighs every score the same
+var DefaultWeights = match.DefaultWeights
+
+// NewEnumMatcher returns the matcher pairing the messages whose enums all match
+func NewEnumMatcher(opts ...Option) Matcher { return match.NewEnumMatcher(opts...) }
+
+// NewStrictStructureMatcher returns the matcher pairing the messages with a
+// single perfectly matching structure
+func NewStrictStructureMatcher(opts ...Option) Matcher {
+	return match.NewStrictStructureMatcher(opts...)
+}
+
+// NewRelaxedMatcher returns the matcher pairing the messages with a close
+// enough structure, keeping the ties as uncertain matches
+func NewRelaxedMatcher(opts ...Option) Matcher { return match.NewRelaxedMatcher(opts...) }
+
+// NewEnvelopeMatcher returns the matcher pairing the envelopes by their number
+// of members, then the members of the paired messages by field number
+func NewEnvelopeMatcher(opts ...Option) Matcher { return match.NewEnvelopeMatcher(opts...) }
+
+// WithExactEnums only pairs enums with the same values (enum)
+func WithExactEnums(exact bool) Option { return match.WithExactEnums(exact) }
+
+// WithFuzzyEnums also pairs enums by their value numbers and the fields using
+// them when their value names differ (enum)
+func WithFuzzyEnums(fuzzy bool) Option { return match.WithFuzzyEnums(fuzzy) }
+
+// WithThreshold sets the confidence in percent a match needs
+func WithThreshold(threshold float64) Option { return match.WithThreshold(threshold) }
+
+// WithWeights sets the weights of the scores making the confidence (relaxed)
+func WithWeights(weights Weights) Option { return match.WithWeights(weights) }
+
+// WithSeeds gives matches known beforehand, whose messages the matcher skips
+func WithSeeds(seeds []mapping.MessageMatch) Option { return match.WithSeeds(seeds) }
+
+// WithChunks matches the obfuscated messages size at a time, reading the
+// original messages from index when it isn't nil
+func WithChunks(size int, index *ClearIndex) Option { return match.WithChunks(size, index) }
+
+// NewClearIndex writes the index of the original messages to a new file of
+// dir, the temporary directory when empty
+func NewClearIndex(dir string, unobfuscated *descriptor.Descriptor) (*ClearIndex, error) {
+	return match.NewClearIndex(dir, unobfuscated)
+}
+
+// IsClearName tells whether a message name was left clear by the obfuscator
+func IsClearName(name string) bool { return match.IsClearName(name) }
+
+// FindClearNameMatches matches the messages left clear to their namesake
+func FindClearNameMatches(ctx context.Context, obfuscated, unobfuscated *descriptor.Descriptor, known []mapping.MessageMatch) []mapping.MessageMatch {
+	return match.FindClearNameMatches(ctx, obfuscated, unobfuscated, known)
+}
+
+// ExplainMessage scores the original messages msg could be matched with
+func ExplainMessage(msg *descriptor.MessageType, unobfuscated *descriptor.Descriptor, opts ...Option) []Candidate {
+	return match.ExplainMessage(msg, unobfuscated, opts...)
+}
+
+// FindFieldNumberMismatches returns the matches whose aligned fields disagree
+// on their numbers
+func FindFieldNumberMismatches(matches []mapping.MessageMatch, obfuscated, unobfuscated *descriptor.Descriptor) []match.SuspiciousMatch {
+	return match.FindFieldNumberMismatches(matches, obfuscated, unobfuscated)
+}
+
+// FindLegacyHints suggests Dofus 2.x names for the messages left unmatched
+func FindLegacyHints(obfuscated *descriptor.Descriptor, legacy []match.LegacyMessage, previousMatches []mapping.MessageMatch, logger *slog.Logger) []match.LegacyHint {
+	return match.FindLegacyHints(obfuscated, legacy, previousMatches, logger)
+}
+
+// FindPluginMatches runs a matcher plugin on the messages left unmatched
+func FindPluginMatches(command string, obfuscated, unobfuscated *descriptor.Descriptor, previousMatches []mapping.MessageMatch, logger *slog.Logger) ([]mapping.MessageMatch, error) {
+	return match.FindPluginMatches(command, obfuscated, unobfuscated, previousMatches, logger)
+}
+
+// FindUnrelatedMessages returns the names whose obfuscated and original
+// messages are too different to be the same message
+func FindUnrelatedMessages(obfuscated, unobfuscated *descriptor.Descriptor, names []string) []string {
+	return match.FindUnrelatedMessages(obfuscated, unobfuscated, names)
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// NDJSONEvents writes the events of a run as one JSON object per line, for
+// wrappers and dashboards following a run without parsing its logs. It is
+// safe for concurrent use.
+type NDJSONEvents struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewNDJSONEvents returns the writer of events to w
+func NewNDJSONEvents(w io.Writer) *NDJSONEvents {
+	return &NDJSONEvents{encoder: json.NewEncoder(w)}
+}
+
+// Handle writes event with the time it happened, it is an EventHandler
+func (e *NDJSONEvents) Handle(event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// A wrapper gone away shouldn't stop the run
+	e.encoder.Encode(struct {
+		Time time.Time `json:"time"`
+		Event
+	}{time.Now(), event})
+}
+
+// WatchProgress writes a progress event of the running matchers every
+// interval, until the returned function is called
+func (e *NDJSONEvents) WatchProgress(progress *MatchingProgress, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, phase := range progress.Phases() {
+					if !phase.Complete && phase.Total > 0 {
+						e.Handle(Event{Kind: EventProgress, Matcher: phase.Matcher, Processed: phase.Processed, Total: phase.Total})
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
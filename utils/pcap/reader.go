@@ -0,0 +1,266 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Link types supported by DecodeTCP
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeLinuxSLL = 113
+	LinkTypeIPv4     = 228
+	LinkTypeIPv6     = 229
+	LinkTypeLoop     = 108
+	LinkTypeLinuxSL2 = 276
+)
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+
+	pcapngSectionHeader   = 0x0a0d0d0a
+	pcapngInterface       = 0x00000001
+	pcapngSimplePacket    = 0x00000003
+	pcapngEnhancedPacket  = 0x00000006
+	pcapngByteOrderMagic  = 0x1a2b3c4d
+	pcapngOptionTSResol   = 9
+	pcapngOptionEndOfOpts = 0
+)
+
+// Bounds of the lengths read from a capture, so a corrupt one can't make the
+// reader allocate gigabytes: tcpdump captures 262144 bytes of a packet at
+// most, and a pcapng block holds a packet with its options
+const (
+	maxPacketLen = 262144
+	maxBlockLen  = 1 << 20
+)
+
+// Packet is a captured link-layer frame
+type Packet struct {
+	Timestamp time.Time
+	LinkType  uint32
+	Data      []byte
+}
+
+type pcapngInterfaceInfo struct {
+	linkType uint32
+	// Number of timestamp units per second
+	tsUnits uint64
+}
+
+// Reader reads packets from a pcap or pcapng capture
+type Reader struct {
+	r      *bufio.Reader
+	order  binary.ByteOrder
+	pcapng bool
+
+	// Classic pcap
+	linkType uint32
+	nano     bool
+
+	// pcapng
+	interfaces []pcapngInterfaceInfo
+}
+
+// NewReader detects the capture format and reads its header
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+
+	magic, err := reader.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("reading capture header: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(magic) == pcapngSectionHeader {
+		reader.pcapng = true
+		// The section header is read along with the other blocks
+		return reader, nil
+	}
+
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(reader.r, header); err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(header) == pcapMagicMicro:
+		reader.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == pcapMagicMicro:
+		reader.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header) == pcapMagicNano:
+		reader.order, reader.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header) == pcapMagicNano:
+		reader.order, reader.nano = binary.BigEndian, true
+	default:
+		return nil, errors.New("not a pcap or pcapng capture")
+	}
+	reader.linkType = reader.order.Uint32(header[20:24]) & 0x0fffffff
+
+	return reader, nil
+}
+
+// Next returns the next packet of the capture, or io.EOF at the end
+func (r *Reader) Next() (*Packet, error) {
+	if r.pcapng {
+		return r.nextPcapng()
+	}
+	return r.nextPcap()
+}
+
+func (r *Reader) nextPcap() (*Packet, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	seconds := int64(r.order.Uint32(header[0:4]))
+	fraction := int64(r.order.Uint32(header[4:8]))
+	capturedLen := r.order.Uint32(header[8:12])
+	if capturedLen > maxPacketLen {
+		return nil, fmt.Errorf("invalid packet length %d, a capture holds %d bytes of a packet at most", capturedLen, maxPacketLen)
+	}
+
+	data := make([]byte, capturedLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, fmt.Errorf("reading packet: %w", err)
+	}
+
+	if !r.nano {
+		fraction *= 1000
+	}
+
+	return &Packet{
+		Timestamp: time.Unix(seconds, fraction),
+		LinkType:  r.linkType,
+		Data:      data,
+	}, nil
+}
+
+func (r *Reader) nextPcapng() (*Packet, error) {
+	for {
+		blockType, body, err := r.readBlock()
+		if err != nil {
+			return nil, err
+		}
+
+		switch blockType {
+		case pcapngSectionHeader:
+			// Interface ids are scoped to their section
+			r.interfaces = nil
+
+		case pcapngInterface:
+			if len(body) < 8 {
+				return nil, errors.New("invalid pcapng interface block")
+			}
+			r.interfaces = append(r.interfaces, pcapngInterfaceInfo{
+				linkType: uint32(r.order.Uint16(body[0:2])),
+				tsUnits:  r.parseTSResolution(body[8:]),
+			})
+
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return nil, errors.New("invalid pcapng packet block")
+			}
+			iface := r.order.Uint32(body[0:4])
+			if int(iface) >= len(r.interfaces) {
+				return nil, fmt.Errorf("packet references unknown interface %d", iface)
+			}
+			info := r.interfaces[iface]
+
+			ts := uint64(r.order.Uint32(body[4:8]))<<32 | uint64(r.order.Uint32(body[8:12]))
+			capturedLen := r.order.Uint32(body[12:16])
+			if int(capturedLen) > len(body)-20 {
+				return nil, errors.New("invalid pcapng packet length")
+			}
+
+			return &Packet{
+				Timestamp: time.Unix(int64(ts/info.tsUnits), int64(ts%info.tsUnits*uint64(time.Second)/info.tsUnits)),
+				LinkType:  info.linkType,
+				Data:      body[20 : 20+capturedLen],
+			}, nil
+
+		case pcapngSimplePacket:
+			if len(r.interfaces) == 0 || len(body) < 4 {
+				return nil, errors.New("invalid pcapng simple packet block")
+			}
+			capturedLen := min(int(r.order.Uint32(body[0:4])), len(body)-4)
+			return &Packet{
+				LinkType: r.interfaces[0].linkType,
+				Data:     body[4 : 4+capturedLen],
+			}, nil
+		}
+		// Other blocks (statistics, name resolution...) are skipped
+	}
+}
+
+// Read a pcapng block, returning its type and body
+func (r *Reader) readBlock() (uint32, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, err
+	}
+
+	// The section header defines the byte order of the whole section
+	if binary.LittleEndian.Uint32(header[0:4]) == pcapngSectionHeader {
+		magic, err := r.r.Peek(4)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic) == pcapngByteOrderMagic:
+			r.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic) == pcapngByteOrderMagic:
+			r.order = binary.BigEndian
+		default:
+			return 0, nil, errors.New("invalid pcapng byte order magic")
+		}
+	}
+
+	blockType := r.order.Uint32(header[0:4])
+	blockLen := r.order.Uint32(header[4:8])
+	if blockLen < 12 || blockLen%4 != 0 || blockLen > maxBlockLen {
+		return 0, nil, fmt.Errorf("invalid pcapng block length %d", blockLen)
+	}
+
+	// Body followed by the repeated block length
+	body := make([]byte, blockLen-8)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return 0, nil, fmt.Errorf("reading pcapng block: %w", err)
+	}
+
+	return blockType, body[:len(body)-4], nil
+}
+
+func (r *Reader) parseTSResolution(options []byte) uint64 {
+	for len(options) >= 4 {
+		code := r.order.Uint16(options[0:2])
+		length := int(r.order.Uint16(options[2:4]))
+		if code == pcapngOptionEndOfOpts || 4+length > len(options) {
+			break
+		}
+		if code == pcapngOptionTSResol && length >= 1 {
+			resolution := options[4]
+			if resolution&0x80 != 0 {
+				return uint64(1) << (resolution & 0x7f)
+			}
+			return uint64(math.Pow10(int(resolution)))
+		}
+		options = options[4+(length+3)/4*4:]
+	}
+	// Microseconds by default
+	return 1000000
+}
@@ -0,0 +1,202 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Segment is a TCP segment extracted from a captured packet
+type Segment struct {
+	Timestamp time.Time
+	SrcIP     net.IP
+	DstIP     net.IP
+	SrcPort   uint16
+	DstPort   uint16
+	Seq       uint32
+	SYN       bool
+	Payload   []byte
+}
+
+// Flow identifies one direction of a TCP connection
+func (s *Segment) Flow() string {
+	return fmt.Sprintf("%s -> %s",
+		net.JoinHostPort(s.SrcIP.String(), fmt.Sprint(s.SrcPort)),
+		net.JoinHostPort(s.DstIP.String(), fmt.Sprint(s.DstPort)))
+}
+
+// DecodeTCP extracts the TCP segment of a packet, returning false for anything else
+func DecodeTCP(packet *Packet) (*Segment, bool) {
+	data := packet.Data
+
+	var etherType uint16
+	switch packet.LinkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		// Skip VLAN tags
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:16])
+		data = data[16:]
+	case LinkTypeLinuxSL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		etherType = binary.BigEndian.Uint16(data[0:2])
+		data = data[20:]
+	case LinkTypeNull, LinkTypeLoop:
+		// The address family is in host byte order, so only look at the IP version
+		if len(data) < 5 {
+			return nil, false
+		}
+		data = data[4:]
+		etherType = ipVersionEtherType(data)
+	case LinkTypeRaw, LinkTypeIPv4, LinkTypeIPv6:
+		if len(data) < 1 {
+			return nil, false
+		}
+		etherType = ipVersionEtherType(data)
+	default:
+		return nil, false
+	}
+
+	segment := &Segment{Timestamp: packet.Timestamp}
+
+	switch etherType {
+	case 0x0800:
+		if len(data) < 20 {
+			return nil, false
+		}
+		headerLen := int(data[0]&0x0f) * 4
+		totalLen := int(binary.BigEndian.Uint16(data[2:4]))
+		if data[9] != 6 || headerLen < 20 || totalLen < headerLen || len(data) < headerLen {
+			return nil, false
+		}
+		// Fragments are not supported
+		if binary.BigEndian.Uint16(data[6:8])&0x3fff != 0 {
+			return nil, false
+		}
+		segment.SrcIP = net.IP(data[12:16])
+		segment.DstIP = net.IP(data[16:20])
+		data = data[headerLen:min(totalLen, len(data))]
+	case 0x86dd:
+		if len(data) < 40 {
+			return nil, false
+		}
+		// Extension headers are not supported
+		if data[6] != 6 {
+			return nil, false
+		}
+		payloadLen := int(binary.BigEndian.Uint16(data[4:6]))
+		segment.SrcIP = net.IP(data[8:24])
+		segment.DstIP = net.IP(data[24:40])
+		data = data[40:min(40+payloadLen, len(data))]
+	default:
+		return nil, false
+	}
+
+	if len(data) < 20 {
+		return nil, false
+	}
+	headerLen := int(data[12]>>4) * 4
+	if headerLen < 20 || len(data) < headerLen {
+		return nil, false
+	}
+
+	segment.SrcPort = binary.BigEndian.Uint16(data[0:2])
+	segment.DstPort = binary.BigEndian.Uint16(data[2:4])
+	segment.Seq = binary.BigEndian.Uint32(data[4:8])
+	segment.SYN = data[13]&0x02 != 0
+	segment.Payload = data[headerLen:]
+
+	return segment, true
+}
+
+func ipVersionEtherType(data []byte) uint16 {
+	switch data[0] >> 4 {
+	case 4:
+		return 0x0800
+	case 6:
+		return 0x86dd
+	}
+	return 0
+}
+
+type stream struct {
+	started bool
+	next    uint32
+	pending map[uint32][]byte
+}
+
+// Assembler reorders the TCP segments of every flow into contiguous data
+type Assembler struct {
+	streams map[string]*stream
+}
+
+func NewAssembler() *Assembler {
+	return &Assembler{streams: make(map[string]*stream)}
+}
+
+// Add feeds a segment and returns the data of its flow which became contiguous
+func (a *Assembler) Add(segment *Segment) []byte {
+	flow := segment.Flow()
+	s, ok := a.streams[flow]
+	if !ok {
+		s = &stream{pending: make(map[uint32][]byte)}
+		a.streams[flow] = s
+	}
+
+	seq := segment.Seq
+	if segment.SYN {
+		seq++
+		s.started, s.next = true, seq
+	}
+	if len(segment.Payload) == 0 {
+		return nil
+	}
+	// The capture may start in the middle of a connection
+	if !s.started {
+		s.started, s.next = true, seq
+	}
+
+	s.pending[seq] = segment.Payload
+
+	var out []byte
+	for {
+		progressed := false
+		for pendingSeq, payload := range s.pending {
+			offset := s.next - pendingSeq
+			switch {
+			case pendingSeq == s.next:
+				out = append(out, payload...)
+				s.next += uint32(len(payload))
+			case int32(offset) > 0 && offset < uint32(len(payload)):
+				// Retransmission overlapping data we already have
+				out = append(out, payload[offset:]...)
+				s.next += uint32(len(payload)) - offset
+			case int32(offset) > 0:
+				// Fully retransmitted data
+			default:
+				continue
+			}
+			delete(s.pending, pendingSeq)
+			progressed = true
+		}
+		if !progressed {
+			break
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile holds what differs between the Ankama titles using a protobuf
+// protocol in a Unity GameAssembly client. Only Dofus is built in, the other
+// titles are described by the profiles section of the config file or a
+// profile JSON file, made from a real install.
+type Profile struct {
+	Name                 string   `json:"name"`
+	AssembliesOfInterest []string `json:"assemblies"`
+	// Installation directory names, as used by the Ankama Launcher and Steam
+	InstallDirs []string `json:"installDirs"`
+}
+
+var Profiles = map[string]Profile{
+	"dofus": {
+		Name: "dofus",
+		AssembliesOfInterest: []string{
+			"Ankama.Dofus.Protocol.Connection",
+			"Ankama.Dofus.Protocol.Game",
+		},
+		InstallDirs: []string{"Dofus-dofus3", "Dofus"},
+	},
+}
+
+// GetProfile returns the built-in profile with the given name
+func GetProfile(name string) (Profile, error) {
+	profile, ok := Profiles[name]
+	if !ok {
+		var names []string
+		for n := range Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("unknown profile %s (available: %s, or a profile of the config file or a .json file)", name, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+// ResolveProfile returns the profile a -profile flag names: a profile JSON
+// file when it ends with .json, else one of defined, like the profiles of
+// the config file, which win over the built-in ones
+func ResolveProfile(name string, defined map[string]Profile) (Profile, error) {
+	if strings.HasSuffix(name, ".json") {
+		return LoadProfile(name)
+	}
+	profile, ok := defined[name]
+	if !ok {
+		return GetProfile(name)
+	}
+	if profile.Name == "" {
+		profile.Name = name
+	}
+	return profile, profile.validate()
+}
+
+// LoadProfile reads a profile JSON file, named after the file when it has no
+// name
+func LoadProfile(path string) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return Profile{}, fmt.Errorf("parsing profile %s: %w", path, err)
+	}
+	if profile.Name == "" {
+		profile.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	return profile, profile.validate()
+}
+
+func (p Profile) validate() error {
+	if len(p.AssembliesOfInterest) == 0 {
+		return fmt.Errorf("profile %s lists no assemblies", p.Name)
+	}
+	return nil
+}
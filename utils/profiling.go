@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// StartProfiling starts a CPU profile written to cpuFile, when set. The returned
+// function stops it and writes a heap profile to memFile, when set. Both files
+// are read with go tool pprof.
+func StartProfiling(cpuFile, memFile string) (func() error, error) {
+	var cpu *os.File
+	if cpuFile != "" {
+		var err error
+		if cpu, err = os.Create(cpuFile); err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("starting CPU profile: %w", err)
+		}
+	}
+
+	return func() error {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				return err
+			}
+		}
+		if memFile == "" {
+			return nil
+		}
+
+		mem, err := os.Create(memFile)
+		if err != nil {
+			return err
+		}
+		defer mem.Close()
+
+		// Up-to-date statistics of the live objects
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(mem); err != nil {
+			return fmt.Errorf("writing heap profile: %w", err)
+		}
+		return nil
+	}, nil
+}
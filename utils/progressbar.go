@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// The status line drawn below the logs, like the progress bar. Log lines
+// clear it, are written above it, and draw it again.
+var (
+	statusMu   sync.Mutex
+	statusLine string
+)
+
+// writeLogLine writes a line of logs to stdout, keeping the status line below it
+func writeLogLine(line string) error {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if statusLine != "" {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+		defer fmt.Fprint(os.Stderr, statusLine)
+	}
+	_, err := fmt.Fprintln(os.Stdout, line)
+	return err
+}
+
+// setStatusLine replaces the status line, an empty one clears it
+func setStatusLine(w io.Writer, line string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if line == "" && statusLine == "" {
+		return
+	}
+	statusLine = line
+	fmt.Fprint(w, "\r\x1b[K"+line)
+}
+
+// ProgressBar draws the progress of the running matcher on the terminal: the
+// messages it went through over its total, and the time left
+type ProgressBar struct {
+	progress *MatchingProgress
+	stop     chan struct{}
+	done     chan struct{}
+	started  map[string]time.Time // First time each matcher was seen running
+}
+
+// StartProgressBar draws the progress bar on stderr until Stop is called. It
+// returns nil, which can be stopped too, when stderr isn't a terminal.
+func StartProgressBar(progress *MatchingProgress) *ProgressBar {
+	if !isatty.IsTerminal(os.Stderr.Fd()) {
+		return nil
+	}
+	bar := &ProgressBar{
+		progress: progress,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		started:  make(map[string]time.Time),
+	}
+	go bar.run()
+	return bar
+}
+
+// Stop clears the progress bar
+func (b *ProgressBar) Stop() {
+	if b == nil {
+		return
+	}
+	close(b.stop)
+	<-b.done
+}
+
+func (b *ProgressBar) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			setStatusLine(os.Stderr, "")
+			return
+		case now := <-ticker.C:
+			setStatusLine(os.Stderr, b.render(now))
+		}
+	}
+}
+
+// render returns the line of the last matcher still running, if any
+func (b *ProgressBar) render(now time.Time) string {
+	phases := b.progress.Phases()
+	for i := len(phases) - 1; i >= 0; i-- {
+		phase := phases[i]
+		if phase.Complete || phase.Total == 0 {
+			continue
+		}
+		if _, ok := b.started[phase.Matcher]; !ok {
+			b.started[phase.Matcher] = now
+		}
+
+		percent := float64(phase.Processed) / float64(phase.Total) * 100
+		eta := "?"
+		if elapsed := now.Sub(b.started[phase.Matcher]); phase.Processed > 0 {
+			left := time.Duration(float64(elapsed) / float64(phase.Processed) * float64(phase.Total-phase.Processed))
+			eta = left.Round(time.Second).String()
+		}
+		return fmt.Sprintf("%s %s %d/%d %.1f%% ETA %s", phase.Matcher, createProgressBar(percent), phase.Processed, phase.Total, percent, eta)
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// LoadProtoFiles compiles the proto files of dir (typically the deobfuscated
+// ones) and registers them into a protoregistry.Files, so Go programs can
+// build dynamicpb messages from the schema. The files which failed to compile
+// or to register are returned along with the registry.
+func LoadProtoFiles(dir string) (*protoregistry.Files, []string, error) {
+	files := &protoregistry.Files{}
+	var skipped []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(info.Name()) != ".proto" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		file, err := compileProto(dir, filepath.ToSlash(rel))
+		if err != nil {
+			// Some extracted files have import cycles
+			skipped = append(skipped, rel)
+			return nil
+		}
+		if err := registerFile(files, file); err != nil {
+			skipped = append(skipped, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, skipped, nil
+}
+
+// registerFile registers a file after its imports, which were compiled along with it
+func registerFile(files *protoregistry.Files, file protoreflect.FileDescriptor) error {
+	if _, err := files.FindFileByPath(file.Path()); err == nil {
+		return nil
+	}
+
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		if err := registerFile(files, imports.Get(i).FileDescriptor); err != nil {
+			return fmt.Errorf("registering import %s: %w", imports.Get(i).Path(), err)
+		}
+	}
+
+	return files.RegisterFile(file)
+}
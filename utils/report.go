@@ -1,75 +1,40 @@
 package utils
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"sort"
-	"strings"
-)
-
-func GenerateMatchReport(matches []MessageMatch, outputFile string) error {
-	var report strings.Builder
-
-	report.WriteString("Message Matches Report\n")
-	report.WriteString("======================\n\n")
+	"context"
+	"io"
+	"io/fs"
 
-	// Sort matches for consistent output
-	sort.Slice(matches, func(i, j int) bool {
-		if matches[i].ObfuscatedFile != matches[j].ObfuscatedFile {
-			return matches[i].ObfuscatedFile < matches[j].ObfuscatedFile
-		}
-		return matches[i].ObfuscatedMsg < matches[j].ObfuscatedMsg
-	})
-
-	// Calculate column widths
-	var maxObfsMsg, maxOrigMsg, maxOrigFile int
-	for _, match := range matches {
-		maxObfsMsg = max(maxObfsMsg, len(match.ObfuscatedMsg))
-		maxOrigMsg = max(maxOrigMsg, len(match.OriginalMsg))
-		maxOrigFile = max(maxOrigFile, len(filepath.Base(match.OriginalFile)))
-	}
+	"github.com/ruinedyourlife/deobfs/pkg/report"
+)
 
-	// Write header
-	format := fmt.Sprintf("%%-%ds  →  %%-%ds  %%-%ds  [conf: %%%d.2f%%%%]\n",
-		maxObfsMsg, maxOrigMsg, maxOrigFile, 6)
+// BuildRenameMap returns the obfuscated -> original message name mapping for a set of matches
+func BuildRenameMap(matches []MessageMatch) map[string]string {
+	return report.Renames(matches)
+}
 
-	report.WriteString(fmt.Sprintf(format,
-		"Obf",
-		"Orig",
-		"File",
-		0.0,
-	))
+// ApplyMatches writes a copy of the proto files of srcDir to outDir with the
+// matched messages renamed
+func ApplyMatches(ctx context.Context, matches []MessageMatch, srcDir, outDir string) error {
+	return report.Apply(ctx, matches, srcDir, outDir)
+}
 
-	// Write separator
-	totalWidth := maxObfsMsg + maxOrigMsg + maxOrigFile + 23 // 20 for spacing and symbols
-	report.WriteString(strings.Repeat("-", totalWidth) + "\n")
+// ApplyMatchesFS is ApplyMatches reading the proto files from fsys
+func ApplyMatchesFS(ctx context.Context, matches []MessageMatch, fsys fs.FS, outDir string) error {
+	return report.ApplyFS(ctx, matches, fsys, outDir)
+}
 
-	// Write matches
-	for _, match := range matches {
-		if len(match.Alternatives) > 0 {
-			// For uncertain matches, list all possibilities as alternatives
-			allPossibilities := append([]string{match.OriginalMsg}, match.Alternatives...)
-			report.WriteString(fmt.Sprintf(format,
-				match.ObfuscatedMsg,
-				"???", // Show uncertainty in main match
-				"???", // Don't show file when uncertain
-				match.MatchPercent,
-			))
-			report.WriteString(fmt.Sprintf("    Possible matches: %s\n",
-				strings.Join(allPossibilities, ", ")))
-		} else {
-			// For definitive matches
-			report.WriteString(fmt.Sprintf(format,
-				match.ObfuscatedMsg,
-				match.OriginalMsg,
-				filepath.Base(match.OriginalFile),
-				match.MatchPercent,
-			))
-		}
-	}
+// ApplyMatchesSubset is ApplyMatchesFS writing only the files keep accepts
+func ApplyMatchesSubset(ctx context.Context, matches []MessageMatch, fsys fs.FS, outDir string, keep func(path string) bool) error {
+	return report.ApplySubset(ctx, matches, fsys, outDir, keep)
+}
 
-	report.WriteString(fmt.Sprintf("\nTotal matches: %d\n", len(matches)))
+// GenerateMatchReport writes the text report of the matches to outputFile
+func GenerateMatchReport(ctx context.Context, matches []MessageMatch, outputFile string) error {
+	return report.WriteTextFile(ctx, matches, outputFile)
+}
 
-	return os.WriteFile(outputFile, []byte(report.String()), 0644)
+// WriteMatchReport writes the text report of the matches to w
+func WriteMatchReport(ctx context.Context, w io.Writer, matches []MessageMatch) error {
+	return report.WriteText(ctx, w, matches)
 }
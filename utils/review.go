@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The decisions of a review queue entry
+const (
+	ReviewPending = "?"
+	ReviewAccept  = "accept"
+	ReviewReject  = "reject"
+	ReviewReplace = "replace"
+)
+
+// ReviewEntry is a match to review, a line of a review queue: the decision,
+// the obfuscated message and its candidates, the proposed original first
+type ReviewEntry struct {
+	Decision    string
+	Replacement string // Original chosen by a replace decision
+	Obfuscated  string
+	Candidates  []Alternative
+}
+
+const reviewHeader = `# deobfs review queue: one match per line, the obfuscated message then its
+# candidates with their confidence, the proposed original first. Replace the
+# leading ? with
+#   accept         to keep the proposed original
+#   reject         to never pair the message with it: the runs given the
+#                  seed file (-seed) match it to its next candidate, if any
+#   replace=Name   to name the message Name instead, a candidate or not
+# and import the queue with deobfs review import. Entries left at ? are skipped.
+`
+
+// NewReviewQueue returns the matches to review: the uncertain ones and the
+// ones under threshold, in the order of the reports. The seeds are decisions
+// already and left out.
+func NewReviewQueue(matches []MessageMatch, threshold float64) []ReviewEntry {
+	var queue []ReviewEntry
+	for _, match := range SortedMatches(matches) {
+		if match.Matcher == "seed" || (len(match.Alternatives) == 0 && match.MatchPercent >= threshold) {
+			continue
+		}
+		entry := ReviewEntry{
+			Decision:   ReviewPending,
+			Obfuscated: match.ObfuscatedMsg,
+			Candidates: append([]Alternative{{Name: match.OriginalMsg, File: match.OriginalFile, Confidence: match.MatchPercent}}, match.Alternatives...),
+		}
+		queue = append(queue, entry)
+	}
+	return queue
+}
+
+// WriteReviewQueue writes a review queue, with a header telling how to edit it
+func WriteReviewQueue(w io.Writer, queue []ReviewEntry) error {
+	writer := bufio.NewWriter(w)
+	writer.WriteString(reviewHeader)
+	for _, entry := range queue {
+		decision := entry.Decision
+		if decision == ReviewReplace {
+			decision += "=" + entry.Replacement
+		}
+		fmt.Fprintf(writer, "%s %s", decision, entry.Obfuscated)
+		for _, candidate := range entry.Candidates {
+			fmt.Fprintf(writer, "  %s %.2f%%", candidate.Name, candidate.Confidence)
+		}
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
+
+// ParseReviewQueue reads a review queue written by WriteReviewQueue and
+// edited since, skipping the blank and comment lines
+func ParseReviewQueue(r io.Reader) ([]ReviewEntry, error) {
+	var queue []ReviewEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, err := parseReviewEntry(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		queue = append(queue, entry)
+	}
+	return queue, scanner.Err()
+}
+
+func parseReviewEntry(text string) (ReviewEntry, error) {
+	words := strings.Fields(text)
+	if len(words) < 2 {
+		return ReviewEntry{}, fmt.Errorf("expected a decision and an obfuscated message, got %q", text)
+	}
+	entry := ReviewEntry{Obfuscated: words[1]}
+	switch decision, replacement, _ := strings.Cut(words[0], "="); decision {
+	case ReviewPending, ReviewAccept, ReviewReject:
+		entry.Decision = decision
+	case ReviewReplace:
+		if replacement == "" {
+			return ReviewEntry{}, fmt.Errorf("%s of %s needs a name, like replace=Name", decision, entry.Obfuscated)
+		}
+		entry.Decision, entry.Replacement = decision, replacement
+	default:
+		return ReviewEntry{}, fmt.Errorf("unknown decision %q for %s, expected ?, accept, reject or replace=Name", words[0], entry.Obfuscated)
+	}
+
+	candidates := words[2:]
+	if len(candidates)%2 != 0 {
+		return ReviewEntry{}, fmt.Errorf("the candidates of %s must be names followed by their confidence", entry.Obfuscated)
+	}
+	for i := 0; i < len(candidates); i += 2 {
+		confidence, err := strconv.ParseFloat(strings.TrimSuffix(candidates[i+1], "%"), 64)
+		if err != nil {
+			return ReviewEntry{}, fmt.Errorf("confidence of candidate %s of %s: %w", candidates[i], entry.Obfuscated, err)
+		}
+		entry.Candidates = append(entry.Candidates, Alternative{Name: candidates[i], Confidence: confidence})
+	}
+	if len(entry.Candidates) == 0 && (entry.Decision == ReviewAccept || entry.Decision == ReviewReject) {
+		return ReviewEntry{}, fmt.Errorf("%s of %s has no candidate to %s", entry.Decision, entry.Obfuscated, entry.Decision)
+	}
+	return entry, nil
+}
+
+// ReviewSeeds turns the decisions of a review queue into seeds: accepted and
+// replaced entries name their message, rejected ones reject the proposed
+// original. Pending entries are skipped. source tells where the seeds come
+// from.
+func ReviewSeeds(queue []ReviewEntry, source string) []Seed {
+	var seeds []Seed
+	for _, entry := range queue {
+		switch entry.Decision {
+		case ReviewAccept:
+			seeds = append(seeds, Seed{Obfuscated: entry.Obfuscated, Original: entry.Candidates[0].Name, Source: source})
+		case ReviewReject:
+			seeds = append(seeds, Seed{Obfuscated: entry.Obfuscated, Original: entry.Candidates[0].Name, Source: source, Rejected: true})
+		case ReviewReplace:
+			seeds = append(seeds, Seed{Obfuscated: entry.Obfuscated, Original: entry.Replacement, Source: source})
+		}
+	}
+	return seeds
+}
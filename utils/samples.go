@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Sample is a captured payload of an obfuscated message, as exported by `decode -jsonl`
+type Sample struct {
+	MessageId int    `json:"messageId"`
+	Type      string `json:"type"`
+	Payload   []byte `json:"payload"`
+}
+
+// LoadSamples reads a JSONL file of samples, skipping the lines without payload
+func LoadSamples(path string) ([]Sample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var samples []Sample
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var sample Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if len(sample.Payload) > 0 {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples, scanner.Err()
+}
+
+// ValidateSamples parses the captured samples of every matched message with
+// its clear candidates. A definitive match failing to parse its samples is
+// reported, and an uncertain match is resolved when a single candidate parses
+// all of them cleanly, in place. The clear files are read from clearFS, rooted
+// at clearRoot. It returns the resolved matches.
+func ValidateSamples(matches []MessageMatch, samples []Sample, clearFS fs.FS, clearRoot string, logger *slog.Logger) []MessageMatch {
+	byMessage := make(map[string][][]byte)
+	ids := make(map[int]string)
+	for _, match := range matches {
+		if match.MessageId != 0 {
+			ids[match.MessageId] = match.ObfuscatedMsg
+		}
+	}
+	for _, sample := range samples {
+		name := sample.Type
+		if sample.MessageId != 0 && ids[sample.MessageId] != "" {
+			name = ids[sample.MessageId]
+		}
+		byMessage[name] = append(byMessage[name], sample.Payload)
+	}
+
+	compiler := &sampleCompiler{fsys: clearFS, root: clearRoot, files: make(map[string]protoreflect.FileDescriptor)}
+	var resolved []MessageMatch
+
+	for i := range matches {
+		match := &matches[i]
+		payloads := byMessage[match.ObfuscatedMsg]
+		if len(payloads) == 0 {
+			continue
+		}
+
+		candidates := append([]Alternative{{Name: match.OriginalMsg, File: match.OriginalFile, Confidence: match.MatchPercent}}, match.Alternatives...)
+		var clean []Alternative
+		for _, candidate := range candidates {
+			desc, err := compiler.find(candidate.File, candidate.Name)
+			if err != nil {
+				logger.Debug("can't check samples with candidate", "candidate", candidate.Name, "error", err)
+				continue
+			}
+			failures := countSampleFailures(desc, payloads)
+			logger.Debug("checked samples", "obfuscated", match.ObfuscatedMsg, "candidate", candidate.Name, "samples", len(payloads), "failures", failures)
+			if failures == 0 {
+				clean = append(clean, candidate)
+			}
+		}
+
+		switch {
+		case len(match.Alternatives) == 0 && len(clean) == 0:
+			logger.Warn("captured samples don't parse with the matched message",
+				"obfuscated", match.ObfuscatedMsg, "original", match.OriginalMsg, "samples", len(payloads))
+		case len(match.Alternatives) > 0 && len(clean) == 1:
+			logger.Info("resolved uncertain match with captured samples",
+				"obfuscated", match.ObfuscatedMsg, "original", clean[0].Name, "samples", len(payloads))
+			match.OriginalMsg = clean[0].Name
+			match.OriginalFile = clean[0].File
+			match.MatchPercent = clean[0].Confidence
+			match.Matcher = "samples"
+			match.Alternatives = nil
+			resolved = append(resolved, *match)
+		}
+	}
+
+	return resolved
+}
+
+// UpdateResolved replaces the matches resolved by ValidateSamples in
+// matches, like the ones of a report, found by their obfuscated message and
+// file
+func UpdateResolved(matches, resolved []MessageMatch) {
+	byMessage := make(map[[2]string]MessageMatch, len(resolved))
+	for _, match := range resolved {
+		byMessage[[2]string{match.ObfuscatedMsg, match.ObfuscatedFile}] = match
+	}
+	for i, match := range matches {
+		if update, ok := byMessage[[2]string{match.ObfuscatedMsg, match.ObfuscatedFile}]; ok {
+			matches[i] = update
+		}
+	}
+}
+
+// countSampleFailures returns how many payloads don't parse cleanly: either
+// invalid, or carrying fields unknown to the descriptor
+func countSampleFailures(desc protoreflect.MessageDescriptor, payloads [][]byte) int {
+	failures := 0
+	for _, payload := range payloads {
+		msg := dynamicpb.NewMessage(desc)
+		if err := proto.Unmarshal(payload, msg); err != nil || hasUnknownFields(msg) {
+			failures++
+		}
+	}
+	return failures
+}
+
+func hasUnknownFields(msg protoreflect.Message) bool {
+	if len(msg.GetUnknown()) > 0 {
+		return true
+	}
+
+	unknown := false
+	msg.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Message() == nil {
+			return true
+		}
+		switch {
+		case field.IsList():
+			for i := 0; i < value.List().Len() && !unknown; i++ {
+				unknown = hasUnknownFields(value.List().Get(i).Message())
+			}
+		case field.IsMap():
+			if field.MapValue().Message() != nil {
+				value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					unknown = hasUnknownFields(v.Message())
+					return !unknown
+				})
+			}
+		default:
+			unknown = hasUnknownFields(value.Message())
+		}
+		return !unknown
+	})
+	return unknown
+}
+
+// sampleCompiler compiles clear files on demand, keeping them for the next candidates
+type sampleCompiler struct {
+	fsys  fs.FS
+	root  string
+	files map[string]protoreflect.FileDescriptor
+}
+
+func (c *sampleCompiler) find(sourceFile, name string) (protoreflect.MessageDescriptor, error) {
+	file, ok := c.files[sourceFile]
+	if !ok {
+		rel, err := filepath.Rel(c.root, sourceFile)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		dir, base := ".", rel
+		if i := strings.LastIndex(rel, "/"); i >= 0 {
+			dir, base = rel[:i], rel[i+1:]
+		}
+
+		compiler := protocompile.Compiler{
+			Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+				ImportPaths: []string{dir},
+				Accessor: func(path string) (io.ReadCloser, error) {
+					return c.fsys.Open(path)
+				},
+			}),
+		}
+		compiled, err := compiler.Compile(context.Background(), base)
+		if err != nil {
+			return nil, err
+		}
+		file = compiled[0]
+		c.files[sourceFile] = file
+	}
+
+	// Nested messages are named like Parent.Child
+	parts := strings.Split(name, ".")
+	desc := file.Messages().ByName(protoreflect.Name(parts[0]))
+	for _, part := range parts[1:] {
+		if desc == nil {
+			break
+		}
+		desc = desc.Messages().ByName(protoreflect.Name(part))
+	}
+	if desc == nil {
+		return nil, fmt.Errorf("message %s not found in %s", name, sourceFile)
+	}
+	return desc, nil
+}
@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Seed forces the original name of an obfuscated message, skipping the matchers.
+// A rejected seed instead keeps the matchers from making the pair, the message
+// falling back to its next candidate.
+type Seed struct {
+	Obfuscated string `json:"obfuscated"`
+	Original   string `json:"original"`
+	Source     string `json:"source,omitempty"` // Where the pair comes from, like an imported file
+	Rejected   bool   `json:"rejected,omitempty"`
+}
+
+// SeedFile is the seed/override format read with -seed
+type SeedFile struct {
+	Seeds []Seed `json:"seeds"`
+}
+
+// LoadSeeds reads a seed file
+func LoadSeeds(path string) ([]Seed, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file SeedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return file.Seeds, nil
+}
+
+// WriteSeeds writes a seed file, sorted by obfuscated then original name
+func WriteSeeds(seeds []Seed, path string) error {
+	sorted := append([]Seed{}, seeds...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Obfuscated != sorted[j].Obfuscated {
+			return sorted[i].Obfuscated < sorted[j].Obfuscated
+		}
+		return sorted[i].Original < sorted[j].Original
+	})
+
+	data, err := json.MarshalIndent(SeedFile{Seeds: sorted}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// MergeSeeds adds seeds to existing ones. An added seed replaces the one
+// forcing the same obfuscated message, a rejection only the decision on its
+// pair, so several originals can be rejected for one message.
+func MergeSeeds(existing, added []Seed) []Seed {
+	// Forced seeds are keyed by their obfuscated name alone, rejections by their pair
+	byKey := make(map[[2]string]Seed)
+	for _, seed := range append(append([]Seed{}, existing...), added...) {
+		forced := [2]string{seed.Obfuscated, ""}
+		if seed.Rejected {
+			if previous, ok := byKey[forced]; ok && previous.Original == seed.Original {
+				delete(byKey, forced)
+			}
+			byKey[[2]string{seed.Obfuscated, seed.Original}] = seed
+		} else {
+			delete(byKey, [2]string{seed.Obfuscated, seed.Original})
+			byKey[forced] = seed
+		}
+	}
+
+	keys := make([][2]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	merged := make([]Seed, 0, len(keys))
+	for _, key := range keys {
+		merged = append(merged, byKey[key])
+	}
+	return merged
+}
+
+// RejectedPairs returns the pairs of the rejected seeds, for the matchers to
+// leave out
+func RejectedPairs(seeds []Seed) []MessageMatch {
+	var pairs []MessageMatch
+	for _, seed := range seeds {
+		if seed.Rejected {
+			pairs = append(pairs, MessageMatch{ObfuscatedMsg: seed.Obfuscated, OriginalMsg: seed.Original, Matcher: "seed"})
+		}
+	}
+	return pairs
+}
+
+// ResolveSeeds turns seeds into matches, skipping the ones whose messages are unknown
+func ResolveSeeds(seeds []Seed, obfuscated, unobfuscated *Descriptor, logger *slog.Logger) []MessageMatch {
+	obfuscatedFiles := make(map[string]string)
+	for _, msg := range obfuscated.MessageType {
+		obfuscatedFiles[msg.Name] = msg.SourceFile
+	}
+	unobfuscatedFiles := make(map[string]string)
+	for _, msg := range unobfuscated.MessageType {
+		unobfuscatedFiles[msg.Name] = msg.SourceFile
+	}
+
+	var matches []MessageMatch
+	for _, seed := range seeds {
+		if seed.Rejected {
+			continue
+		}
+		obfuscatedFile, okObs := obfuscatedFiles[seed.Obfuscated]
+		originalFile, okUnobs := unobfuscatedFiles[seed.Original]
+		if !okObs || !okUnobs {
+			logger.Warn("ignoring seed with unknown messages", "obfuscated", seed.Obfuscated, "original", seed.Original)
+			continue
+		}
+		matches = append(matches, MessageMatch{
+			ObfuscatedMsg:  seed.Obfuscated,
+			ObfuscatedFile: obfuscatedFile,
+			OriginalMsg:    seed.Original,
+			OriginalFile:   originalFile,
+			MatchPercent:   100,
+			Matcher:        "seed",
+		})
+	}
+
+	return matches
+}
+
+// WithoutRejected returns the matches whose pair isn't rejected by a seed, for
+// the matches the matchers didn't make in this run: carried from the previous
+// mapping, or rejected once matched
+func WithoutRejected(ctx context.Context, matches []MessageMatch, seeds []Seed, logger *slog.Logger) []MessageMatch {
+	rejected := make(map[[2]string]Seed)
+	for _, seed := range seeds {
+		if seed.Rejected {
+			rejected[[2]string{seed.Obfuscated, seed.Original}] = seed
+		}
+	}
+	if len(rejected) == 0 {
+		return matches
+	}
+
+	var kept []MessageMatch
+	for _, match := range matches {
+		if seed, ok := rejected[[2]string{match.ObfuscatedMsg, match.OriginalMsg}]; ok {
+			logger.Info("dropping rejected match", "obfuscated", match.ObfuscatedMsg, "original", match.OriginalMsg)
+			EmitEvent(ctx, Event{Kind: EventMatchRejected, Matcher: "seed", Match: &match, Reason: fmt.Sprintf("rejected by seed (%s)", seed.Source)})
+			continue
+		}
+		kept = append(kept, match)
+	}
+	return kept
+}
+
+// Keys recognized for the names in the mapping files of other tools
+var (
+	communityObfuscatedKeys = []string{"obfuscated", "obfuscatedMsg", "obfuscated_name", "obf", "from", "old"}
+	communityOriginalKeys   = []string{"original", "originalMsg", "original_name", "name", "clear", "to", "new"}
+)
+
+// ImportCommunityMapping reads the name map of another deobfuscation tool.
+// Supported formats are csv (obfuscated,original lines, with an optional
+// header) and json (an object mapping obfuscated to original names, or a list
+// of objects with usual key names). An empty format is guessed from the extension.
+func ImportCommunityMapping(path, format string) ([]Seed, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pairs [][2]string
+	switch format {
+	case "csv", "tsv":
+		pairs, err = readCSVNameMap(file, format == "tsv")
+	case "json":
+		pairs, err = readJSONNameMap(file)
+	default:
+		return nil, fmt.Errorf("unsupported mapping format %q, use csv or json", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var seeds []Seed
+	for _, pair := range pairs {
+		obfuscated, original := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+		if obfuscated == "" || original == "" || obfuscated == original {
+			continue
+		}
+		seeds = append(seeds, Seed{Obfuscated: obfuscated, Original: original, Source: filepath.Base(path)})
+	}
+	return seeds, nil
+}
+
+func readCSVNameMap(r io.Reader, tabs bool) ([][2]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	if tabs {
+		reader.Comma = '\t'
+	}
+
+	var pairs [][2]string
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			continue
+		}
+		// Header line
+		if line == 0 && containsFold(communityObfuscatedKeys, record[0]) {
+			continue
+		}
+		pairs = append(pairs, [2]string{record[0], record[1]})
+	}
+	return pairs, nil
+}
+
+func readJSONNameMap(r io.Reader) ([][2]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var object map[string]string
+	if err := json.Unmarshal(data, &object); err == nil {
+		var pairs [][2]string
+		for _, obfuscated := range sortedKeys(object) {
+			pairs = append(pairs, [2]string{obfuscated, object[obfuscated]})
+		}
+		return pairs, nil
+	}
+
+	var list []map[string]any
+	if err := json.Unmarshal(data, &list); err != nil {
+		// Also accept our own mapping.json
+		var mapping Mapping
+		if mappingErr := json.Unmarshal(data, &mapping); mappingErr != nil || len(mapping.Matches) == 0 {
+			return nil, errors.New("expected an object of names or a list of pairs")
+		}
+		var pairs [][2]string
+		for _, match := range mapping.Matches {
+			if len(match.Alternatives) == 0 {
+				pairs = append(pairs, [2]string{match.ObfuscatedMsg, match.OriginalMsg})
+			}
+		}
+		return pairs, nil
+	}
+
+	var pairs [][2]string
+	for _, entry := range list {
+		pairs = append(pairs, [2]string{lookupString(entry, communityObfuscatedKeys), lookupString(entry, communityOriginalKeys)})
+	}
+	return pairs, nil
+}
+
+func lookupString(entry map[string]any, keys []string) string {
+	for _, key := range keys {
+		if value, ok := entry[key].(string); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
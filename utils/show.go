@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/fatih/color"
+)
+
+// Narrowest the name columns of PrintMapping get when the terminal is too small
+const (
+	minNameColumn = 12
+	minFileColumn = 8
+)
+
+// PrintMapping renders a mapping as a colored, aligned view for the terminal.
+// Lines are cut to width columns, the file then the name columns shrinking
+// first, or kept whole when width is 0.
+func PrintMapping(w io.Writer, mapping *Mapping, width int) {
+	bold := color.New(color.Bold)
+	blue := color.New(color.FgBlue)
+	green := color.New(color.FgGreen)
+	yellow := color.New(color.FgYellow)
+	red := color.New(color.FgRed)
+	cyan := color.New(color.FgCyan)
+
+	// Calculate column widths
+	var maxObfsMsg, maxOrigMsg, maxOrigFile int
+	for _, match := range mapping.Matches {
+		maxObfsMsg = max(maxObfsMsg, len(match.ObfuscatedMsg))
+		maxOrigMsg = max(maxOrigMsg, len(match.OriginalMsg))
+		maxOrigFile = max(maxOrigFile, len(filepath.Base(match.OriginalFile)))
+	}
+	if width > 0 {
+		line := 2 + maxObfsMsg + 5 + maxOrigMsg + 2 + maxOrigFile + 2 + visibleWidth("[conf: "+formatConfidence(100)+"]")
+		excess := max(line-width, 0)
+		shrink := min(excess, max(maxOrigFile-minFileColumn, 0))
+		maxOrigFile -= shrink
+		maxOrigMsg -= min(excess-shrink, max(maxOrigMsg-minNameColumn, 0))
+	}
+
+	currentFile := ""
+	for _, match := range mapping.Matches {
+		if file := filepath.Base(match.ObfuscatedFile); file != currentFile {
+			if currentFile != "" {
+				fmt.Fprintln(w, "----------------------------------------")
+			}
+			currentFile = file
+			bold.Fprint(w, blue.Sprint("> file: "), file, "\n")
+		}
+
+		fmt.Fprintf(w, "  %s  →  %s  %s  [conf: %s]\n",
+			green.Sprintf("%-*s", maxObfsMsg, match.ObfuscatedMsg),
+			bold.Sprintf("%-*s", maxOrigMsg, truncateText(match.OriginalMsg, maxOrigMsg)),
+			cyan.Sprintf("%-*s", maxOrigFile, truncateText(filepath.Base(match.OriginalFile), maxOrigFile)),
+			formatConfidence(match.MatchPercent),
+		)
+		if match.MessageId != 0 {
+			fmt.Fprintf(w, "      %s %d\n", blue.Sprint("id:"), match.MessageId)
+		}
+
+		for _, alt := range match.Alternatives {
+			fmt.Fprintf(w, "      %s %s  %s  [conf: %s]\n",
+				yellow.Sprint("alternative:"),
+				bold.Sprint(alt.Name),
+				cyan.Sprint(filepath.Base(alt.File)),
+				formatConfidence(alt.Confidence),
+			)
+		}
+
+		for _, enumMatch := range match.EnumMatches {
+			line := fmt.Sprintf("      %s %s -> %s ",
+				red.Sprint("enum:"),
+				yellow.Sprint(enumMatch.ObfuscatedEnum),
+				yellow.Sprint(enumMatch.OriginalEnum),
+			)
+			values := fmt.Sprint(enumMatch.Values)
+			if width > 0 {
+				values = truncateText(values, max(width-visibleWidth(line), minEnumValuesLength))
+			}
+			fmt.Fprintln(w, line+values)
+		}
+	}
+	fmt.Fprintln(w, "----------------------------------------")
+	fmt.Fprintf(w, "Total matches: %s\n", green.Sprint(len(mapping.Matches)))
+}
+
+// formatConfidence shows the band of a confidence with its color, or with an
+// ASCII marker when colors are off: + for perfect, ~ for good enough, ! below
+// the default threshold
+func formatConfidence(percent float64) string {
+	band, marker := color.New(color.FgGreen), "+"
+	switch {
+	case percent < 80:
+		band, marker = color.New(color.FgRed), "!"
+	case percent < 100:
+		band, marker = color.New(color.FgYellow), "~"
+	}
+	if color.NoColor {
+		return fmt.Sprintf("%6.2f%% %s", percent, marker)
+	}
+	return band.Sprintf("%6.2f%%", percent)
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const sqliteSchema = `
+CREATE TABLE matches (
+	id              INTEGER PRIMARY KEY,
+	obfuscated_msg  TEXT NOT NULL,
+	obfuscated_file TEXT NOT NULL,
+	original_msg    TEXT NOT NULL,
+	original_file   TEXT NOT NULL,
+	confidence      REAL NOT NULL,
+	matcher         TEXT NOT NULL,
+	uncertain       INTEGER NOT NULL
+);
+CREATE TABLE alternatives (
+	match_id   INTEGER NOT NULL REFERENCES matches(id),
+	name       TEXT NOT NULL,
+	file       TEXT NOT NULL,
+	confidence REAL NOT NULL
+);
+CREATE TABLE enums (
+	id              INTEGER PRIMARY KEY,
+	match_id        INTEGER NOT NULL REFERENCES matches(id),
+	obfuscated_enum TEXT NOT NULL,
+	original_enum   TEXT NOT NULL,
+	confidence      REAL NOT NULL
+);
+CREATE TABLE enum_values (
+	enum_id INTEGER NOT NULL REFERENCES enums(id),
+	name    TEXT NOT NULL,
+	number  INTEGER NOT NULL
+);
+CREATE TABLE fields (
+	match_id        INTEGER NOT NULL REFERENCES matches(id),
+	number          INTEGER NOT NULL,
+	obfuscated_name TEXT,
+	original_name   TEXT,
+	obfuscated_type TEXT,
+	original_type   TEXT,
+	label           TEXT
+);
+CREATE TABLE evidence (
+	match_id INTEGER NOT NULL REFERENCES matches(id),
+	matcher  TEXT NOT NULL,
+	detail   TEXT NOT NULL
+);
+CREATE INDEX matches_obfuscated ON matches(obfuscated_msg);
+CREATE INDEX matches_original ON matches(original_msg);
+`
+
+// GenerateSQLiteReport writes the matches, their enums, aligned fields and
+// evidence into a SQLite database, replacing any existing one
+func GenerateSQLiteReport(matches []MessageMatch, obfuscated, unobfuscated *Descriptor, outputFile string) error {
+	// SQLite only tells it can't open the file
+	if _, err := os.Stat(filepath.Dir(outputFile)); err != nil {
+		return reportError(outputFile, err)
+	}
+	if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := openSQLite(outputFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("creating schema: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	obfsMessages := indexMessages(obfuscated)
+	unobsMessages := indexMessages(unobfuscated)
+
+	for _, match := range matches {
+		res, err := tx.Exec(`INSERT INTO matches (obfuscated_msg, obfuscated_file, original_msg, original_file, confidence, matcher, uncertain) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			match.ObfuscatedMsg, match.ObfuscatedFile, match.OriginalMsg, match.OriginalFile, match.MatchPercent, match.Matcher, len(match.Alternatives) > 0)
+		if err != nil {
+			return err
+		}
+		matchID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, alt := range match.Alternatives {
+			if _, err := tx.Exec(`INSERT INTO alternatives (match_id, name, file, confidence) VALUES (?, ?, ?, ?)`,
+				matchID, alt.Name, alt.File, alt.Confidence); err != nil {
+				return err
+			}
+		}
+
+		for _, enumMatch := range match.EnumMatches {
+			res, err := tx.Exec(`INSERT INTO enums (match_id, obfuscated_enum, original_enum, confidence) VALUES (?, ?, ?, ?)`,
+				matchID, strings.TrimSpace(enumMatch.ObfuscatedEnum), strings.TrimSpace(enumMatch.OriginalEnum), enumMatch.Confidence)
+			if err != nil {
+				return err
+			}
+			enumID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+
+			for _, value := range enumMatch.Values {
+				name, number, _ := strings.Cut(value, "=")
+				if _, err := tx.Exec(`INSERT INTO enum_values (enum_id, name, number) VALUES (?, ?, ?)`,
+					enumID, name, enumValueNumber(number)); err != nil {
+					return err
+				}
+			}
+
+			if _, err := tx.Exec(`INSERT INTO evidence (match_id, matcher, detail) VALUES (?, ?, ?)`,
+				matchID, match.Matcher, fmt.Sprintf("enum %s matches %s (%.2f%%)",
+					strings.TrimSpace(enumMatch.ObfuscatedEnum), strings.TrimSpace(enumMatch.OriginalEnum), enumMatch.Confidence)); err != nil {
+				return err
+			}
+		}
+
+		if len(match.EnumMatches) == 0 {
+			if _, err := tx.Exec(`INSERT INTO evidence (match_id, matcher, detail) VALUES (?, ?, ?)`,
+				matchID, match.Matcher, fmt.Sprintf("structure similarity %.2f%%", match.MatchPercent)); err != nil {
+				return err
+			}
+		}
+
+		obfsMsg, okObfs := obfsMessages[match.ObfuscatedMsg]
+		unobsMsg, okUnobs := unobsMessages[match.OriginalMsg]
+		if !okObfs || !okUnobs {
+			continue
+		}
+		for _, pair := range alignFields(obfsMsg, unobsMsg) {
+			if _, err := tx.Exec(`INSERT INTO fields (match_id, number, obfuscated_name, original_name, obfuscated_type, original_type, label) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				matchID, pair.number, pair.obfuscated.Name, pair.original.Name, pair.obfuscated.Type, pair.original.Type, pair.label()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+type fieldPair struct {
+	number     int
+	obfuscated Field
+	original   Field
+}
+
+func (p fieldPair) label() string {
+	if p.obfuscated.Label != "" {
+		return p.obfuscated.Label
+	}
+	return p.original.Label
+}
+
+// Pair the fields of two messages by field number, keeping unpaired ones
+func alignFields(obfs, unobs MessageType) []fieldPair {
+	var pairs []fieldPair
+	byNumber := make(map[int]int)
+
+	for _, field := range obfs.Field {
+		byNumber[field.Number] = len(pairs)
+		pairs = append(pairs, fieldPair{number: field.Number, obfuscated: field})
+	}
+	for _, field := range unobs.Field {
+		if i, ok := byNumber[field.Number]; ok {
+			pairs[i].original = field
+			continue
+		}
+		pairs = append(pairs, fieldPair{number: field.Number, original: field})
+	}
+
+	return pairs
+}
+
+// Index top-level messages by name
+func indexMessages(desc *Descriptor) map[string]MessageType {
+	messages := make(map[string]MessageType)
+	if desc == nil {
+		return messages
+	}
+	for _, msg := range desc.MessageType {
+		messages[msg.Name] = msg
+	}
+	return messages
+}
+
+// enumValueNumber returns the number of an enum value written name=number
+func enumValueNumber(s string) int {
+	number, _ := strconv.Atoi(strings.TrimSpace(s))
+	return number
+}
@@ -0,0 +1,14 @@
+//go:build cgo
+
+package utils
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openSQLite opens (or creates) a SQLite database file
+func openSQLite(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", path)
+}
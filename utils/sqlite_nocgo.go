@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package utils
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrNoSQLite is returned by the history and the sqlite report of the builds
+// without cgo, which the SQLite driver needs
+var ErrNoSQLite = errors.New("this build of deobfs has no SQLite support, build it with cgo (CGO_ENABLED=1 and a C compiler) for the history and the sqlite report")
+
+func openSQLite(path string) (*sql.DB, error) {
+	return nil, ErrNoSQLite
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/mattn/go-isatty"
+)
+
+// TerminalWidth returns the number of columns of the terminal of f, COLUMNS
+// when it is set, or 0 when f isn't a terminal
+func TerminalWidth(f *os.File) int {
+	if !isatty.IsTerminal(f.Fd()) {
+		return 0
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return terminalColumns(f.Fd())
+}
+
+// visibleWidth is the number of columns text takes, without its color codes
+func visibleWidth(text string) int {
+	return utf8.RuneCountInString(ansiRegex.ReplaceAllString(text, ""))
+}
+
+// truncateText cuts plain text to width columns, ending it with ... when cut
+func truncateText(text string, width int) string {
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:max(width-3, 0)]) + "..."
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package utils
+
+// The size of the console isn't read on these systems, only COLUMNS
+func terminalColumns(fd uintptr) int {
+	return 0
+}
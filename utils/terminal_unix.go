@@ -0,0 +1,13 @@
+//go:build unix
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+func terminalColumns(fd uintptr) int {
+	size, err := unix.IoctlGetWinsize(int(fd), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0
+	}
+	return int(size.Col)
+}
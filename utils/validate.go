@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/fatih/color"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ValidateRoundTrip compiles every proto file of originalDir and its renamed
+// counterpart in generatedDir, then compares both descriptors structurally.
+// Names are ignored, except for type references which must follow the renames
+// applied by ApplyMatches. It returns the list of problems found.
+func ValidateRoundTrip(originalDir, generatedDir string, matches []MessageMatch, logger *slog.Logger) ([]string, error) {
+	renames := BuildRenameMap(matches)
+
+	var files []string
+	err := filepath.Walk(originalDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(info.Name()) == ".proto" {
+			rel, err := filepath.Rel(originalDir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("validating %s generated proto files", color.BlueString(fmt.Sprint(len(files)))))
+
+	var problems []string
+	for _, file := range files {
+		// Files are compiled one by one, since the obfuscated protos have no
+		// package and enum values of unrelated files would conflict
+		original, err := compileProto(originalDir, file)
+		if err != nil {
+			logger.Warn("skipping the validation of a file which does not compile before renaming", "file", file, "error", err)
+			continue
+		}
+
+		generated, err := compileProto(generatedDir, file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: does not compile after renaming: %v", file, err))
+			continue
+		}
+
+		problems = append(problems, compareFileDescriptors(file, original, generated, renames)...)
+	}
+
+	return problems, nil
+}
+
+// CheckCompiles compiles every proto file of dir on its own, its imports
+// resolved from dir, and returns the files which don't compile with their
+// first error. It stops when ctx is cancelled.
+func CheckCompiles(ctx context.Context, dir string) ([]ParseFailure, error) {
+	return CheckCompilesFS(ctx, os.DirFS(dir), dir)
+}
+
+// CheckCompilesFS is CheckCompiles on the proto files of fsys, reporting them
+// relative to name
+func CheckCompilesFS(ctx context.Context, fsys fs.FS, name string) ([]ParseFailure, error) {
+	resolver := &protocompile.SourceResolver{
+		Accessor: func(path string) (io.ReadCloser, error) {
+			return fsys.Open(path)
+		},
+	}
+
+	var failures []ParseFailure
+	err := fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".proto" {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := compileWith(ctx, resolver, path); err != nil {
+			failures = append(failures, ParseFailure{File: filepath.Join(name, filepath.FromSlash(path)), Err: err})
+		}
+		return nil
+	})
+	return failures, err
+}
+
+func compileProto(importPath, file string) (protoreflect.FileDescriptor, error) {
+	return compileWith(context.Background(), &protocompile.SourceResolver{ImportPaths: []string{importPath}}, file)
+}
+
+func compileWith(ctx context.Context, resolver protocompile.Resolver, file string) (protoreflect.FileDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(resolver),
+	}
+
+	compiled, err := compiler.Compile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	return compiled[0], nil
+}
+
+func compareFileDescriptors(file string, original, generated protoreflect.FileDescriptor, renames map[string]string) []string {
+	var problems []string
+
+	if original.Messages().Len() != generated.Messages().Len() {
+		return append(problems, fmt.Sprintf("%s: message count changed from %d to %d",
+			file, original.Messages().Len(), generated.Messages().Len()))
+	}
+	if original.Enums().Len() != generated.Enums().Len() {
+		return append(problems, fmt.Sprintf("%s: enum count changed from %d to %d",
+			file, original.Enums().Len(), generated.Enums().Len()))
+	}
+
+	for i := 0; i < original.Enums().Len(); i++ {
+		problems = append(problems, compareEnumDescriptors(file, original.Enums().Get(i), generated.Enums().Get(i))...)
+	}
+	for i := 0; i < original.Messages().Len(); i++ {
+		problems = append(problems, compareMessageDescriptors(file, original.Messages().Get(i), generated.Messages().Get(i), renames)...)
+	}
+
+	return problems
+}
+
+func compareMessageDescriptors(file string, original, generated protoreflect.MessageDescriptor, renames map[string]string) []string {
+	var problems []string
+	where := fmt.Sprintf("%s: %s", file, original.FullName())
+
+	if original.Fields().Len() != generated.Fields().Len() {
+		problems = append(problems, fmt.Sprintf("%s: field count changed from %d to %d",
+			where, original.Fields().Len(), generated.Fields().Len()))
+	} else {
+		for i := 0; i < original.Fields().Len(); i++ {
+			obfsField := original.Fields().Get(i)
+			genField := generated.Fields().Get(i)
+
+			if obfsField.Number() != genField.Number() ||
+				obfsField.Kind() != genField.Kind() ||
+				obfsField.Cardinality() != genField.Cardinality() {
+				problems = append(problems, fmt.Sprintf("%s: field %d changed from %s %s to %s %s",
+					where, obfsField.Number(), obfsField.Cardinality(), obfsField.Kind(), genField.Cardinality(), genField.Kind()))
+				continue
+			}
+
+			if (obfsField.ContainingOneof() == nil) != (genField.ContainingOneof() == nil) {
+				problems = append(problems, fmt.Sprintf("%s: field %d oneof membership changed", where, obfsField.Number()))
+			}
+
+			var obfsType, genType protoreflect.FullName
+			switch {
+			case obfsField.Message() != nil:
+				obfsType, genType = obfsField.Message().FullName(), genField.Message().FullName()
+			case obfsField.Enum() != nil:
+				obfsType, genType = obfsField.Enum().FullName(), genField.Enum().FullName()
+			}
+			if expected := renameFullName(obfsType, renames); expected != string(genType) {
+				problems = append(problems, fmt.Sprintf("%s: field %d references %s, expected %s",
+					where, obfsField.Number(), genType, expected))
+			}
+		}
+	}
+
+	if original.Oneofs().Len() != generated.Oneofs().Len() {
+		problems = append(problems, fmt.Sprintf("%s: oneof count changed from %d to %d",
+			where, original.Oneofs().Len(), generated.Oneofs().Len()))
+	}
+
+	if original.Enums().Len() != generated.Enums().Len() {
+		problems = append(problems, fmt.Sprintf("%s: nested enum count changed from %d to %d",
+			where, original.Enums().Len(), generated.Enums().Len()))
+	} else {
+		for i := 0; i < original.Enums().Len(); i++ {
+			problems = append(problems, compareEnumDescriptors(file, original.Enums().Get(i), generated.Enums().Get(i))...)
+		}
+	}
+
+	if original.Messages().Len() != generated.Messages().Len() {
+		problems = append(problems, fmt.Sprintf("%s: nested message count changed from %d to %d",
+			where, original.Messages().Len(), generated.Messages().Len()))
+	} else {
+		for i := 0; i < original.Messages().Len(); i++ {
+			problems = append(problems, compareMessageDescriptors(file, original.Messages().Get(i), generated.Messages().Get(i), renames)...)
+		}
+	}
+
+	return problems
+}
+
+func compareEnumDescriptors(file string, original, generated protoreflect.EnumDescriptor) []string {
+	where := fmt.Sprintf("%s: %s", file, original.FullName())
+
+	if original.Values().Len() != generated.Values().Len() {
+		return []string{fmt.Sprintf("%s: enum value count changed from %d to %d",
+			where, original.Values().Len(), generated.Values().Len())}
+	}
+
+	var problems []string
+	for i := 0; i < original.Values().Len(); i++ {
+		if original.Values().Get(i).Number() != generated.Values().Get(i).Number() {
+			problems = append(problems, fmt.Sprintf("%s: enum value %d renumbered from %d to %d",
+				where, i, original.Values().Get(i).Number(), generated.Values().Get(i).Number()))
+		}
+	}
+	return problems
+}
+
+// Apply the renames to every component of a fully qualified name
+func renameFullName(name protoreflect.FullName, renames map[string]string) string {
+	if name == "" {
+		return ""
+	}
+	parts := strings.Split(string(name), ".")
+	for i, part := range parts {
+		if renamed, ok := renames[part]; ok {
+			parts[i] = renamed
+		}
+	}
+	return strings.Join(parts, ".")
+}
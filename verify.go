@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ruinedyourlife/deobfs/utils"
+)
+
+// runVerify checks that mapping files weren't modified or corrupted since
+// they were written, and that they were signed with a key
+func runVerify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyFile := flags.String("key", "", "ed25519 public key (PEM) the mappings must be signed with")
+	flags.Parse(args)
+
+	logger := utils.InitLogger(utils.LevelInfo)
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"reports/mapping.json"}
+	}
+
+	failed := false
+	for _, file := range files {
+		mapping, err := loadVerifiedMapping(file, *keyFile)
+		if err != nil {
+			logger.Error("mapping verification failed", "file", file, "error", err)
+			failed = true
+			continue
+		}
+		status := "checksum ok"
+		if *keyFile != "" {
+			status = "checksum and signature ok"
+		}
+		fmt.Printf("%s: %s, %d matches\n", file, status, len(mapping.Matches))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// loadVerifiedMapping reads a mapping file and checks its checksum, and its
+// signature with the public key of keyFile when it isn't empty
+func loadVerifiedMapping(path, keyFile string) (*utils.Mapping, error) {
+	mapping, err := utils.LoadMapping(path)
+	if err != nil {
+		return nil, err
+	}
+	if keyFile == "" {
+		return mapping, mapping.Verify()
+	}
+	key, err := utils.LoadVerifyingKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return mapping, mapping.VerifySignature(key)
+}